@@ -325,6 +325,7 @@ module.exports = Object.freeze({
     VERSION: '1.10',
     NAMESPACE_LABEL_KEY: 'OWNER_INTEROPERATOR_NAMESPACE',
     LASTOPERATION_LABEL_KEY: 'interoperator.servicefabrik.io/lastoperation',
+    RETAINED_RESOURCES_LABEL_KEY: 'interoperator.servicefabrik.io/retained-resources',
     DEFAULT_NAMESPACE: 'default',
     NAMESPACE_OBJECT: 'Namespace',
     NAMESPACE_API_VERSION: 'v1',
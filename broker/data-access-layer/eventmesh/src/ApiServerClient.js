@@ -376,6 +376,26 @@ class ApiServerClient {
     const client = this._getApiClient('', CONST.APISERVER.NAMESPACE_API_VERSION);
     return Promise.try(() => client.createNamespace(resourceBody))
       .tap(() => logger.debug(`Successfully created namespace ${name}`))
+      .then(res => transformResponse(res))
+      .catch(err => {
+        return convertToHttpErrorAndThrow(err);
+      })
+      .catch(Conflict, err => {
+        // Namespace kept by interoperator for resources retained by an earlier instance of the same id
+        return this.getNamespace(name)
+          .then(res => {
+            if (!this.holdsRetainedResources(res.body)) {
+              throw err;
+            }
+            logger.info(`Reusing namespace ${name} holding retained resources`);
+            return res;
+          });
+      });
+  }
+
+  getNamespace(name) {
+    const client = this._getApiClient('', CONST.APISERVER.NAMESPACE_API_VERSION);
+    return Promise.try(() => client.readNamespace(name))
       .then(res => transformResponse(res))
       .catch(err => {
         return convertToHttpErrorAndThrow(err);
@@ -392,6 +412,26 @@ class ApiServerClient {
       });
   }
 
+  /**
+   * @description Delete the namespace of an instance unless it holds resources retained on deprovision.
+   * Interoperator deletes such namespaces once the retained resources are gone.
+   * @param {string} name - Name of the namespace
+   */
+  deleteInstanceNamespace(name) {
+    return this.getNamespace(name)
+      .then(res => {
+        if (this.holdsRetainedResources(res.body)) {
+          logger.info(`Not deleting namespace ${name} holding retained resources`);
+          return res;
+        }
+        return this.deleteNamespace(name);
+      });
+  }
+
+  holdsRetainedResources(namespace) {
+    return _.has(namespace, ['metadata', 'labels', CONST.APISERVER.RETAINED_RESOURCES_LABEL_KEY]);
+  }
+
   getNamespaceId(resourceId) {
     if (_.get(config, 'apiserver.enable_namespaced_separation')) {
       return `sf-${resourceId}`;
@@ -598,7 +638,7 @@ class ApiServerClient {
     return Promise.try(() => client.deleteNamespacedCustomObject(group, version, namespaceId, plural, opts.resourceId))
       .then(res => {
         if (_.get(config, 'apiserver.enable_namespaced_separation') && opts.resourceType === CONST.APISERVER.RESOURCE_TYPES.INTEROPERATOR_SERVICEINSTANCES) {
-          return this.deleteNamespace(namespaceId);
+          return this.deleteInstanceNamespace(namespaceId);
         }
         return res;
       })
@@ -770,6 +770,11 @@ describe('eventmesh', () => {
       it('Deletes interoperator resource along with namespace', () => {
         const expectedResponse = {};
         nockDeleteResource(CONST.APISERVER.RESOURCE_GROUPS.INTEROPERATOR, CONST.APISERVER.RESOURCE_TYPES.INTEROPERATOR_SERVICEINSTANCES, 'deployment1', 'namespace', expectedResponse);
+        mocks.apiServerEventMesh.nockGetNamespace('namespace', {
+          metadata: {
+            name: 'namespace'
+          }
+        }, 1);
         mocks.apiServerEventMesh.nockDeleteNamespace('namespace', {}, 1);
         config.apiserver.enable_namespaced_separation = true;
         return apiserver.deleteResource({
@@ -785,6 +790,32 @@ describe('eventmesh', () => {
             config.apiserver.enable_namespaced_separation = false;
           });
       });
+      it('Deletes interoperator resource and keeps namespace holding retained resources', () => {
+        const expectedResponse = {};
+        const namespace = {
+          metadata: {
+            name: 'namespace',
+            labels: {
+              [CONST.APISERVER.RETAINED_RESOURCES_LABEL_KEY]: 'true'
+            }
+          }
+        };
+        nockDeleteResource(CONST.APISERVER.RESOURCE_GROUPS.INTEROPERATOR, CONST.APISERVER.RESOURCE_TYPES.INTEROPERATOR_SERVICEINSTANCES, 'deployment1', 'namespace', expectedResponse);
+        mocks.apiServerEventMesh.nockGetNamespace('namespace', namespace, 1);
+        config.apiserver.enable_namespaced_separation = true;
+        return apiserver.deleteResource({
+            resourceId: 'deployment1',
+            resourceGroup: CONST.APISERVER.RESOURCE_GROUPS.INTEROPERATOR,
+            resourceType: CONST.APISERVER.RESOURCE_TYPES.INTEROPERATOR_SERVICEINSTANCES,
+            namespaceId: 'namespace'
+          })
+          .then(res => {
+            expect(res.statusCode).to.eql(200);
+            expect(res.body).to.eql(namespace);
+            verify();
+            config.apiserver.enable_namespaced_separation = false;
+          });
+      });
       it('Throws error when delete fails', () => {
         nockDeleteResource(CONST.APISERVER.RESOURCE_GROUPS.DEPLOYMENT, CONST.APISERVER.RESOURCE_TYPES.DIRECTOR, 'deployment1', undefined, {}, 404);
         return apiserver.deleteResource({
@@ -1169,6 +1200,11 @@ describe('eventmesh', () => {
         };
         config.apiserver.enable_namespaced_separation = true;
         mocks.apiServerEventMesh.nockCreateNamespace('namespace1', {}, 1, payload, 409);
+        mocks.apiServerEventMesh.nockGetNamespace('namespace1', {
+          metadata: {
+            name: 'namespace1'
+          }
+        }, 1);
         return apiserver.createNamespace('namespace1')
           .catch(err => {
             expect(err.status).to.eql(409);
@@ -1176,6 +1212,32 @@ describe('eventmesh', () => {
             config.apiserver.enable_namespaced_separation = false;
           });
       });
+      it('Reuses namespace holding retained resources', () => {
+        const payload = {
+          kind: CONST.APISERVER.NAMESPACE_OBJECT,
+          apiVersion: 'v1',
+          metadata: {
+            name: 'namespace1'
+          }
+        };
+        const namespace = {
+          metadata: {
+            name: 'namespace1',
+            labels: {
+              [CONST.APISERVER.RETAINED_RESOURCES_LABEL_KEY]: 'true'
+            }
+          }
+        };
+        config.apiserver.enable_namespaced_separation = true;
+        mocks.apiServerEventMesh.nockCreateNamespace('namespace1', {}, 1, payload, 409);
+        mocks.apiServerEventMesh.nockGetNamespace('namespace1', namespace, 1);
+        return apiserver.createNamespace('namespace1')
+          .then(res => {
+            expect(res.body).to.eql(namespace);
+            mocks.verify();
+            config.apiserver.enable_namespaced_separation = false;
+          });
+      });
       it('Creates namespace successfully with labels', () => {
         config.apiserver.services_namespace_labels = {
           'app.kubernetes.io/managed-by': 'Interoperator',
@@ -10,6 +10,7 @@ const apiServerHost = `https://${config.apiserver.ip}:${config.apiserver.port}`;
 
 
 exports.nockCreateResource = nockCreateResource;
+exports.nockGetNamespace = nockGetNamespace;
 exports.nockPatchResource = nockPatchResource;
 exports.nockGetResource = nockGetResource;
 exports.nockGetConfigMap = nockGetConfigMap;
@@ -81,6 +82,13 @@ function nockCreateNamespace(name, response, times, verifier, expectedStatusCode
     .reply(expectedStatusCode || 201, response);
 }
 
+function nockGetNamespace(name, response, times, expectedStatusCode) {
+  nock(apiServerHost)
+    .get(`/api/v1/namespaces/${name}`)
+    .times(times || 1)
+    .reply(expectedStatusCode || 200, response);
+}
+
 function nockDeleteNamespace(name, response, times, verifier, expectedStatusCode) {
   nock(apiServerHost)
     .delete(`/api/v1/namespaces/${name}`, verifier)
@@ -31,18 +31,101 @@ const (
 	UnbindAction               = "unbind"
 	SourcesAction              = "sources"
 	ClusterLabelSelectorAction = "clusterSelector"
+
+	// Hooks run as Jobs around the actions
+	PreProvisionAction   = "preProvision"
+	PostProvisionAction  = "postProvision"
+	PreUpdateAction      = "preUpdate"
+	PostUpdateAction     = "postUpdate"
+	PreDeprovisionAction = "preDeprovision"
+	PostBindAction       = "postBind"
+)
+
+// Drift policies of plans
+const (
+	DriftPolicyReport = "report"
+	DriftPolicyHeal   = "heal"
+)
+
+// Types of post render patches
+const (
+	StrategicMergePatchType = "strategic"
+	JSONPatchType           = "json"
 )
 
 // TemplateSpec is the specifcation of a template
 type TemplateSpec struct {
-	// +kubebuilder:validation:Enum=provision;status;bind;unbind;sources;clusterSelector
+	// +kubebuilder:validation:Enum=provision;status;bind;unbind;sources;clusterSelector;preProvision;postProvision;preUpdate;postUpdate;preDeprovision;postBind
 	Action string `yaml:"action" json:"action"`
 
-	// +kubebuilder:validation:Enum=gotemplate;helm
+	// Type of the renderer. One of gotemplate, helm, kustomize, jsonnet or
+	// the type of a renderer plugin configured in the interoperator config.
 	Type           string `yaml:"type" json:"type"`
 	URL            string `yaml:"url,omitempty" json:"url,omitempty"`
 	Content        string `yaml:"content,omitempty" json:"content,omitempty"`
 	ContentEncoded string `yaml:"contentEncoded,omitempty" json:"contentEncoded,omitempty"`
+
+	// Checksum of the template fetched from url as sha256:<digest>.
+	// Required for gotemplates fetched from url.
+	Checksum string `yaml:"checksum,omitempty" json:"checksum,omitempty"`
+
+	// Name of the secret in the interoperator namespace holding the
+	// credentials (username and password) for fetching the template
+	CredentialsSecretRef string `yaml:"credentialsSecretRef,omitempty" json:"credentialsSecretRef,omitempty"`
+
+	// Template libraries whose named templates are made available to the
+	// gotemplates of the template
+	Libraries []TemplateLibraryRef `yaml:"libraries,omitempty" json:"libraries,omitempty"`
+
+	// Patches applied in order to the objects rendered by the template
+	PostRender []PostRenderPatch `yaml:"postRender,omitempty" json:"postRender,omitempty"`
+}
+
+// TemplateLibraryRef refers to a version of a template library
+type TemplateLibraryRef struct {
+	Name    string `yaml:"name" json:"name"`
+	Version string `yaml:"version" json:"version"`
+}
+
+// PostRenderPatch is a patch applied to the objects rendered by a template
+type PostRenderPatch struct {
+	// Type of the patch. Strategic merge patches of kinds not known to
+	// the interoperator, like custom resources, are applied as json merge
+	// patches.
+	// +kubebuilder:validation:Enum=strategic;json
+	Type string `yaml:"type" json:"type"`
+
+	// Objects the patch is applied to. The patch is applied to all the
+	// rendered objects if not set.
+	Target *PatchTarget `yaml:"target,omitempty" json:"target,omitempty"`
+
+	// Patch in yaml or json. It is rendered as a gotemplate with the same
+	// values as the template. A json patch is a list of operations.
+	Patch string `yaml:"patch" json:"patch"`
+}
+
+// PatchTarget selects the objects a patch is applied to. Empty fields
+// match all the objects.
+type PatchTarget struct {
+	APIVersion string `yaml:"apiVersion,omitempty" json:"apiVersion,omitempty"`
+	Kind       string `yaml:"kind,omitempty" json:"kind,omitempty"`
+	Name       string `yaml:"name,omitempty" json:"name,omitempty"`
+}
+
+// IgnoreDifference lists fields of the rendered resources which are left to
+// other controllers, like the replicas of a deployment scaled by an
+// autoscaler. Empty APIVersion, Kind and Name match all the resources.
+type IgnoreDifference struct {
+	APIVersion string `yaml:"apiVersion,omitempty" json:"apiVersion,omitempty"`
+	Kind       string `yaml:"kind,omitempty" json:"kind,omitempty"`
+	Name       string `yaml:"name,omitempty" json:"name,omitempty"`
+
+	// JSONPointers to the ignored fields, e.g. /spec/replicas
+	JSONPointers []string `yaml:"jsonPointers,omitempty" json:"jsonPointers,omitempty"`
+
+	// JSONPaths selecting the ignored fields, e.g.
+	// $.spec.template.spec.containers[?(@.name=='app')].env
+	JSONPaths []string `yaml:"jsonPaths,omitempty" json:"jsonPaths,omitempty"`
 }
 
 // Schema definition for the input parameters.
@@ -95,6 +178,26 @@ type SFPlanSpec struct {
 	Templates              []TemplateSpec        `json:"templates"`
 	ServiceID              string                `json:"serviceId"`
 
+	// ServerSideApply applies the rendered resources of the instances and
+	// bindings of the plan with server-side apply instead of updating them.
+	ServerSideApply bool `json:"serverSideApply,omitempty"`
+
+	// RetentionPolicy of the rendered resources of the instances of the plan
+	// on deprovision. One of delete, retain or a duration for which the
+	// resources are retained. Defaults to delete.
+	RetentionPolicy string `json:"retentionPolicy,omitempty"`
+
+	// DriftPolicy decides how differences of the resources of the succeeded
+	// instances of the plan from their rendered resources are handled. One
+	// of report or heal. Defaults to report.
+	// +kubebuilder:validation:Enum=report;heal
+	DriftPolicy string `json:"driftPolicy,omitempty"`
+
+	// IgnoreDifferences lists fields of the rendered resources of the
+	// instances and bindings of the plan which are not updated once the
+	// resources exist
+	IgnoreDifferences []IgnoreDifference `json:"ignoreDifferences,omitempty"`
+
 	// +kubebuilder:pruning:PreserveUnknownFields
 	RawContext *runtime.RawExtension `json:"context,omitempty"`
 
@@ -55,6 +55,7 @@ type SFServiceBindingSpec struct {
 type SFServiceBindingStatus struct {
 	State       string               `yaml:"state,omitempty" json:"state,omitempty"`
 	Error       string               `yaml:"error,omitempty" json:"error,omitempty"`
+	Description string               `yaml:"description,omitempty" json:"description,omitempty"`
 	Response    BindingResponse      `yaml:"response,omitempty" json:"response,omitempty"`
 	AppliedSpec SFServiceBindingSpec `yaml:"appliedSpec,omitempty" json:"appliedSpec,omitempty"`
 	Resources   []Source             `yaml:"resources,omitempty" json:"resources,omitempty"`
@@ -29,6 +29,13 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+// Condition types of SFServiceInstance
+const (
+	// DriftedCondition is true if the sub resources of the instance
+	// differ from the resources rendered for it
+	DriftedCondition = "Drifted"
+)
+
 // SFServiceInstanceSpec defines the desired state of SFServiceInstance
 type SFServiceInstanceSpec struct {
 	InstanceID string `json:"instanceId,omitempty"`
@@ -65,6 +72,7 @@ type SFServiceInstanceStatus struct {
 	UpdateRepeatable string                `yaml:"updateRepeatable,omitempty" json:"updateRepeatable,omitempty"`
 	AppliedSpec      SFServiceInstanceSpec `yaml:"appliedSpec,omitempty" json:"appliedSpec,omitempty"`
 	Resources        []Source              `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Conditions       []metav1.Condition    `yaml:"conditions,omitempty" json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
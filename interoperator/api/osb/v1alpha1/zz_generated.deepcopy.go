@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -69,6 +70,31 @@ func (in *DashboardClient) DeepCopy() *DashboardClient {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IgnoreDifference) DeepCopyInto(out *IgnoreDifference) {
+	*out = *in
+	if in.JSONPointers != nil {
+		in, out := &in.JSONPointers, &out.JSONPointers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.JSONPaths != nil {
+		in, out := &in.JSONPaths, &out.JSONPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IgnoreDifference.
+func (in *IgnoreDifference) DeepCopy() *IgnoreDifference {
+	if in == nil {
+		return nil
+	}
+	out := new(IgnoreDifference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MaintenanceInfo) DeepCopyInto(out *MaintenanceInfo) {
 	*out = *in
@@ -113,6 +139,41 @@ func (in *MetadataSpec) DeepCopy() *MetadataSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatchTarget) DeepCopyInto(out *PatchTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchTarget.
+func (in *PatchTarget) DeepCopy() *PatchTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(PatchTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostRenderPatch) DeepCopyInto(out *PostRenderPatch) {
+	*out = *in
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(PatchTarget)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostRenderPatch.
+func (in *PostRenderPatch) DeepCopy() *PostRenderPatch {
+	if in == nil {
+		return nil
+	}
+	out := new(PostRenderPatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SFPlan) DeepCopyInto(out *SFPlan) {
 	*out = *in
@@ -193,7 +254,16 @@ func (in *SFPlanSpec) DeepCopyInto(out *SFPlanSpec) {
 	if in.Templates != nil {
 		in, out := &in.Templates, &out.Templates
 		*out = make([]TemplateSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.IgnoreDifferences != nil {
+		in, out := &in.IgnoreDifferences, &out.IgnoreDifferences
+		*out = make([]IgnoreDifference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.RawContext != nil {
 		in, out := &in.RawContext, &out.RawContext
@@ -473,6 +543,13 @@ func (in *SFServiceInstanceStatus) DeepCopyInto(out *SFServiceInstanceStatus) {
 		*out = make([]Source, len(*in))
 		copy(*out, *in)
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SFServiceInstanceStatus.
@@ -669,9 +746,36 @@ func (in *Source) DeepCopy() *Source {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateLibraryRef) DeepCopyInto(out *TemplateLibraryRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateLibraryRef.
+func (in *TemplateLibraryRef) DeepCopy() *TemplateLibraryRef {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateLibraryRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TemplateSpec) DeepCopyInto(out *TemplateSpec) {
 	*out = *in
+	if in.Libraries != nil {
+		in, out := &in.Libraries, &out.Libraries
+		*out = make([]TemplateLibraryRef, len(*in))
+		copy(*out, *in)
+	}
+	if in.PostRender != nil {
+		in, out := &in.PostRender, &out.PostRender
+		*out = make([]PostRenderPatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateSpec.
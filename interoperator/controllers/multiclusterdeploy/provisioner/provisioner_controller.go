@@ -41,9 +41,13 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var (
@@ -191,9 +195,28 @@ func (r *ReconcileProvisioner) Reconcile(ctx context.Context, req ctrl.Request)
 				return ctrl.Result{}, err
 			}
 		}
+
+		// 10. Creating/Updating secret generator key in target cluster, so that
+		// templates generate the same secrets in all clusters
+		err = r.reconcileSecret(namespace, interoperatorCfg.SecretGeneratorKeySecret, clusterID, targetClient)
+		if err != nil {
+			// Templates generating secrets fail in all clusters without the key
+			if !apiErrors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+			log.Info("Secret generator key not found in master cluster. Not replicating it", "clusterId", clusterID,
+				"secretName", interoperatorCfg.SecretGeneratorKeySecret)
+		}
+
+		// 11. Creating/Updating template libraries in target cluster, so that
+		// templates using them render in all clusters
+		err = r.reconcileTemplateLibraries(namespace, clusterID, targetClient)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
-	// 10. Create Deployment in target cluster for provisioner
+	// 12. Create Deployment in target cluster for provisioner
 	err = r.reconcileDeployment(deplomentInstance, clusterID, targetClient)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -440,6 +463,101 @@ func (r *ReconcileProvisioner) reconcileSecret(namespace string, secretName stri
 	return nil
 }
 
+// reconcileTemplateLibraries replicates the ConfigMaps of all the template
+// libraries in namespace to the target cluster and deletes the libraries in
+// the target cluster which no longer exist in master
+func (r *ReconcileProvisioner) reconcileTemplateLibraries(namespace string, clusterID string, targetClient client.Client) error {
+	ctx := context.Background()
+	log := r.Log.WithValues("clusterID", clusterID)
+
+	libraries := &corev1.ConfigMapList{}
+	err := r.List(ctx, libraries, client.InNamespace(namespace), client.HasLabels{constants.TemplateLibraryKey})
+	if err != nil {
+		log.Error(err, "Failed to list the template libraries in master")
+		return err
+	}
+	names := make(map[string]bool, len(libraries.Items))
+	for _, library := range libraries.Items {
+		err = r.reconcileConfigMap(namespace, library.GetName(), clusterID, targetClient)
+		if err != nil {
+			return err
+		}
+		names[library.GetName()] = true
+	}
+
+	targetLibraries := &corev1.ConfigMapList{}
+	err = targetClient.List(ctx, targetLibraries, client.InNamespace(namespace), client.HasLabels{constants.TemplateLibraryKey})
+	if err != nil {
+		log.Error(err, "Failed to list the template libraries in target cluster")
+		return err
+	}
+	for i := range targetLibraries.Items {
+		library := &targetLibraries.Items[i]
+		if names[library.GetName()] {
+			continue
+		}
+		log.Info("Template library not found in master. Deleting it in target cluster", "configMapName", library.GetName())
+		err = targetClient.Delete(ctx, library)
+		if err != nil && !apiErrors.IsNotFound(err) {
+			log.Error(err, "Error occurred while deleting template library in target cluster", "configMapName", library.GetName())
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ReconcileProvisioner) reconcileConfigMap(namespace string, configMapName string, clusterID string, targetClient client.Client) error {
+	ctx := context.Background()
+	log := r.Log.WithValues("clusterID", clusterID, "configMapName", configMapName)
+
+	clusterInstanceConfigMap := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: configMapName, Namespace: namespace}, clusterInstanceConfigMap)
+	if err != nil {
+		log.Error(err, "Failed to get the configmap from master")
+		return err
+	}
+	targetConfigMap := &corev1.ConfigMap{}
+	targetConfigMap.SetName(clusterInstanceConfigMap.GetName())
+	targetConfigMap.SetNamespace(clusterInstanceConfigMap.GetNamespace())
+	targetConfigMap.SetLabels(clusterInstanceConfigMap.GetLabels())
+	// copy Data
+	targetConfigMap.Data = make(map[string]string)
+	for key, val := range clusterInstanceConfigMap.Data {
+		targetConfigMap.Data[key] = val
+	}
+	targetConfigMap.BinaryData = make(map[string][]byte)
+	for key, val := range clusterInstanceConfigMap.BinaryData {
+		targetConfigMap.BinaryData[key] = val
+	}
+
+	log.Info("Replicating configmap to target cluster")
+	err = targetClient.Get(ctx, types.NamespacedName{
+		Name:      targetConfigMap.GetName(),
+		Namespace: targetConfigMap.GetNamespace(),
+	}, &corev1.ConfigMap{})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			log.Info("configmap not found in target cluster, Creating")
+			err = targetClient.Create(ctx, targetConfigMap)
+			if err != nil {
+				log.Error(err, "Error occurred while creating configmap in target cluster")
+				return err
+			}
+		} else {
+			log.Error(err, "Error occurred while creating configmap in target cluster")
+			return err
+		}
+	} else {
+		log.Info("ConfigMap exist in the target cluster. Updating")
+		err = targetClient.Update(ctx, targetConfigMap)
+		if err != nil {
+			log.Error(err, "Error occurred while updating configmap in target cluster")
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *ReconcileProvisioner) reconcileDeployment(deploymentInstance *appsv1.Deployment, clusterID string, targetClient client.Client) error {
 	ctx := context.Background()
 	log := r.Log.WithValues("clusterID", clusterID)
@@ -544,6 +662,50 @@ func (r *ReconcileProvisioner) reconcileClusterRoleBinding(namespace string, clu
 	return nil
 }
 
+// enqueueClusters returns the requests to reconcile all the clusters, so
+// that changes of the template libraries are replicated right away
+func (r *ReconcileProvisioner) enqueueClusters(ctx context.Context, a client.Object) []reconcile.Request {
+	clusters, err := r.clusterRegistry.ListClusters(nil)
+	if err != nil {
+		r.Log.Error(err, "Failed to list the clusters for template library", "configMapName", a.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(clusters.Items))
+	for _, cluster := range clusters.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      cluster.GetName(),
+				Namespace: cluster.GetNamespace(),
+			},
+		})
+	}
+	return requests
+}
+
+// templateLibraryFilter creates a predicate for filtering the ConfigMaps of
+// template libraries. Updates removing the label of a library are passed too,
+// as the library is removed from the target clusters then.
+func templateLibraryFilter() predicate.Predicate {
+	f := func(object client.Object) bool {
+		_, ok := object.GetLabels()[constants.TemplateLibraryKey]
+		return ok
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return f(e.Object)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return f(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return f(e.ObjectOld) || f(e.ObjectNew)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return f(e.Object)
+		},
+	}
+}
+
 // SetupWithManager registers the MCD Provisioner with manager
 // and setups the watches.
 func (r *ReconcileProvisioner) SetupWithManager(mgr ctrl.Manager) error {
@@ -582,6 +744,11 @@ func (r *ReconcileProvisioner) SetupWithManager(mgr ctrl.Manager) error {
 			&corev1.Secret{},
 			handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &resourcev1alpha1.SFCluster{}),
 		).
+		Watches(
+			&corev1.ConfigMap{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueClusters),
+			ctrlbuilder.WithPredicates(templateLibraryFilter()),
+		).
 		WithEventFilter(watches.NamespaceFilter())
 
 	return builder.Complete(r)
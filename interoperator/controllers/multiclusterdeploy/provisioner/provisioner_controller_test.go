@@ -39,8 +39,10 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrlrun "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var c client.Client
@@ -141,6 +143,14 @@ func TestReconcile(t *testing.T) {
 	clusterSecret.Data["foo"] = []byte("bar")
 	g.Expect(c.Create(context.TODO(), clusterSecret)).NotTo(gomega.HaveOccurred())
 
+	// Create secret generator key in master cluster
+	generatorKeySecret := &corev1.Secret{}
+	generatorKeySecret.SetName(constants.DefaultSecretGeneratorKeySecret)
+	generatorKeySecret.SetNamespace(constants.InteroperatorNamespace)
+	generatorKeySecret.Data = map[string][]byte{"key": []byte("master-key")}
+	g.Expect(c.Create(context.TODO(), generatorKeySecret)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), generatorKeySecret)
+
 	// create provisioner deployment in master cluster
 
 	labels := make(map[string]string)
@@ -174,6 +184,16 @@ func TestReconcile(t *testing.T) {
 		return nil
 	}, timeout).Should(gomega.Succeed())
 
+	// The secret generator key is replicated to the target cluster
+	replicatedKeySecret := &corev1.Secret{}
+	g.Eventually(func() error {
+		return targetReconciler.Get(context.TODO(), types.NamespacedName{
+			Name:      constants.DefaultSecretGeneratorKeySecret,
+			Namespace: constants.InteroperatorNamespace,
+		}, replicatedKeySecret)
+	}, timeout).Should(gomega.Succeed())
+	g.Expect(replicatedKeySecret.Data).To(gomega.Equal(generatorKeySecret.Data))
+
 	// Check if the interoperator_cluster_up metric reports UP after reconcile.
 	clusterID := clusterInstance.GetName()
 	interoperatorClusterUp := testutil.ToFloat64(clusterMetric.WithLabelValues(clusterID))
@@ -603,6 +623,137 @@ func TestReconcileProvisioner_reconcileSecret(t *testing.T) {
 	}
 }
 
+func TestReconcileProvisioner_reconcileTemplateLibraries(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mgr, err := manager.New(cfg, manager.Options{
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	c, err = client.New(cfg, client.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	c2, err := client.New(cfg2, client.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	library := &corev1.ConfigMap{}
+	library.SetName("library-common-1.0.0")
+	library.SetNamespace(constants.InteroperatorNamespace)
+	library.SetLabels(map[string]string{
+		constants.TemplateLibraryKey:        "common",
+		constants.TemplateLibraryVersionKey: "1.0.0",
+	})
+	library.Data = map[string]string{"labels.tpl": `{{- define "common.labels" }}app: postgres{{ end }}`}
+	g.Expect(c.Create(context.TODO(), library)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), library)
+
+	other := &corev1.ConfigMap{}
+	other.SetName("not-a-library")
+	other.SetNamespace(constants.InteroperatorNamespace)
+	g.Expect(c.Create(context.TODO(), other)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), other)
+
+	staleLibrary := &corev1.ConfigMap{}
+	staleLibrary.SetName("library-common-0.9.0")
+	staleLibrary.SetNamespace(constants.InteroperatorNamespace)
+	staleLibrary.SetLabels(map[string]string{
+		constants.TemplateLibraryKey:        "common",
+		constants.TemplateLibraryVersionKey: "0.9.0",
+	})
+	g.Expect(c2.Create(context.TODO(), staleLibrary)).NotTo(gomega.HaveOccurred())
+	defer c2.Delete(context.TODO(), staleLibrary)
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+
+	r := &ReconcileProvisioner{
+		Client:          c,
+		Log:             ctrlrun.Log.WithName("mcd").WithName("provisioner"),
+		clusterRegistry: mockClusterRegistry,
+	}
+
+	// Creates the library and updates it when it exists
+	for i := 0; i < 2; i++ {
+		g.Expect(r.reconcileTemplateLibraries(constants.InteroperatorNamespace, "2", c2)).NotTo(gomega.HaveOccurred())
+	}
+
+	// Deletes the libraries which no longer exist in master
+	err = c2.Get(context.TODO(), types.NamespacedName{Name: staleLibrary.GetName(), Namespace: constants.InteroperatorNamespace}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue())
+
+	replicatedLibrary := &corev1.ConfigMap{}
+	g.Expect(c2.Get(context.TODO(), types.NamespacedName{Name: library.GetName(), Namespace: constants.InteroperatorNamespace},
+		replicatedLibrary)).NotTo(gomega.HaveOccurred())
+	g.Expect(replicatedLibrary.GetLabels()).To(gomega.Equal(library.GetLabels()))
+	g.Expect(replicatedLibrary.Data).To(gomega.Equal(library.Data))
+	defer c2.Delete(context.TODO(), replicatedLibrary)
+
+	err = c2.Get(context.TODO(), types.NamespacedName{Name: other.GetName(), Namespace: constants.InteroperatorNamespace}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue())
+}
+
+func TestReconcileProvisioner_enqueueClusters(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClusterRegistry := mock_clusterRegistry.NewMockClusterRegistry(ctrl)
+	r := &ReconcileProvisioner{
+		Log:             ctrlrun.Log.WithName("mcd").WithName("provisioner"),
+		clusterRegistry: mockClusterRegistry,
+	}
+
+	clusters := &resourcev1alpha1.SFClusterList{}
+	for _, name := range []string{"1", "2"} {
+		cluster := resourcev1alpha1.SFCluster{}
+		cluster.SetName(name)
+		cluster.SetNamespace(constants.InteroperatorNamespace)
+		clusters.Items = append(clusters.Items, cluster)
+	}
+	mockClusterRegistry.EXPECT().ListClusters(nil).Return(clusters, nil)
+
+	library := &corev1.ConfigMap{}
+	library.SetName("library-common-1.0.0")
+	library.SetNamespace(constants.InteroperatorNamespace)
+	g.Expect(r.enqueueClusters(context.TODO(), library)).To(gomega.Equal([]reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "1", Namespace: constants.InteroperatorNamespace}},
+		{NamespacedName: types.NamespacedName{Name: "2", Namespace: constants.InteroperatorNamespace}},
+	}))
+}
+
+func Test_templateLibraryFilter(t *testing.T) {
+	library := &corev1.ConfigMap{}
+	library.SetLabels(map[string]string{constants.TemplateLibraryKey: "common"})
+	other := &corev1.ConfigMap{}
+
+	p := templateLibraryFilter()
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{name: "pass create of library", got: p.Create(event.CreateEvent{Object: library}), want: true},
+		{name: "filter create of other configmap", got: p.Create(event.CreateEvent{Object: other}), want: false},
+		{name: "pass delete of library", got: p.Delete(event.DeleteEvent{Object: library}), want: true},
+		{name: "pass update of library", got: p.Update(event.UpdateEvent{ObjectOld: library, ObjectNew: library}), want: true},
+		{name: "pass update removing library label", got: p.Update(event.UpdateEvent{ObjectOld: library, ObjectNew: other}), want: true},
+		{name: "filter update of other configmap", got: p.Update(event.UpdateEvent{ObjectOld: other, ObjectNew: other}), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("templateLibraryFilter() = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
 func TestReconcileProvisioner_reconcileDeployment(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	ctrl := gomock.NewController(t)
@@ -369,6 +369,12 @@ func (r *InstanceReplicator) reconcileNamespace(targetClient client.Client, name
 
 	}
 	if delete && sourceDeleting {
+		if _, ok := ns.GetLabels()[constants.RetainedResourcesKey]; ok {
+			// The provisioner deletes the namespace once the retained
+			// resources in it are gone
+			log.Info("namespace holds retained resources in target cluster, not deleting it")
+			return nil
+		}
 		err = targetClient.Delete(ctx, ns)
 		if err != nil {
 			if apiErrors.IsConflict(err) || apiErrors.IsNotFound(err) {
@@ -0,0 +1,326 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driftdetector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/services"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/validation"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Reasons of the Drifted condition
+const (
+	reasonNoDrift          = "NoDrift"
+	reasonResourcesDrifted = "ResourcesDrifted"
+	reasonDriftHealed      = "DriftHealed"
+)
+
+var (
+	driftMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "drifted_resources",
+			Namespace: "interoperator",
+			Subsystem: "service_instances_drift",
+			Help:      "Number of sub resources of the service instance differing from the rendered resources",
+		},
+		[]string{
+			"instance_id",
+			"service_id",
+			"plan_id",
+			"sf_namespace",
+		},
+	)
+)
+
+// Reconciler periodically compares the sub resources of succeeded
+// SFServiceInstances with the resources rendered for them
+type Reconciler struct {
+	client.Client
+	Log             logr.Logger
+	resourceManager resources.ResourceManager
+	validator       validation.Validator
+	cfgManager      config.Config
+}
+
+// Reconcile renders the expected resources of a succeeded instance, compares
+// them with the live resources and records the result in the Drifted
+// condition of the instance. Drifted resources are updated to the expected
+// resources if the drift policy of the plan is heal.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("sfserviceinstance", req.NamespacedName)
+
+	instance := &osbv1alpha1.SFServiceInstance{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			// Object not found, return.
+			driftMetric.DeletePartialMatch(prometheus.Labels{"instance_id": req.NamespacedName.Name})
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return ctrl.Result{}, err
+	}
+
+	// Resources of instances being operated on are expected to change
+	if instance.GetState() != "succeeded" || !instance.GetDeletionTimestamp().IsZero() {
+		driftMetric.DeletePartialMatch(prometheus.Labels{"instance_id": instance.GetName()})
+		return ctrl.Result{}, nil
+	}
+
+	clusterID, err := instance.GetClusterID()
+	if err != nil || clusterID != constants.OwnClusterID {
+		return ctrl.Result{}, nil
+	}
+
+	serviceID := instance.Spec.ServiceID
+	planID := instance.Spec.PlanID
+	instanceID := instance.GetName()
+	namespace := instance.GetNamespace()
+
+	plan, err := services.FindPlanInfo(r, serviceID, planID, constants.InteroperatorNamespace)
+	if err != nil {
+		log.Error(err, "failed finding plan info")
+		return ctrl.Result{}, err
+	}
+
+	expectedResources, err := r.resourceManager.ComputeExpectedResources(r, instanceID, "", serviceID, planID, osbv1alpha1.ProvisionAction, namespace)
+	if err != nil {
+		log.Error(err, "failed to compute expected resources")
+		return ctrl.Result{}, err
+	}
+	err = r.resourceManager.SetOwnerReference(instance, expectedResources, r.Scheme())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	drifted, err := r.resourceManager.ComputeDrift(r, expectedResources)
+	if err != nil {
+		log.Error(err, "failed to compute drift")
+		return ctrl.Result{}, err
+	}
+
+	var healed []*unstructured.Unstructured
+	if len(drifted) > 0 && plan.Spec.DriftPolicy == osbv1alpha1.DriftPolicyHeal && r.valid(log, drifted) {
+		log.Info("healing drifted resources", "resources", resourceNames(drifted))
+		_, err = r.resourceManager.ReconcileResources(r, drifted, nil, false)
+		if err != nil && !errors.WaveNotReady(err) {
+			log.Error(err, "failed to heal drifted resources")
+			return ctrl.Result{}, err
+		}
+		healed = drifted
+		drifted, err = r.resourceManager.ComputeDrift(r, expectedResources)
+		if err != nil {
+			log.Error(err, "failed to compute drift")
+			return ctrl.Result{}, err
+		}
+	}
+
+	driftMetric.WithLabelValues(instanceID, serviceID, planID, namespace).Set(float64(len(drifted)))
+
+	condition := metav1.Condition{
+		Type:    osbv1alpha1.DriftedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reasonNoDrift,
+		Message: "Resources match the rendered resources",
+	}
+	if len(drifted) > 0 {
+		log.Info("resources drifted", "resources", resourceNames(drifted))
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonResourcesDrifted
+		condition.Message = fmt.Sprintf("Resources differ from the rendered resources: %s", resourceNames(drifted))
+	} else if len(healed) > 0 {
+		condition.Reason = reasonDriftHealed
+		condition.Message = fmt.Sprintf("Healed resources differing from the rendered resources: %s", resourceNames(healed))
+	}
+	err = r.setCondition(req.NamespacedName, condition, 0)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{
+		RequeueAfter: r.interval(),
+	}, nil
+}
+
+// valid checks whether the drifted resources are valid against the schema
+// of the cluster. Invalid resources are reported as drifted but not healed.
+func (r *Reconciler) valid(log logr.Logger, drifted []*unstructured.Unstructured) bool {
+	if r.validator == nil {
+		return true
+	}
+	err := r.validator.Validate(drifted)
+	if err != nil {
+		log.Error(err, "not healing invalid resources")
+		return false
+	}
+	return true
+}
+
+// setCondition sets condition on the instance unless another operation
+// started in between
+func (r *Reconciler) setCondition(namespacedName types.NamespacedName, condition metav1.Condition, retryCount int) error {
+	ctx := context.Background()
+	log := r.Log.WithValues("sfserviceinstance", namespacedName, "function", "setCondition")
+
+	instance := &osbv1alpha1.SFServiceInstance{}
+	err := r.Get(ctx, namespacedName, instance)
+	if err != nil {
+		if retryCount < constants.ErrorThreshold {
+			log.Info("Retrying", "retryCount", retryCount+1)
+			return r.setCondition(namespacedName, condition, retryCount+1)
+		}
+		log.Error(err, "Updating condition failed")
+		return err
+	}
+
+	if instance.GetState() != "succeeded" {
+		log.Info("Not updating condition. state changed", "state", instance.GetState())
+		return nil
+	}
+	// Updating the status changes the generation of the instance, the
+	// condition does not record it to not trigger another reconcile
+	if !meta.SetStatusCondition(&instance.Status.Conditions, condition) {
+		return nil
+	}
+	err = r.Update(ctx, instance)
+	if err != nil {
+		if retryCount < constants.ErrorThreshold {
+			log.Info("Retrying", "retryCount", retryCount+1)
+			return r.setCondition(namespacedName, condition, retryCount+1)
+		}
+		log.Error(err, "Updating condition failed")
+		return err
+	}
+	log.Info("Updated condition", "type", condition.Type, "status", condition.Status, "reason", condition.Reason)
+	return nil
+}
+
+// interval returns the configured drift detection interval
+func (r *Reconciler) interval() time.Duration {
+	interoperatorCfg := r.cfgManager.GetConfig()
+	interval, err := time.ParseDuration(interoperatorCfg.DriftDetectionInterval)
+	if err == nil && interval <= 0 {
+		err = fmt.Errorf("interval %s not positive", interoperatorCfg.DriftDetectionInterval)
+	}
+	if err != nil {
+		r.Log.Error(err, "Failed to parse DriftDetectionInterval",
+			"DriftDetectionInterval", interoperatorCfg.DriftDetectionInterval)
+		interval, _ = time.ParseDuration(constants.DefaultDriftDetectionInterval)
+	}
+	return interval
+}
+
+// resourceNames lists resources by kind, namespace and name
+func resourceNames(resources []*unstructured.Unstructured) string {
+	names := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		names = append(names, fmt.Sprintf("%s %s/%s", resource.GetKind(), resource.GetNamespace(), resource.GetName()))
+	}
+	return strings.Join(names, ", ")
+}
+
+// SetupWithManager registers the drift detector with manager
+// and setups the watches.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Log.GetSink() == nil {
+		r.Log = ctrl.Log.WithName("provisioners").WithName("driftdetector")
+	}
+
+	if r.resourceManager == nil {
+		r.resourceManager = resources.New()
+	}
+
+	if r.validator == nil {
+		validator, err := validation.New(constants.OwnClusterID, mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		r.validator = validator
+	}
+
+	if r.cfgManager == nil {
+		cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.cfgManager = cfgManager
+	}
+	interoperatorCfg := r.cfgManager.GetConfig()
+
+	metrics.Registry.MustRegister(driftMetric)
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		Named("drift_detector").
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: interoperatorCfg.InstanceWorkerCount,
+		}).
+		For(&osbv1alpha1.SFServiceInstance{}, ctrlbuilder.WithPredicates(succeededFilter())).
+		WithEventFilter(watches.NamespaceLabelFilter())
+
+	return builder.Complete(r)
+}
+
+// succeededFilter creates a predicate passing only the events which start or
+// stop the periodic drift check of an instance. The check itself is driven
+// by RequeueAfter, so other updates of the instance (including the Drifted
+// condition set by the drift detector) are filtered out.
+func succeededFilter() predicate.Predicate {
+	succeeded := func(obj client.Object) bool {
+		instance, ok := obj.(*osbv1alpha1.SFServiceInstance)
+		return ok && instance.GetState() == "succeeded" && instance.GetDeletionTimestamp().IsZero()
+	}
+	p := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return succeeded(e.Object)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return true
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return succeeded(e.ObjectOld) != succeeded(e.ObjectNew)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+	return p
+}
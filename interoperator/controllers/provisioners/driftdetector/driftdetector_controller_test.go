@@ -0,0 +1,275 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driftdetector
+
+import (
+	"context"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources/mock_resources"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Reconciler", func() {
+
+	Describe("Reconcile", func() {
+		var (
+			r                   *Reconciler
+			mockCtrl            *gomock.Controller
+			mockResourceManager *mock_resources.MockResourceManager
+			instance            *osbv1alpha1.SFServiceInstance
+			plan                *osbv1alpha1.SFPlan
+			expectedResources   []*unstructured.Unstructured
+		)
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockResourceManager = mock_resources.NewMockResourceManager(mockCtrl)
+			cfgManager, err := config.New(cfg, scheme.Scheme, nil)
+			Expect(err).NotTo(HaveOccurred())
+			r = &Reconciler{
+				Client:          k8sClient,
+				Log:             ctrl.Log.WithName("provisioners").WithName("driftdetector"),
+				resourceManager: mockResourceManager,
+				cfgManager:      cfgManager,
+			}
+
+			deployment := &unstructured.Unstructured{}
+			deployment.SetAPIVersion("apps/v1")
+			deployment.SetKind("Deployment")
+			deployment.SetName("postgres")
+			deployment.SetNamespace(constants.InteroperatorNamespace)
+			expectedResources = []*unstructured.Unstructured{deployment}
+
+			plan = _getDummyPlan("")
+			instance = _getDummyInstance("succeeded")
+		})
+
+		JustBeforeEach(func() {
+			Expect(k8sClient.Create(context.TODO(), plan)).Should(Succeed())
+			Expect(k8sClient.Create(context.TODO(), instance)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(context.TODO(), instance)).Should(Succeed())
+			Expect(k8sClient.Delete(context.TODO(), plan)).Should(Succeed())
+			mockCtrl.Finish()
+		})
+
+		expectRender := func() {
+			mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "", "service-id", "plan-id",
+				osbv1alpha1.ProvisionAction, constants.InteroperatorNamespace).Return(expectedResources, nil)
+			mockResourceManager.EXPECT().SetOwnerReference(gomock.Any(), expectedResources, gomock.Any()).Return(nil)
+		}
+
+		driftedCondition := func() *metav1.Condition {
+			current := &osbv1alpha1.SFServiceInstance{}
+			Expect(k8sClient.Get(context.TODO(), _getKey(instance), current)).Should(Succeed())
+			return meta.FindStatusCondition(current.Status.Conditions, osbv1alpha1.DriftedCondition)
+		}
+
+		It("should report no drift", func() {
+			expectRender()
+			mockResourceManager.EXPECT().ComputeDrift(gomock.Any(), expectedResources).Return(nil, nil)
+
+			result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: _getKey(instance)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(10 * time.Minute))
+
+			condition := driftedCondition()
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(reasonNoDrift))
+		})
+
+		It("should report drifted resources", func() {
+			expectRender()
+			mockResourceManager.EXPECT().ComputeDrift(gomock.Any(), expectedResources).Return(expectedResources, nil)
+
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: _getKey(instance)})
+			Expect(err).NotTo(HaveOccurred())
+
+			condition := driftedCondition()
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal(reasonResourcesDrifted))
+			Expect(condition.Message).To(ContainSubstring("Deployment default/postgres"))
+		})
+
+		Context("when the drift policy of the plan is heal", func() {
+			BeforeEach(func() {
+				plan = _getDummyPlan(osbv1alpha1.DriftPolicyHeal)
+			})
+
+			It("should heal drifted resources", func() {
+				expectRender()
+				gomock.InOrder(
+					mockResourceManager.EXPECT().ComputeDrift(gomock.Any(), expectedResources).Return(expectedResources, nil),
+					mockResourceManager.EXPECT().ReconcileResources(gomock.Any(), expectedResources, nil, false).Return(nil, nil),
+					mockResourceManager.EXPECT().ComputeDrift(gomock.Any(), expectedResources).Return(nil, nil),
+				)
+
+				_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: _getKey(instance)})
+				Expect(err).NotTo(HaveOccurred())
+
+				condition := driftedCondition()
+				Expect(condition).NotTo(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+				Expect(condition.Reason).To(Equal(reasonDriftHealed))
+			})
+
+			It("should not heal invalid resources", func() {
+				r.validator = validatorFunc(func(objects []*unstructured.Unstructured) error {
+					return errors.NewValidationError("Deployment postgres: .spec.replicas: expected numeric", nil)
+				})
+				expectRender()
+				mockResourceManager.EXPECT().ComputeDrift(gomock.Any(), expectedResources).Return(expectedResources, nil)
+
+				_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: _getKey(instance)})
+				Expect(err).NotTo(HaveOccurred())
+
+				condition := driftedCondition()
+				Expect(condition).NotTo(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				Expect(condition.Reason).To(Equal(reasonResourcesDrifted))
+			})
+		})
+
+		Context("when the instance is not succeeded", func() {
+			BeforeEach(func() {
+				instance = _getDummyInstance("update")
+			})
+
+			It("should not compare resources", func() {
+				result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: _getKey(instance)})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(BeZero())
+				Expect(driftedCondition()).To(BeNil())
+			})
+
+			It("should remove the drift metric of the instance", func() {
+				driftMetric.WithLabelValues("instance-id", "service-id", "plan-id", constants.InteroperatorNamespace).Set(1)
+
+				_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: _getKey(instance)})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(testutil.CollectAndCount(driftMetric)).To(BeZero())
+			})
+		})
+	})
+
+	Describe("succeededFilter", func() {
+		var (
+			succeeded = _getDummyInstance("succeeded")
+			updating  = _getDummyInstance("update")
+		)
+
+		It("should pass creation of succeeded instances", func() {
+			Expect(succeededFilter().Create(event.CreateEvent{Object: succeeded})).To(BeTrue())
+			Expect(succeededFilter().Create(event.CreateEvent{Object: updating})).To(BeFalse())
+		})
+
+		It("should pass only transitions into and out of succeeded", func() {
+			Expect(succeededFilter().Update(event.UpdateEvent{ObjectOld: updating, ObjectNew: succeeded})).To(BeTrue())
+			Expect(succeededFilter().Update(event.UpdateEvent{ObjectOld: succeeded, ObjectNew: updating})).To(BeTrue())
+			Expect(succeededFilter().Update(event.UpdateEvent{ObjectOld: succeeded, ObjectNew: succeeded})).To(BeFalse())
+			Expect(succeededFilter().Update(event.UpdateEvent{ObjectOld: updating, ObjectNew: updating})).To(BeFalse())
+		})
+
+		It("should pass deletion of instances", func() {
+			Expect(succeededFilter().Delete(event.DeleteEvent{Object: updating})).To(BeTrue())
+		})
+	})
+
+	Describe("SetupWithManager", func() {
+		It("should add the contoller", func() {
+			r := &Reconciler{
+				Client: k8sClient,
+			}
+			Expect(r.SetupWithManager(k8sManager)).Should(Succeed())
+		})
+	})
+})
+
+type validatorFunc func(objects []*unstructured.Unstructured) error
+
+func (f validatorFunc) Validate(objects []*unstructured.Unstructured) error {
+	return f(objects)
+}
+
+func _getKey(instance *osbv1alpha1.SFServiceInstance) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      instance.GetName(),
+		Namespace: instance.GetNamespace(),
+	}
+}
+
+func _getDummyInstance(state string) *osbv1alpha1.SFServiceInstance {
+	return &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "instance-id",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+			ClusterID: constants.OwnClusterID,
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: state,
+		},
+	}
+}
+
+func _getDummyPlan(driftPolicy string) *osbv1alpha1.SFPlan {
+	return &osbv1alpha1.SFPlan{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "plan-id",
+			Namespace: constants.InteroperatorNamespace,
+			Labels:    map[string]string{"serviceId": "service-id", "planId": "plan-id"},
+		},
+		Spec: osbv1alpha1.SFPlanSpec{
+			Name:        "plan-name",
+			ID:          "plan-id",
+			Description: "description",
+			Bindable:    true,
+			ServiceID:   "service-id",
+			DriftPolicy: driftPolicy,
+			Templates: []osbv1alpha1.TemplateSpec{
+				{
+					Action:  osbv1alpha1.ProvisionAction,
+					Type:    "gotemplate",
+					Content: "---",
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retainedresourcecleaner
+
+import (
+	"context"
+	"time"
+
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
+
+	"github.com/go-logr/logr"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+var cleanupRetainedResources = resources.CleanupRetainedResources
+
+// Reconciler deletes the resources retained on deprovision of instances
+// once their retention period expired
+type Reconciler struct {
+	client.Client
+	Log            logr.Logger
+	uncachedClient client.Client
+	cfgManager     config.Config
+}
+
+// Reconcile deletes the expired retained resources of the kinds watched by
+// the instance controller and requeues the own SFCluster until the next
+// retained resource expires
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("SFCluster", req.NamespacedName)
+
+	cluster := &resourcev1alpha1.SFCluster{}
+	err := r.Get(ctx, req.NamespacedName, cluster)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			// Object not found, return.
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return ctrl.Result{}, err
+	}
+
+	clusterID := cluster.GetName()
+	if clusterID != constants.OwnClusterID {
+		// Should cleanup only in own cluster
+		return ctrl.Result{}, nil
+	}
+
+	interoperatorCfg := r.cfgManager.GetConfig()
+	nextExpiry, err := cleanupRetainedResources(r.uncachedClient, interoperatorCfg.InstanceContollerWatchList)
+	if err != nil {
+		log.Error(err, "failed to cleanup retained resources")
+		return ctrl.Result{}, err
+	}
+
+	requeueAfter := constants.RetentionCleanupInterval
+	if !nextExpiry.IsZero() && time.Until(nextExpiry) < requeueAfter {
+		requeueAfter = time.Until(nextExpiry)
+		if requeueAfter < time.Second {
+			requeueAfter = time.Second
+		}
+	}
+	return ctrl.Result{
+		RequeueAfter: requeueAfter,
+	}, nil
+}
+
+// SetupWithManager registers the retained resource cleaner with manager
+// and setups the watches.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Log.GetSink() == nil {
+		r.Log = ctrl.Log.WithName("provisioners").WithName("retainedresourcecleaner")
+	}
+
+	if r.uncachedClient == nil {
+		// Retained resources are listed rarely, without caching all
+		// resources of the watched kinds
+		uncachedClient, err := client.New(mgr.GetConfig(), client.Options{
+			Scheme: mgr.GetScheme(),
+			Mapper: mgr.GetRESTMapper(),
+		})
+		if err != nil {
+			return err
+		}
+		r.uncachedClient = uncachedClient
+	}
+
+	if r.cfgManager == nil {
+		cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		r.cfgManager = cfgManager
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		Named("retained_resource_cleaner").
+		For(&resourcev1alpha1.SFCluster{}).
+		WithEventFilter(watches.NamespaceFilter()).
+		WithEventFilter(predicate.GenerationChangedPredicate{})
+
+	return builder.Complete(r)
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retainedresourcecleaner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Reconciler", func() {
+
+	Describe("Reconcile", func() {
+		var (
+			r          *Reconciler
+			sfcluster  *resourcev1alpha1.SFCluster
+			calls      int
+			nextExpiry time.Time
+			cleanupErr error
+		)
+
+		BeforeEach(func() {
+			cfgManager, err := config.New(cfg, scheme.Scheme, nil)
+			Expect(err).NotTo(HaveOccurred())
+			r = &Reconciler{
+				Client:         k8sClient,
+				Log:            ctrl.Log.WithName("provisioners").WithName("retainedresourcecleaner"),
+				uncachedClient: k8sClient,
+				cfgManager:     cfgManager,
+			}
+			calls = 0
+			nextExpiry = time.Time{}
+			cleanupErr = nil
+			cleanupRetainedResources = func(c client.Client, kinds []osbv1alpha1.APIVersionKind) (time.Time, error) {
+				calls++
+				return nextExpiry, cleanupErr
+			}
+		})
+
+		AfterEach(func() {
+			if sfcluster != nil {
+				Expect(k8sClient.Delete(context.TODO(), sfcluster)).Should(Succeed())
+				sfcluster = nil
+			}
+		})
+
+		It("should cleanup retained resources in own cluster", func() {
+			sfcluster = _getDummySFCLuster(constants.OwnClusterID)
+			Expect(k8sClient.Create(context.TODO(), sfcluster)).Should(Succeed())
+
+			result, err := r.Reconcile(context.TODO(), _getRequest(sfcluster))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(Equal(1))
+			Expect(result.RequeueAfter).To(Equal(constants.RetentionCleanupInterval))
+		})
+
+		It("should requeue when the next retained resource expires", func() {
+			sfcluster = _getDummySFCLuster(constants.OwnClusterID)
+			Expect(k8sClient.Create(context.TODO(), sfcluster)).Should(Succeed())
+			nextExpiry = time.Now().Add(time.Minute)
+
+			result, err := r.Reconcile(context.TODO(), _getRequest(sfcluster))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<=", time.Minute))
+			Expect(result.RequeueAfter).To(BeNumerically(">", time.Minute-5*time.Second))
+		})
+
+		It("should fail if cleanup fails", func() {
+			sfcluster = _getDummySFCLuster(constants.OwnClusterID)
+			Expect(k8sClient.Create(context.TODO(), sfcluster)).Should(Succeed())
+			cleanupErr = fmt.Errorf("some error")
+
+			_, err := r.Reconcile(context.TODO(), _getRequest(sfcluster))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should not cleanup retained resources for other sfcluster", func() {
+			sfcluster = _getDummySFCLuster("cluster")
+			Expect(k8sClient.Create(context.TODO(), sfcluster)).Should(Succeed())
+
+			result, err := r.Reconcile(context.TODO(), _getRequest(sfcluster))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(Equal(0))
+			Expect(result.RequeueAfter).To(BeZero())
+		})
+
+		It("should ignore deleted sfcluster", func() {
+			result, err := r.Reconcile(context.TODO(), _getRequest(_getDummySFCLuster(constants.OwnClusterID)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(Equal(0))
+			Expect(result.RequeueAfter).To(BeZero())
+		})
+	})
+
+	Describe("SetupWithManager", func() {
+		It("should add the contoller", func() {
+			r := &Reconciler{
+				Client: k8sClient,
+			}
+			Expect(r.SetupWithManager(k8sManager)).Should(Succeed())
+		})
+	})
+})
+
+func _getRequest(sfcluster *resourcev1alpha1.SFCluster) ctrl.Request {
+	return ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      sfcluster.GetName(),
+			Namespace: sfcluster.GetNamespace(),
+		},
+	}
+}
+
+func _getDummySFCLuster(name string) *resourcev1alpha1.SFCluster {
+	return &resourcev1alpha1.SFCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Spec: resourcev1alpha1.SFClusterSpec{
+			SecretRef: name,
+		},
+	}
+}
@@ -22,12 +22,17 @@ package provisioners
 import (
 	"os"
 
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners/driftdetector"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners/retainedresourcecleaner"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners/sfclusterusage"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners/sfplan"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners/sfservice"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners/sfservicebinding"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners/sfservicebindingcleaner"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners/sfserviceinstance"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	rendererFactory "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/factory"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/watches"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -45,6 +50,14 @@ func SetupWithManager(mgr ctrl.Manager) error {
 		os.Exit(1)
 	}
 
+	cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
+	if err != nil {
+		setupLog.Error(err, "unable to read interoperator config")
+		return err
+	}
+	rendererFactory.Configure(cfgManager.GetConfig())
+	resources.SetDeleteStrategies(cfgManager.GetConfig().DeleteStrategies)
+
 	if err = (&sfservice.ReconcileSFService{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("provisioners").WithName("service"),
@@ -93,5 +106,21 @@ func SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err = (&retainedresourcecleaner.Reconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("provisioners").WithName("retainedresourcecleaner"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create provisioner", "controller", "RetainedResourceCleaner")
+		return err
+	}
+
+	if err = (&driftdetector.Reconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("provisioners").WithName("driftdetector"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create provisioner", "controller", "DriftDetector")
+		return err
+	}
+
 	return nil
 }
@@ -25,8 +25,10 @@ import (
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/operation"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/properties"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/validation"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
@@ -51,6 +53,7 @@ type ReconcileSFServiceBinding struct {
 	Log             logr.Logger
 	clusterRegistry registry.ClusterRegistry
 	resourceManager resources.ResourceManager
+	validator       validation.Validator
 	watchList       []osbv1alpha1.APIVersionKind
 	cfgManager      config.Config
 }
@@ -134,7 +137,16 @@ func (r *ReconcileSFServiceBinding) Reconcile(ctx context.Context, req ctrl.Requ
 			// Unbind Template is not present, delete all resources created
 			resourceRefs = append(binding.Status.Resources, bindSecret)
 		} else {
-			_, err = r.resourceManager.ReconcileResources(r, expectedResources, binding.Status.Resources, true)
+			err = operation.Validate(r.validator, expectedResources)
+			if err != nil {
+				log.Error(err, "Validation of expected resources failed", "binding", bindingID)
+				return r.handleError(binding, ctrl.Result{}, err, state, 0)
+			}
+
+			unbindResourceRefs, err := r.resourceManager.ReconcileResources(r, expectedResources, binding.Status.Resources, true)
+			if errors.WaveNotReady(err) {
+				return r.waitForWave(binding, unbindResourceRefs, err, state)
+			}
 			if err != nil {
 				log.Error(err, "ReconcileResources failed", "binding", bindingID)
 				return r.handleError(binding, ctrl.Result{}, err, state, 0)
@@ -145,6 +157,9 @@ func (r *ReconcileSFServiceBinding) Reconcile(ctx context.Context, req ctrl.Requ
 		}
 
 		remainingResource, err := r.resourceManager.DeleteSubResources(r, resourceRefs)
+		if errors.WaveNotReady(err) {
+			return r.waitForWave(binding, remainingResource, err, state)
+		}
 		if err != nil {
 			log.Error(err, "Delete sub resources failed", "binding", bindingID)
 			return r.handleError(binding, ctrl.Result{}, err, state, 0)
@@ -164,11 +179,34 @@ func (r *ReconcileSFServiceBinding) Reconcile(ctx context.Context, req ctrl.Requ
 			return r.handleError(binding, ctrl.Result{}, err, state, 0)
 		}
 
+		err = operation.Validate(r.validator, expectedResources)
+		if err != nil {
+			log.Error(err, "Validation of expected resources failed", "binding", bindingID)
+			return r.handleError(binding, ctrl.Result{}, err, state, 0)
+		}
+
 		resourceRefs, err := r.resourceManager.ReconcileResources(r, expectedResources, binding.Status.Resources, false)
+		if errors.WaveNotReady(err) {
+			return r.waitForWave(binding, resourceRefs, err, state)
+		}
 		if err != nil {
 			log.Error(err, "ReconcileResources failed", "binding", bindingID)
 			return r.handleError(binding, ctrl.Result{}, err, state, 0)
 		}
+
+		err = operation.RunHook(r, r.Log, r.resourceManager, r.validator, binding, osbv1alpha1.PostBindAction)
+		if err != nil {
+			// Record the reconciled resources while waiting for the hook
+			// and before failing
+			if setErr := operation.SetResources(r, r.Log, binding, resourceRefs, 0); setErr != nil {
+				return r.handleError(binding, ctrl.Result{}, setErr, state, 0)
+			}
+			if errors.HookPending(err) {
+				return operation.WaitForHook(r.Log, binding, err, state)
+			}
+			log.Error(err, "Post bind hook failed", "binding", bindingID)
+			return r.handleError(binding, ctrl.Result{}, err, state, 0)
+		}
 		err = r.setInProgress(req.NamespacedName, state, resourceRefs, 0)
 		if err != nil {
 			return r.handleError(binding, ctrl.Result{}, err, state, 0)
@@ -241,6 +279,15 @@ func (r *ReconcileSFServiceBinding) reconcileFinalizers(object *osbv1alpha1.SFSe
 	return nil
 }
 
+// waitForWave requeues the binding until the wave it waits for is ready
+func (r *ReconcileSFServiceBinding) waitForWave(binding *osbv1alpha1.SFServiceBinding, resources []osbv1alpha1.Source, waveErr error, state string) (ctrl.Result, error) {
+	result, err := operation.WaitForWave(r, r.Log, binding, resources, waveErr, state)
+	if err != nil {
+		return r.handleError(binding, ctrl.Result{}, err, state, 0)
+	}
+	return result, nil
+}
+
 func (r *ReconcileSFServiceBinding) setInProgress(namespacedName types.NamespacedName, state string, resources []osbv1alpha1.Source, retryCount int) error {
 	ctx := context.Background()
 	log := r.Log.WithValues("sfservicebinding", namespacedName)
@@ -263,6 +310,8 @@ func (r *ReconcileSFServiceBinding) setInProgress(namespacedName types.Namespace
 		}
 		labels[constants.LastOperationKey] = state
 		binding.SetLabels(labels)
+		// The hooks of the operation completed
+		operation.ClearRun(binding)
 		binding.Status.Resources = resources
 		err = r.Update(context.Background(), binding)
 		if err != nil {
@@ -508,6 +557,9 @@ func (r *ReconcileSFServiceBinding) handleError(object *osbv1alpha1.SFServiceBin
 		}
 	}
 
+	if operation.FailRightAway(r, r.Log, object, inputErr, lastOperation) {
+		return result, nil
+	}
 	if inputErr == nil {
 		if count == 0 {
 			//No change for count
@@ -521,6 +573,7 @@ func (r *ReconcileSFServiceBinding) handleError(object *osbv1alpha1.SFServiceBin
 	if count > constants.ErrorThreshold {
 		log.Error(inputErr, "Retry threshold reached. Ignoring error", "objectID", objectID)
 		object.Status.State = "failed"
+		operation.ClearRun(object)
 		object.Status.Error = fmt.Sprintf("Retry threshold reached for %s.\n%s", objectID, inputErr.Error())
 		if lastOperation != "" {
 			labels[constants.LastOperationKey] = lastOperation
@@ -580,6 +633,14 @@ func (r *ReconcileSFServiceBinding) SetupWithManager(mgr ctrl.Manager) error {
 		r.resourceManager = resources.New()
 	}
 
+	if r.validator == nil {
+		validator, err := validation.New(constants.OwnClusterID, mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		r.validator = validator
+	}
+
 	cfgManager, err := config.New(mgr.GetConfig(), mgr.GetScheme(), mgr.GetRESTMapper())
 	if err != nil {
 		return err
@@ -152,6 +152,8 @@ func TestReconcile(t *testing.T) {
 
 	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "binding-id", "service-id", "plan-id", osbv1alpha1.BindAction, constants.InteroperatorNamespace).Return(expectedResources, nil).AnyTimes()
 	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "binding-id", "service-id", "plan-id", osbv1alpha1.UnbindAction, constants.InteroperatorNamespace).Return(nil, errors.NewTemplateNotFound("unbind", "plan-id", nil)).AnyTimes()
+	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "binding-id", "service-id", "plan-id", osbv1alpha1.PostBindAction, constants.InteroperatorNamespace).Return(expectedResources, nil).AnyTimes()
+	mockResourceManager.EXPECT().RunHook(gomock.Any(), gomock.Any(), "postBind-in_queue-1").Return(nil).MinTimes(1)
 	mockResourceManager.EXPECT().SetOwnerReference(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	mockClusterRegistry.EXPECT().GetClient("1").Return(controller, nil).AnyTimes()
 	mockResourceManager.EXPECT().ReconcileResources(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(appliedResources, err1).Times(1)
@@ -296,12 +298,42 @@ func TestReconcileSFServiceBinding_handleError(t *testing.T) {
 		retryCount    int
 	}
 	tests := []struct {
-		name    string
-		setup   func()
-		args    args
-		want    reconcile.Result
-		wantErr bool
+		name                  string
+		setup                 func()
+		args                  args
+		want                  reconcile.Result
+		wantErr               bool
+		wantStatusError       string
+		wantStatusDescription string
 	}{
+		{
+			name: "fail right away if inputErr is ValidationError",
+			args: args{
+				object:        binding,
+				result:        reconcile.Result{},
+				inputErr:      errors.NewValidationError("Secret credentials: .dta: field not declared in schema", nil),
+				lastOperation: "in_queue",
+				retryCount:    0,
+			},
+			want:                  reconcile.Result{},
+			wantErr:               false,
+			wantStatusError:       "ValidationError encountered for binding-id.\nSecret credentials: .dta: field not declared in schema",
+			wantStatusDescription: "Invalid resources rendered: Secret credentials: .dta: field not declared in schema",
+		},
+		{
+			name: "fail right away if inputErr is AdoptionConflict",
+			args: args{
+				object:        binding,
+				result:        reconcile.Result{},
+				inputErr:      errors.NewAdoptionConflict("Secret", "default/credentials", "is owned by SFServiceBinding other-binding", nil),
+				lastOperation: "in_queue",
+				retryCount:    0,
+			},
+			want:                  reconcile.Result{},
+			wantErr:               false,
+			wantStatusError:       "AdoptionConflict encountered for binding-id.\nSecret default/credentials already exists and is owned by SFServiceBinding other-binding",
+			wantStatusDescription: "Rendered resources conflict with existing resources: Secret default/credentials already exists and is owned by SFServiceBinding other-binding",
+		},
 		{
 			name: "ignore error if retry count is reached",
 			args: args{
@@ -362,6 +394,12 @@ func TestReconcileSFServiceBinding_handleError(t *testing.T) {
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("ReconcileSFServiceBinding.handleError() = %v, want %v", got, tt.want)
 			}
+			if tt.wantStatusError != "" && tt.args.object.Status.Error != tt.wantStatusError {
+				t.Errorf("ReconcileSFServiceBinding.handleError() status error = %v, want %v", tt.args.object.Status.Error, tt.wantStatusError)
+			}
+			if tt.wantStatusDescription != "" && tt.args.object.Status.Description != tt.wantStatusDescription {
+				t.Errorf("ReconcileSFServiceBinding.handleError() status description = %v, want %v", tt.args.object.Status.Description, tt.wantStatusDescription)
+			}
 		})
 	}
 }
@@ -26,9 +26,11 @@ import (
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/operation"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/properties"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/services"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/validation"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
@@ -52,6 +54,7 @@ type ReconcileSFServiceInstance struct {
 	Log             logr.Logger
 	clusterRegistry registry.ClusterRegistry
 	resourceManager resources.ResourceManager
+	validator       validation.Validator
 	watchList       []osbv1alpha1.APIVersionKind
 	cfgManager      config.Config
 }
@@ -129,7 +132,19 @@ func (r *ReconcileSFServiceInstance) Reconcile(ctx context.Context, req ctrl.Req
 	if state == "delete" && !instance.GetDeletionTimestamp().IsZero() {
 		// The object is being deleted
 		// so lets handle our external dependency
+		err = r.runHook(instance, osbv1alpha1.PreDeprovisionAction)
+		if errors.HookPending(err) {
+			return operation.WaitForHook(r.Log, instance, err, state)
+		}
+		if err != nil {
+			log.Error(err, "Pre deprovision hook failed")
+			return r.handleError(instance, ctrl.Result{}, err, state, 0)
+		}
+
 		remainingResource, err := r.resourceManager.DeleteSubResources(r, instance.Status.Resources)
+		if errors.WaveNotReady(err) {
+			return r.waitForWave(instance, remainingResource, err, state)
+		}
 		if err != nil {
 			log.Error(err, "Delete sub resources failed")
 			return r.handleError(instance, ctrl.Result{}, err, state, 0)
@@ -139,6 +154,19 @@ func (r *ReconcileSFServiceInstance) Reconcile(ctx context.Context, req ctrl.Req
 			return r.handleError(instance, ctrl.Result{}, err, state, 0)
 		}
 	} else if state == "in_queue" || state == "update" {
+		preHook, postHook := osbv1alpha1.PreProvisionAction, osbv1alpha1.PostProvisionAction
+		if state == "update" {
+			preHook, postHook = osbv1alpha1.PreUpdateAction, osbv1alpha1.PostUpdateAction
+		}
+		err = r.runHook(instance, preHook)
+		if errors.HookPending(err) {
+			return operation.WaitForHook(r.Log, instance, err, state)
+		}
+		if err != nil {
+			log.Error(err, "Pre hook failed", "hook", preHook)
+			return r.handleError(instance, ctrl.Result{}, err, state, 0)
+		}
+
 		expectedResources, err := r.resourceManager.ComputeExpectedResources(r, instanceID, bindingID, serviceID, planID, osbv1alpha1.ProvisionAction, instance.GetNamespace())
 		if err != nil {
 			return r.handleError(instance, ctrl.Result{}, err, state, 0)
@@ -149,11 +177,35 @@ func (r *ReconcileSFServiceInstance) Reconcile(ctx context.Context, req ctrl.Req
 			return r.handleError(instance, ctrl.Result{}, err, state, 0)
 		}
 
+		err = operation.Validate(r.validator, expectedResources)
+		if err != nil {
+			log.Error(err, "Validation of expected resources failed")
+			return r.handleError(instance, ctrl.Result{}, err, state, 0)
+		}
+
 		resourceRefs, err := r.resourceManager.ReconcileResources(r, expectedResources, instance.Status.Resources, false)
+		if errors.WaveNotReady(err) {
+			return r.waitForWave(instance, resourceRefs, err, state)
+		}
 		if err != nil {
 			log.Error(err, "ReconcileResources failed")
 			return r.handleError(instance, ctrl.Result{}, err, state, 0)
 		}
+
+		err = r.runHook(instance, postHook)
+		if err != nil {
+			// Record the reconciled resources while waiting for the hook
+			// and before failing
+			if setErr := operation.SetResources(r, r.Log, instance, resourceRefs, 0); setErr != nil {
+				return r.handleError(instance, ctrl.Result{}, setErr, state, 0)
+			}
+			if errors.HookPending(err) {
+				return operation.WaitForHook(r.Log, instance, err, state)
+			}
+			log.Error(err, "Post hook failed", "hook", postHook)
+			return r.handleError(instance, ctrl.Result{}, err, state, 0)
+		}
+
 		err = r.updatePlanHash(req.NamespacedName, 0)
 		if err != nil {
 			// Not throwing error
@@ -264,6 +316,8 @@ func (r *ReconcileSFServiceInstance) setInProgress(namespacedName types.Namespac
 		if state == instance.GetState() {
 			instance.SetState("in progress")
 			instance.SetLabels(labels)
+			// The hooks of the operation completed
+			operation.ClearRun(instance)
 		} else {
 			log.Info("Error while trying to set in progress. state mismatch", "state", state,
 				"currentState", instance.GetState(), "lastOperation", lastOperation)
@@ -286,6 +340,20 @@ func (r *ReconcileSFServiceInstance) setInProgress(namespacedName types.Namespac
 	return nil
 }
 
+// waitForWave requeues the instance until the wave it waits for is ready
+func (r *ReconcileSFServiceInstance) waitForWave(instance *osbv1alpha1.SFServiceInstance, resources []osbv1alpha1.Source, waveErr error, state string) (ctrl.Result, error) {
+	result, err := operation.WaitForWave(r, r.Log, instance, resources, waveErr, state)
+	if err != nil {
+		return r.handleError(instance, ctrl.Result{}, err, state, 0)
+	}
+	return result, nil
+}
+
+// runHook renders the hook template of action and runs its Jobs
+func (r *ReconcileSFServiceInstance) runHook(instance *osbv1alpha1.SFServiceInstance, action string) error {
+	return operation.RunHook(r, r.Log, r.resourceManager, r.validator, instance, action)
+}
+
 func (r *ReconcileSFServiceInstance) updateDeprovisionStatus(instance *osbv1alpha1.SFServiceInstance, retryCount int) error {
 	ctx := context.Background()
 
@@ -514,6 +582,7 @@ func (r *ReconcileSFServiceInstance) handleError(object *osbv1alpha1.SFServiceIn
 			if statusError.ErrStatus.Code == 422 {
 				log.Error(inputErr, "Encountered StatusError")
 				object.Status.State = "failed"
+				operation.ClearRun(object)
 				object.Status.Error = fmt.Sprintf("StatusError encountered for %s.\n%s", objectID, inputErr.Error())
 				causes := statusError.ErrStatus.Details.Causes
 				if len(causes) > 0 {
@@ -539,6 +608,9 @@ func (r *ReconcileSFServiceInstance) handleError(object *osbv1alpha1.SFServiceIn
 			}
 		}
 	}
+	if operation.FailRightAway(r, r.Log, object, inputErr, lastOperation) {
+		return result, nil
+	}
 	if inputErr == nil {
 		if count == 0 {
 			//No change for count
@@ -552,6 +624,7 @@ func (r *ReconcileSFServiceInstance) handleError(object *osbv1alpha1.SFServiceIn
 	if count > constants.ErrorThreshold {
 		log.Error(inputErr, "Retry threshold reached. Ignoring error")
 		object.Status.State = "failed"
+		operation.ClearRun(object)
 		object.Status.Error = fmt.Sprintf("Retry threshold reached for %s.\n%s", objectID, inputErr.Error())
 		if inputErr.Error() != "" {
 			object.Status.Description = inputErr.Error()
@@ -670,6 +743,14 @@ func (r *ReconcileSFServiceInstance) SetupWithManager(mgr ctrl.Manager) error {
 		r.resourceManager = resources.New()
 	}
 
+	if r.validator == nil {
+		validator, err := validation.New(constants.OwnClusterID, mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		r.validator = validator
+	}
+
 	if r.uncachedClient == nil {
 		uncachedClient, err := client.New(mgr.GetConfig(), client.Options{
 			Scheme: mgr.GetScheme(),
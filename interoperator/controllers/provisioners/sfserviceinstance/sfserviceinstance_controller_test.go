@@ -24,6 +24,7 @@ import (
 	"time"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/operation"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/properties"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources/mock_resources"
@@ -135,6 +136,9 @@ func TestReconcile(t *testing.T) {
 	}
 
 	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "", "service-id", "plan-id", osbv1alpha1.ProvisionAction, constants.InteroperatorNamespace).Return(expectedResources, nil).AnyTimes()
+	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "", "service-id", "plan-id", osbv1alpha1.PreProvisionAction, constants.InteroperatorNamespace).Return(expectedResources, nil).AnyTimes()
+	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "", "service-id", "plan-id", gomock.Any(), constants.InteroperatorNamespace).Return(nil, errors.NewTemplateNotFound("hook", "plan-id", nil)).AnyTimes()
+	mockResourceManager.EXPECT().RunHook(gomock.Any(), gomock.Any(), "preProvision-in_queue-1").Return(nil).MinTimes(1)
 	mockResourceManager.EXPECT().SetOwnerReference(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	mockClusterRegistry.EXPECT().GetClient("1").Return(controller, nil).AnyTimes()
 	mockResourceManager.EXPECT().ReconcileResources(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(appliedResources, err1).Times(1)
@@ -449,6 +453,71 @@ func TestReconcileSFServiceInstance_handleErrorResponse(t *testing.T) {
 			wantErr:    false,
 			wantErrMsg: "Object 'apiVersion' is missing in 'unstructured object has no version'",
 		},
+		{
+			name: "return validation errors if inputErr is ValidationError",
+			args: args{
+				object:        instance,
+				result:        reconcile.Result{},
+				inputErr:      errors.NewValidationError("ConfigMap config: .dta: field not declared in schema", nil),
+				lastOperation: "in_queue",
+				retryCount:    0,
+			},
+			want:       reconcile.Result{},
+			wantErr:    false,
+			wantErrMsg: "Invalid resources rendered: ConfigMap config: .dta: field not declared in schema",
+		},
+		{
+			name: "return conflict if inputErr is ApplyConflict",
+			args: args{
+				object:        instance,
+				result:        reconcile.Result{},
+				inputErr:      errors.NewApplyConflict("Deployment", "default/postgres", nil),
+				lastOperation: "in_queue",
+				retryCount:    0,
+			},
+			want:       reconcile.Result{},
+			wantErr:    false,
+			wantErrMsg: "Rendered resources conflict with fields owned by other controllers: apply of Deployment default/postgres conflicts with other field managers",
+		},
+		{
+			name: "return conflict if inputErr is AdoptionConflict",
+			args: args{
+				object:        instance,
+				result:        reconcile.Result{},
+				inputErr:      errors.NewAdoptionConflict("Deployment", "default/postgres", "is owned by SFServiceInstance other-instance", nil),
+				lastOperation: "in_queue",
+				retryCount:    0,
+			},
+			want:       reconcile.Result{},
+			wantErr:    false,
+			wantErrMsg: "Rendered resources conflict with existing resources: Deployment default/postgres already exists and is owned by SFServiceInstance other-instance",
+		},
+		{
+			name: "return wave failure if inputErr is WaveFailed",
+			args: args{
+				object:        instance,
+				result:        reconcile.Result{},
+				inputErr:      errors.NewWaveFailed(1, "Job default/migrate failed", nil),
+				lastOperation: "in_queue",
+				retryCount:    0,
+			},
+			want:       reconcile.Result{},
+			wantErr:    false,
+			wantErrMsg: "Rendered resource failed: wave 1 failed. Job default/migrate failed",
+		},
+		{
+			name: "return hook failure if inputErr is HookFailed",
+			args: args{
+				object:        instance,
+				result:        reconcile.Result{},
+				inputErr:      errors.NewHookFailed("default/migrate", "BackoffLimitExceeded", nil),
+				lastOperation: "in_queue",
+				retryCount:    0,
+			},
+			want:       reconcile.Result{},
+			wantErr:    false,
+			wantErrMsg: "Lifecycle hook failed: hook job default/migrate failed. BackoffLimitExceeded",
+		},
 		{
 			name: "return default error message if inputErr is empty",
 			setup: func() {
@@ -674,6 +743,141 @@ func TestReconcileSFServiceInstance_setInProgress(t *testing.T) {
 	}
 }
 
+func TestReconcileSFServiceInstance_waitForWave(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	var instance = &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "instance-id",
+			Namespace: constants.InteroperatorNamespace,
+			Labels: map[string]string{
+				"state": "in_queue",
+			},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "in_queue",
+		},
+	}
+	var instanceKey = types.NamespacedName{Name: "instance-id", Namespace: constants.InteroperatorNamespace}
+	subResource := osbv1alpha1.Source{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Name:       "subresource",
+		Namespace:  constants.InteroperatorNamespace,
+	}
+
+	mgr, err := manager.New(cfg, manager.Options{
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	c, err = client.New(cfg, client.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	r := &ReconcileSFServiceInstance{
+		Client: c,
+		Log:    ctrlrun.Log.WithName("provisioners").WithName("instance"),
+	}
+
+	g.Expect(c.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), instance)
+
+	waveErr := errors.NewWaveNotReady(0, "Secret default/subresource not ready", nil)
+	got, err := r.waitForWave(instance, []osbv1alpha1.Source{subResource}, waveErr, "in_queue")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(got).To(gomega.Equal(reconcile.Result{RequeueAfter: constants.WaveRequeueInterval}))
+
+	// The state is kept so that the next reconcile continues with the next wave
+	g.Expect(c.Get(context.TODO(), instanceKey, instance)).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.GetState()).To(gomega.Equal("in_queue"))
+	g.Expect(instance.Status.Resources).To(gomega.Equal([]osbv1alpha1.Source{subResource}))
+}
+
+func TestReconcileSFServiceInstance_runHook(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var instance = &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "instance-id",
+			Namespace: constants.InteroperatorNamespace,
+			Labels: map[string]string{
+				"state": "in_queue",
+			},
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "in_queue",
+		},
+	}
+	var instanceKey = types.NamespacedName{Name: "instance-id", Namespace: constants.InteroperatorNamespace}
+	subResource := osbv1alpha1.Source{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Name:       "subresource",
+		Namespace:  constants.InteroperatorNamespace,
+	}
+
+	mgr, err := manager.New(cfg, manager.Options{
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	c, err = client.New(cfg, client.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	mockResourceManager := mock_resources.NewMockResourceManager(ctrl)
+	r := &ReconcileSFServiceInstance{
+		Client:          c,
+		Log:             ctrlrun.Log.WithName("provisioners").WithName("instance"),
+		resourceManager: mockResourceManager,
+	}
+
+	g.Expect(c.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), instance)
+
+	hookResources := []*unstructured.Unstructured{{}}
+	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "", "service-id", "plan-id",
+		osbv1alpha1.PostProvisionAction, constants.InteroperatorNamespace).Return(hookResources, nil).Times(3)
+	mockResourceManager.EXPECT().SetOwnerReference(gomock.Any(), hookResources, gomock.Any()).Return(nil).Times(3)
+	hookErr := errors.NewHookPending("default/migrate", nil)
+	gomock.InOrder(
+		mockResourceManager.EXPECT().RunHook(gomock.Any(), hookResources, "postProvision-in_queue-1").Return(hookErr).Times(2),
+		mockResourceManager.EXPECT().RunHook(gomock.Any(), hookResources, "postProvision-in_queue-4").Return(nil),
+	)
+
+	err = r.runHook(instance, osbv1alpha1.PostProvisionAction)
+	g.Expect(errors.HookPending(err)).To(gomega.BeTrue())
+
+	// Status updates while the hook is pending keep its run
+	g.Expect(operation.SetResources(c, r.Log, instance, []osbv1alpha1.Source{subResource}, 0)).NotTo(gomega.HaveOccurred())
+	g.Expect(c.Get(context.TODO(), instanceKey, instance)).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.GetGeneration()).To(gomega.BeNumerically(">", 1))
+	err = r.runHook(instance, osbv1alpha1.PostProvisionAction)
+	g.Expect(errors.HookPending(err)).To(gomega.BeTrue())
+
+	// The next operation runs the hook again
+	g.Expect(r.setInProgress(instanceKey, "in_queue", nil, 0)).NotTo(gomega.HaveOccurred())
+	g.Expect(c.Get(context.TODO(), instanceKey, instance)).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.GetAnnotations()).NotTo(gomega.HaveKey(constants.OperationRunKey))
+	instance.SetState("in_queue")
+	g.Expect(c.Update(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.GetGeneration()).To(gomega.Equal(int64(4)))
+	g.Expect(r.runHook(instance, osbv1alpha1.PostProvisionAction)).NotTo(gomega.HaveOccurred())
+}
+
 func TestReconcileSFServiceInstance_updatePlanHash(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	ctrl := gomock.NewController(t)
@@ -20,12 +20,11 @@ import (
 	"context"
 	"fmt"
 	"math"
-	"strings"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	resourcev1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/resource/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
-	rendererFactory "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/factory"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/cluster/registry"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
@@ -154,7 +153,7 @@ func (r *SFLabelSelectorScheduler) getSchedulingInfo(instance *osbv1alpha1.SFSer
 		return "", nil, err
 	}
 
-	labelSelector, err := r.getLabelSelectorString(instance, plan)
+	labelSelector, err := resources.ComputeClusterSelector(r, instance, plan)
 	if err != nil {
 		return "", nil, err
 	}
@@ -172,60 +171,6 @@ func (r *SFLabelSelectorScheduler) getSchedulingInfo(instance *osbv1alpha1.SFSer
 	return labelSelector, schedulerContext.Requests, nil
 }
 
-func (r *SFLabelSelectorScheduler) getLabelSelectorString(sfServiceInstance *osbv1alpha1.SFServiceInstance, plan *osbv1alpha1.SFPlan) (string, error) {
-	log := r.Log.WithValues("instance", sfServiceInstance.GetName())
-	ctx := context.Background()
-
-	sfNamespace := constants.InteroperatorNamespace
-	service := &osbv1alpha1.SFService{}
-	namespacedName := types.NamespacedName{
-		Name:      sfServiceInstance.Spec.ServiceID,
-		Namespace: sfNamespace,
-	}
-	err := r.Get(ctx, namespacedName, service)
-	if err != nil {
-		return "", err
-	}
-
-	labelSelectorTemplate, err := plan.GetTemplate(osbv1alpha1.ClusterLabelSelectorAction)
-	if err != nil {
-		if errors.TemplateNotFound(err) {
-			log.Info("Plan does not have clusterSelector template", "Plan", sfServiceInstance.Spec.PlanID)
-			// don't return error here. In cases when clusterSelector is not provided, scheduling should happen with least utilized cluster strategy
-			return "", nil
-		}
-		return "", err
-	}
-
-	if labelSelectorTemplate.Type != constants.GoTemplateType {
-		log.Info("Plan does not have clusterSelector gotemplate", "Plan", sfServiceInstance.Spec.PlanID)
-		// don't return error here. In cases when clusterSelector is not of gotemplate, scheduling should happen with least utilized cluster strategy
-		return "", nil
-	}
-
-	renderer, err := rendererFactory.GetRenderer(labelSelectorTemplate.Type, nil)
-	if err != nil {
-		return "", err
-	}
-	name := types.NamespacedName{
-		Namespace: sfServiceInstance.GetNamespace(),
-		Name:      sfServiceInstance.GetName(),
-	}
-	rendererInput, err := rendererFactory.GetRendererInput(labelSelectorTemplate, service, plan, sfServiceInstance, nil, name)
-	if err != nil {
-		return "", err
-	}
-	rendererOutput, err := renderer.Render(rendererInput)
-	if err != nil {
-		return "", err
-	}
-	labelSelector, err := rendererOutput.FileContent("main")
-	if err != nil {
-		return "", err
-	}
-	return strings.TrimSuffix(labelSelector, "\n"), nil
-}
-
 func (r *SFLabelSelectorScheduler) schedule(sfServiceInstance *osbv1alpha1.SFServiceInstance, labelSelector string,
 	requests corev1.ResourceList) (string, error) {
 
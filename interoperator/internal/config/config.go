@@ -30,10 +30,77 @@ type InteroperatorConfig struct {
 	PrimaryClusterID         string `yaml:"primaryClusterId,omitempty"`
 	ClusterReconcileInterval string `yaml:"clusterReconcileInterval,omitempty"`
 
+	HelmChartCacheDir     string `yaml:"helmChartCacheDir,omitempty"`
+	HelmChartCacheTTL     string `yaml:"helmChartCacheTTL,omitempty"`
+	HelmChartCacheMaxSize string `yaml:"helmChartCacheMaxSize,omitempty"`
+
+	// LookupAllowList is the list of kinds which templates can read from
+	// the namespace of the instance using the lookup function
+	LookupAllowList []osbv1alpha1.APIVersionKind `yaml:"lookupAllowList,omitempty"`
+
+	// SecretGeneratorKeySecret is the name of the secret holding the master
+	// key from which the secrets generated in templates are derived
+	SecretGeneratorKeySecret string `yaml:"secretGeneratorKeySecret,omitempty"`
+
+	// TemplateFunctionPolicies restricts the functions available to the
+	// gotemplates of each renderer type, keyed by the renderer type
+	TemplateFunctionPolicies map[string]TemplateFunctionPolicy `yaml:"templateFunctionPolicies,omitempty"`
+	TemplateTimeout          string                            `yaml:"templateTimeout,omitempty"`
+	TemplateMaxOutputSize    string                            `yaml:"templateMaxOutputSize,omitempty"`
+
+	// TemplateLocalRoot is the directory below which helm and kustomize
+	// templates can refer to local charts and bases. Local files are not
+	// available if it is empty.
+	TemplateLocalRoot string `yaml:"templateLocalRoot,omitempty"`
+
+	// RenderCacheSize is the number of rendered templates cached in memory
+	RenderCacheSize    int  `yaml:"renderCacheSize,omitempty"`
+	DisableRenderCache bool `yaml:"disableRenderCache,omitempty"`
+
+	// RendererPlugins are the external renderers, keyed by the renderer
+	// type used in the templates
+	RendererPlugins map[string]RendererPlugin `yaml:"rendererPlugins,omitempty"`
+
+	// DeleteStrategies configure how the sub resources of each kind are
+	// deleted. The first strategy matching a resource is used.
+	DeleteStrategies []DeleteStrategy `yaml:"deleteStrategies,omitempty"`
+
+	// DriftDetectionInterval is the interval at which the resources of
+	// succeeded instances are compared with their rendered resources
+	DriftDetectionInterval string `yaml:"driftDetectionInterval,omitempty"`
+
 	InstanceContollerWatchList []osbv1alpha1.APIVersionKind `yaml:"instanceContollerWatchList,omitempty"`
 	BindingContollerWatchList  []osbv1alpha1.APIVersionKind `yaml:"bindingContollerWatchList,omitempty"`
 }
 
+// TemplateFunctionPolicy lists the gotemplate functions allowed or denied
+// for a renderer type. If AllowList is set, only those functions are allowed.
+type TemplateFunctionPolicy struct {
+	AllowList []string `yaml:"allowList,omitempty"`
+	DenyList  []string `yaml:"denyList,omitempty"`
+}
+
+// RendererPlugin is an external renderer which is either executed as
+// Command or called on the unix Socket. Exactly one of them must be set.
+type RendererPlugin struct {
+	Command []string `yaml:"command,omitempty"`
+	Socket  string   `yaml:"socket,omitempty"`
+}
+
+// DeleteStrategy is the strategy used to delete the sub resources of a
+// kind. If Kind is empty, it applies to all kinds of the APIVersion.
+// Strategy is one of delete, background, foreground, orphan, statusField
+// and annotation. Field and Annotation name the field or annotation set
+// to Value by the statusField and annotation strategies.
+type DeleteStrategy struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind,omitempty"`
+	Strategy   string `yaml:"strategy"`
+	Field      string `yaml:"field,omitempty"`
+	Annotation string `yaml:"annotation,omitempty"`
+	Value      string `yaml:"value,omitempty"`
+}
+
 // setConfigDefaults assigns default values to config
 func setConfigDefaults(interoperatorConfig *InteroperatorConfig) *InteroperatorConfig {
 	if interoperatorConfig.BindingWorkerCount == 0 {
@@ -54,6 +121,27 @@ func setConfigDefaults(interoperatorConfig *InteroperatorConfig) *InteroperatorC
 	if interoperatorConfig.ClusterReconcileInterval == "" {
 		interoperatorConfig.ClusterReconcileInterval = constants.DefaultClusterReconcileInterval
 	}
+	if interoperatorConfig.HelmChartCacheTTL == "" {
+		interoperatorConfig.HelmChartCacheTTL = constants.DefaultHelmChartCacheTTL
+	}
+	if interoperatorConfig.HelmChartCacheMaxSize == "" {
+		interoperatorConfig.HelmChartCacheMaxSize = constants.DefaultHelmChartCacheMaxSize
+	}
+	if interoperatorConfig.SecretGeneratorKeySecret == "" {
+		interoperatorConfig.SecretGeneratorKeySecret = constants.DefaultSecretGeneratorKeySecret
+	}
+	if interoperatorConfig.TemplateTimeout == "" {
+		interoperatorConfig.TemplateTimeout = constants.DefaultTemplateTimeout
+	}
+	if interoperatorConfig.TemplateMaxOutputSize == "" {
+		interoperatorConfig.TemplateMaxOutputSize = constants.DefaultTemplateMaxOutputSize
+	}
+	if interoperatorConfig.RenderCacheSize == 0 {
+		interoperatorConfig.RenderCacheSize = constants.DefaultRenderCacheSize
+	}
+	if interoperatorConfig.DriftDetectionInterval == "" {
+		interoperatorConfig.DriftDetectionInterval = constants.DefaultDriftDetectionInterval
+	}
 
 	return interoperatorConfig
 }
@@ -150,6 +150,13 @@ instanceContollerWatchList:
 		ProvisionerWorkerCount:   constants.DefaultProvisionerWorkerCount,
 		PrimaryClusterID:         "1",
 		ClusterReconcileInterval: "17m",
+		HelmChartCacheTTL:        constants.DefaultHelmChartCacheTTL,
+		HelmChartCacheMaxSize:    constants.DefaultHelmChartCacheMaxSize,
+		SecretGeneratorKeySecret: constants.DefaultSecretGeneratorKeySecret,
+		TemplateTimeout:          constants.DefaultTemplateTimeout,
+		TemplateMaxOutputSize:    constants.DefaultTemplateMaxOutputSize,
+		RenderCacheSize:          constants.DefaultRenderCacheSize,
+		DriftDetectionInterval:   constants.DefaultDriftDetectionInterval,
 		InstanceContollerWatchList: []osbv1alpha1.APIVersionKind{
 			{
 				APIVersion: "kubedb.com/v1alpha1",
@@ -0,0 +1,286 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package operation implements the steps shared by the operations of service
+// instances and bindings, like running their hooks and waiting for the waves
+// of their resources.
+package operation
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/validation"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Object is a SFServiceInstance or a SFServiceBinding
+type Object interface {
+	client.Object
+	GetState() string
+}
+
+// RunHook renders the hook template of action for object and runs its Jobs.
+// Plans without the hook template have nothing to run. The hook runs once
+// for each operation of object.
+func RunHook(c client.Client, log logr.Logger, resourceManager resources.ResourceManager, validator validation.Validator,
+	object Object, action string) error {
+	serviceID, planID, instanceID, bindingID := ids(object)
+
+	hookResources, err := resourceManager.ComputeExpectedResources(c, instanceID, bindingID, serviceID, planID, action, object.GetNamespace())
+	if errors.TemplateNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = resourceManager.SetOwnerReference(object, hookResources, c.Scheme())
+	if err != nil {
+		return err
+	}
+	err = Validate(validator, hookResources)
+	if err != nil {
+		return err
+	}
+	run, err := operationRun(c, log, object, 0)
+	if err != nil {
+		return err
+	}
+	return resourceManager.RunHook(c, hookResources, fmt.Sprintf("%s-%s", action, run))
+}
+
+// Validate validates resources against the schema of the cluster. Without a
+// validator the resources are left to the api server.
+func Validate(validator validation.Validator, resources []*unstructured.Unstructured) error {
+	if validator == nil {
+		return nil
+	}
+	return validator.Validate(resources)
+}
+
+// operationRun returns the run of the current operation of object, which
+// keys the runs of its hooks. The run is recorded on object when its first
+// hook runs and is removed once the operation completes or fails. Unlike the
+// generation, it does not change with the status updates during the
+// operation.
+func operationRun(c client.Client, logger logr.Logger, object Object, retryCount int) (string, error) {
+	ctx := context.Background()
+	namespacedName := types.NamespacedName{
+		Name:      object.GetName(),
+		Namespace: object.GetNamespace(),
+	}
+	log := logger.WithValues("objectID", namespacedName.Name, "function", "operationRun")
+
+	current := object.DeepCopyObject().(Object)
+	err := c.Get(ctx, namespacedName, current)
+	if err != nil {
+		if retryCount < constants.ErrorThreshold {
+			log.Info("Retrying", "retryCount", retryCount+1)
+			return operationRun(c, logger, object, retryCount+1)
+		}
+		log.Error(err, "Fetching operation run failed")
+		return "", err
+	}
+
+	annotations := current.GetAnnotations()
+	if run, ok := annotations[constants.OperationRunKey]; ok {
+		return run, nil
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	run := fmt.Sprintf("%s-%d", current.GetState(), current.GetGeneration())
+	annotations[constants.OperationRunKey] = run
+	current.SetAnnotations(annotations)
+	err = c.Update(ctx, current)
+	if err != nil {
+		if retryCount < constants.ErrorThreshold {
+			log.Info("Retrying", "retryCount", retryCount+1)
+			return operationRun(c, logger, object, retryCount+1)
+		}
+		log.Error(err, "Recording operation run failed")
+		return "", err
+	}
+	log.Info("Recorded operation run", "run", run)
+	return run, nil
+}
+
+// ClearRun removes the run of the current operation from object, so that
+// the hooks of the next operation run again
+func ClearRun(object metav1.Object) {
+	annotations := object.GetAnnotations()
+	if _, ok := annotations[constants.OperationRunKey]; ok {
+		delete(annotations, constants.OperationRunKey)
+		object.SetAnnotations(annotations)
+	}
+}
+
+// WaitForHook requeues object until the hook Jobs completed. The state is
+// kept, so that the next reconcile continues the operation.
+func WaitForHook(log logr.Logger, object Object, hookErr error, state string) (ctrl.Result, error) {
+	log = log.WithValues("objectID", object.GetName(), "function", "waitForHook")
+	log.Info("Waiting for hook", "state", state, "reason", hookErr.Error())
+	return ctrl.Result{RequeueAfter: constants.HookRequeueInterval}, nil
+}
+
+// WaitForWave records the resources reconciled so far and requeues object
+// until the wave it waits for is ready. The state is kept, so that the next
+// reconcile continues with the remaining waves. The error is the one of
+// recording the resources.
+func WaitForWave(c client.Client, log logr.Logger, object Object, resources []osbv1alpha1.Source, waveErr error, state string) (ctrl.Result, error) {
+	log.WithValues("objectID", object.GetName(), "function", "waitForWave").
+		Info("Waiting for wave", "state", state, "reason", waveErr.Error())
+
+	err := SetResources(c, log, object, resources, 0)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: constants.WaveRequeueInterval}, nil
+}
+
+// SetResources records resources in the status of object
+func SetResources(c client.Client, logger logr.Logger, object Object, resources []osbv1alpha1.Source, retryCount int) error {
+	ctx := context.Background()
+	namespacedName := types.NamespacedName{
+		Name:      object.GetName(),
+		Namespace: object.GetNamespace(),
+	}
+	log := logger.WithValues("objectID", namespacedName.Name, "function", "setResources")
+
+	current := object.DeepCopyObject().(Object)
+	err := c.Get(ctx, namespacedName, current)
+	if err != nil {
+		if retryCount < constants.ErrorThreshold {
+			log.Info("Retrying", "retryCount", retryCount+1)
+			return SetResources(c, logger, object, resources, retryCount+1)
+		}
+		log.Error(err, "Updating resources failed")
+		return err
+	}
+
+	status := statusResources(current)
+	if reflect.DeepEqual(*status, resources) {
+		return nil
+	}
+	*status = resources
+	err = c.Update(ctx, current)
+	if err != nil {
+		if retryCount < constants.ErrorThreshold {
+			log.Info("Retrying", "retryCount", retryCount+1)
+			return SetResources(c, logger, object, resources, retryCount+1)
+		}
+		log.Error(err, "Updating resources failed")
+		return err
+	}
+	log.Info("Updated resources")
+	return nil
+}
+
+// failRightAwayErrors holds the prefixes of the descriptions of objects failed
+// by errors which retrying does not fix, keyed by the error code
+var failRightAwayErrors = map[errors.ErrorCodeType]string{
+	// Rendering again does not fix invalid resources
+	errors.CodeValidationError: "Invalid resources rendered",
+	// The conflicting fields stay owned by the other field managers until
+	// they are released
+	errors.CodeApplyConflict: "Rendered resources conflict with fields owned by other controllers",
+	// The existing resources stay with their owners until they are released
+	// or annotated for adoption
+	errors.CodeAdoptionConflict: "Rendered resources conflict with existing resources",
+	// The next waves wait for the failed resource forever
+	errors.CodeWaveFailed: "Rendered resource failed",
+	// Running the hook again fails the same way
+	errors.CodeHookFailed: "Lifecycle hook failed",
+}
+
+// FailRightAway sets the state of object to failed without retrying if
+// inputErr is not fixed by retrying. It returns whether object was failed.
+func FailRightAway(c client.Client, log logr.Logger, object Object, inputErr error, lastOperation string) bool {
+	code := errors.ErrorCode(inputErr)
+	description, ok := failRightAwayErrors[code]
+	if !ok {
+		return false
+	}
+	objectID := object.GetName()
+	log = log.WithValues("objectID", objectID, "function", "failRightAway")
+
+	log.Error(inputErr, fmt.Sprintf("Encountered %s", code))
+	setFailed(object, fmt.Sprintf("%s encountered for %s.\n%s", code, objectID, inputErr.Error()),
+		fmt.Sprintf("%s: %s", description, inputErr.Error()))
+	ClearRun(object)
+	if lastOperation != "" {
+		labels := object.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[constants.LastOperationKey] = lastOperation
+		object.SetLabels(labels)
+	}
+	err := c.Update(context.Background(), object)
+	if err != nil {
+		log.Error(err, "Failed to set state to failed")
+	}
+	return true
+}
+
+// ids returns the service, plan, instance and binding ids of object. The
+// binding id of an instance is empty.
+func ids(object Object) (serviceID, planID, instanceID, bindingID string) {
+	switch o := object.(type) {
+	case *osbv1alpha1.SFServiceInstance:
+		return o.Spec.ServiceID, o.Spec.PlanID, o.GetName(), ""
+	case *osbv1alpha1.SFServiceBinding:
+		return o.Spec.ServiceID, o.Spec.PlanID, o.Spec.InstanceID, o.GetName()
+	}
+	return "", "", "", ""
+}
+
+// statusResources returns the resources in the status of object
+func statusResources(object Object) *[]osbv1alpha1.Source {
+	switch o := object.(type) {
+	case *osbv1alpha1.SFServiceInstance:
+		return &o.Status.Resources
+	case *osbv1alpha1.SFServiceBinding:
+		return &o.Status.Resources
+	}
+	return &[]osbv1alpha1.Source{}
+}
+
+// setFailed sets the state of object to failed with the error and the
+// description reported to the broker
+func setFailed(object Object, errorMessage, description string) {
+	switch o := object.(type) {
+	case *osbv1alpha1.SFServiceInstance:
+		o.Status.State = "failed"
+		o.Status.Error = errorMessage
+		o.Status.Description = description
+	case *osbv1alpha1.SFServiceBinding:
+		o.Status.State = "failed"
+		o.Status.Error = errorMessage
+		o.Status.Description = description
+	}
+}
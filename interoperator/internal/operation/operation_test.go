@@ -0,0 +1,194 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operation
+
+import (
+	"context"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources/mock_resources"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlrun "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var log = ctrlrun.Log.WithName("operation")
+
+var subResource = osbv1alpha1.Source{
+	APIVersion: "v1",
+	Kind:       "Secret",
+	Name:       "subresource",
+	Namespace:  constants.InteroperatorNamespace,
+}
+
+func newClient(g *gomega.WithT, objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	g.Expect(osbv1alpha1.AddToScheme(scheme)).NotTo(gomega.HaveOccurred())
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+func TestRunHook(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instance := &osbv1alpha1.SFServiceInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "instance-id",
+			Namespace:  constants.InteroperatorNamespace,
+			Generation: 1,
+		},
+		Spec: osbv1alpha1.SFServiceInstanceSpec{
+			ServiceID: "service-id",
+			PlanID:    "plan-id",
+		},
+		Status: osbv1alpha1.SFServiceInstanceStatus{
+			State: "in_queue",
+		},
+	}
+	instanceKey := types.NamespacedName{Name: "instance-id", Namespace: constants.InteroperatorNamespace}
+	c := newClient(g, instance)
+
+	mockResourceManager := mock_resources.NewMockResourceManager(ctrl)
+	hookResources := []*unstructured.Unstructured{{}}
+	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "", "service-id", "plan-id",
+		osbv1alpha1.PostProvisionAction, constants.InteroperatorNamespace).Return(hookResources, nil).Times(3)
+	mockResourceManager.EXPECT().SetOwnerReference(gomock.Any(), hookResources, gomock.Any()).Return(nil).Times(3)
+	hookErr := errors.NewHookPending("default/migrate", nil)
+	gomock.InOrder(
+		mockResourceManager.EXPECT().RunHook(gomock.Any(), hookResources, "postProvision-in_queue-1").Return(hookErr).Times(2),
+		mockResourceManager.EXPECT().RunHook(gomock.Any(), hookResources, "postProvision-update-2").Return(nil),
+	)
+
+	err := RunHook(c, log, mockResourceManager, nil, instance, osbv1alpha1.PostProvisionAction)
+	g.Expect(errors.HookPending(err)).To(gomega.BeTrue())
+
+	// Status updates while the hook is pending keep its run
+	g.Expect(SetResources(c, log, instance, []osbv1alpha1.Source{subResource}, 0)).NotTo(gomega.HaveOccurred())
+	err = RunHook(c, log, mockResourceManager, nil, instance, osbv1alpha1.PostProvisionAction)
+	g.Expect(errors.HookPending(err)).To(gomega.BeTrue())
+
+	// The next operation runs the hook again
+	g.Expect(c.Get(context.TODO(), instanceKey, instance)).NotTo(gomega.HaveOccurred())
+	ClearRun(instance)
+	instance.SetState("update")
+	instance.SetGeneration(2)
+	g.Expect(c.Update(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+	g.Expect(RunHook(c, log, mockResourceManager, nil, instance, osbv1alpha1.PostProvisionAction)).NotTo(gomega.HaveOccurred())
+}
+
+func TestRunHook_binding(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	binding := &osbv1alpha1.SFServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "binding-id",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Spec: osbv1alpha1.SFServiceBindingSpec{
+			ServiceID:  "service-id",
+			PlanID:     "plan-id",
+			InstanceID: "instance-id",
+		},
+		Status: osbv1alpha1.SFServiceBindingStatus{
+			State: "in_queue",
+		},
+	}
+	c := newClient(g, binding)
+
+	mockResourceManager := mock_resources.NewMockResourceManager(ctrl)
+	mockResourceManager.EXPECT().ComputeExpectedResources(gomock.Any(), "instance-id", "binding-id", "service-id", "plan-id",
+		osbv1alpha1.PostBindAction, constants.InteroperatorNamespace).Return(nil, errors.NewTemplateNotFound("postBind", "plan-id", nil))
+
+	// Plans without the hook template have nothing to run
+	g.Expect(RunHook(c, log, mockResourceManager, nil, binding, osbv1alpha1.PostBindAction)).NotTo(gomega.HaveOccurred())
+}
+
+func TestWaitForWave(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	binding := &osbv1alpha1.SFServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "binding-id",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Status: osbv1alpha1.SFServiceBindingStatus{
+			State: "in_queue",
+		},
+	}
+	bindingKey := types.NamespacedName{Name: "binding-id", Namespace: constants.InteroperatorNamespace}
+	c := newClient(g, binding)
+
+	waveErr := errors.NewWaveNotReady(0, "Secret default/subresource not ready", nil)
+	got, err := WaitForWave(c, log, binding, []osbv1alpha1.Source{subResource}, waveErr, "in_queue")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(got).To(gomega.Equal(ctrlrun.Result{RequeueAfter: constants.WaveRequeueInterval}))
+
+	// The state is kept so that the next reconcile continues with the next wave
+	g.Expect(c.Get(context.TODO(), bindingKey, binding)).NotTo(gomega.HaveOccurred())
+	g.Expect(binding.GetState()).To(gomega.Equal("in_queue"))
+	g.Expect(binding.Status.Resources).To(gomega.Equal([]osbv1alpha1.Source{subResource}))
+
+	// Failing to record the resources fails the wait
+	binding.SetName("other-binding-id")
+	_, err = WaitForWave(c, log, binding, []osbv1alpha1.Source{subResource}, waveErr, "in_queue")
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestFailRightAway(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	binding := &osbv1alpha1.SFServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "binding-id",
+			Namespace:   constants.InteroperatorNamespace,
+			Annotations: map[string]string{constants.OperationRunKey: "in_queue-1"},
+		},
+		Status: osbv1alpha1.SFServiceBindingStatus{
+			State: "in_queue",
+		},
+	}
+	bindingKey := types.NamespacedName{Name: "binding-id", Namespace: constants.InteroperatorNamespace}
+	c := newClient(g, binding)
+
+	// Errors which retrying may fix are left to the retries
+	g.Expect(FailRightAway(c, log, binding, errors.NewMarshalError("", nil), "in_queue")).To(gomega.BeFalse())
+	g.Expect(binding.GetState()).To(gomega.Equal("in_queue"))
+
+	inputErr := errors.NewApplyConflict("Secret", "default/credentials", nil)
+	g.Expect(FailRightAway(c, log, binding, inputErr, "in_queue")).To(gomega.BeTrue())
+
+	g.Expect(c.Get(context.TODO(), bindingKey, binding)).NotTo(gomega.HaveOccurred())
+	g.Expect(binding.GetState()).To(gomega.Equal("failed"))
+	g.Expect(binding.Status.Error).To(gomega.Equal("ApplyConflict encountered for binding-id.\n" + inputErr.Error()))
+	g.Expect(binding.Status.Description).To(gomega.Equal(
+		"Rendered resources conflict with fields owned by other controllers: " + inputErr.Error()))
+	g.Expect(binding.GetLabels()).To(gomega.HaveKeyWithValue(constants.LastOperationKey, "in_queue"))
+	g.Expect(binding.GetAnnotations()).NotTo(gomega.HaveKey(constants.OperationRunKey))
+}
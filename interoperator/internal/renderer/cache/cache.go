@@ -0,0 +1,233 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cache implements an in memory cache of rendered templates. As
+// long as the template and its values do not change, the output of a render
+// is served from the cache instead of rendering the template again.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	renderCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name:      "cache_hits_total",
+			Namespace: "interoperator",
+			Subsystem: "render",
+			Help:      "Number of renders served from the render cache",
+		},
+	)
+	renderCacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name:      "cache_misses_total",
+			Namespace: "interoperator",
+			Subsystem: "render",
+			Help:      "Number of renders not found in the render cache",
+		},
+	)
+	renderCacheEvictions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name:      "cache_evictions_total",
+			Namespace: "interoperator",
+			Subsystem: "render",
+			Help:      "Number of renders evicted from the render cache",
+		},
+	)
+	renderCacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:      "cache_entries",
+			Namespace: "interoperator",
+			Subsystem: "render",
+			Help:      "Number of renders in the render cache",
+		},
+	)
+
+	// renders is the cache shared across all the renderers
+	renders = newRenderCache(constants.DefaultRenderCacheSize)
+)
+
+func init() {
+	metrics.Registry.MustRegister(renderCacheHits, renderCacheMisses, renderCacheEvictions, renderCacheEntries)
+}
+
+// Configure sets the number of renders kept in the cache. A size less than
+// or equal to zero disables the cache.
+func Configure(size int) {
+	renders.resize(size)
+}
+
+// Key returns the key of the render of template with values. The key is the
+// sha256 digest of the template, which includes the renderer type, the name
+// of the render, the values and the content of the template libraries used
+// by the template. Metadata changing on every update of an object, like the
+// resourceVersion and managedFields, is not part of the key. The status of
+// the objects is, as templates may depend on it.
+func Key(template *osbv1alpha1.TemplateSpec, name types.NamespacedName, values map[string]interface{},
+	libraries []map[string]string) (string, error) {
+	data, err := json.Marshal(struct {
+		Template  *osbv1alpha1.TemplateSpec `json:"template"`
+		Name      types.NamespacedName      `json:"name"`
+		Values    map[string]interface{}    `json:"values"`
+		Libraries []map[string]string       `json:"libraries,omitempty"`
+	}{
+		Template:  template,
+		Name:      name,
+		Values:    keyValues(values),
+		Libraries: libraries,
+	})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// keyValues returns a copy of values without the volatile fields of the
+// objects. values is not modified.
+func keyValues(values map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			result[key] = value
+			continue
+		}
+		stripped := make(map[string]interface{}, len(object))
+		for field, fieldValue := range object {
+			stripped[field] = fieldValue
+		}
+		if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+			strippedMetadata := make(map[string]interface{}, len(metadata))
+			for field, fieldValue := range metadata {
+				if field != "resourceVersion" && field != "managedFields" {
+					strippedMetadata[field] = fieldValue
+				}
+			}
+			stripped["metadata"] = strippedMetadata
+		}
+		result[key] = stripped
+	}
+	return result
+}
+
+// Get returns the cached output for key
+func Get(key string) (renderer.Output, bool) {
+	if !renders.enabled() {
+		return nil, false
+	}
+	output, ok := renders.get(key)
+	if ok {
+		renderCacheHits.Inc()
+	} else {
+		renderCacheMisses.Inc()
+	}
+	return output, ok
+}
+
+// Add caches output for key. Volatile outputs are not cached as they depend
+// on more than the template and its values.
+func Add(key string, output renderer.Output) {
+	if renderer.IsVolatile(output) {
+		return
+	}
+	renders.add(key, output)
+}
+
+type entry struct {
+	key    string
+	output renderer.Output
+}
+
+// renderCache is a least recently used cache of the rendered outputs
+type renderCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newRenderCache(size int) *renderCache {
+	return &renderCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *renderCache) get(key string) (renderer.Output, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*entry).output, true
+}
+
+func (c *renderCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size > 0
+}
+
+func (c *renderCache) add(key string, output renderer.Output) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*entry).output = output
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, output: output})
+	c.evict()
+}
+
+func (c *renderCache) resize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.evict()
+}
+
+// evict removes the least recently used entries until the cache is within
+// its size. Must be called with the lock held.
+func (c *renderCache) evict() {
+	for c.order.Len() > 0 && c.order.Len() > c.size {
+		element := c.order.Back()
+		c.order.Remove(element)
+		delete(c.entries, element.Value.(*entry).key)
+		renderCacheEvictions.Inc()
+	}
+	renderCacheEntries.Set(float64(c.order.Len()))
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type testOutput struct {
+	content string
+}
+
+func (o *testOutput) FileContent(filename string) (string, error) {
+	return o.content, nil
+}
+
+func (o *testOutput) ListFiles() ([]string, error) {
+	return []string{"main"}, nil
+}
+
+func TestKey(t *testing.T) {
+	template := &osbv1alpha1.TemplateSpec{
+		Action:  osbv1alpha1.ProvisionAction,
+		Type:    "gotemplate",
+		Content: "{{ .instance.metadata.name }}",
+	}
+	name := types.NamespacedName{Name: "instance", Namespace: "sf-instance"}
+	values := map[string]interface{}{
+		"instance": map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "instance", "resourceVersion": "1"},
+		},
+	}
+	libraries := []map[string]string{{"helpers.tpl": `{{ define "name" }}{{ end }}`}}
+	key, err := Key(template, name, values, libraries)
+	if err != nil {
+		t.Fatalf("Key() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		template  *osbv1alpha1.TemplateSpec
+		objName   types.NamespacedName
+		values    map[string]interface{}
+		libraries []map[string]string
+		wantSame  bool
+	}{
+		{
+			name:     "same key for same input",
+			template: template.DeepCopy(),
+			objName:  name,
+			values: map[string]interface{}{
+				"instance": map[string]interface{}{
+					"metadata": map[string]interface{}{"resourceVersion": "1", "name": "instance"},
+				},
+			},
+			wantSame: true,
+		},
+		{
+			name: "different key for other renderer type",
+			template: &osbv1alpha1.TemplateSpec{
+				Action:  osbv1alpha1.ProvisionAction,
+				Type:    "jsonnet",
+				Content: "{{ .instance.metadata.name }}",
+			},
+			objName: name,
+			values:  values,
+		},
+		{
+			name: "different key for other template",
+			template: &osbv1alpha1.TemplateSpec{
+				Action:  osbv1alpha1.ProvisionAction,
+				Type:    "gotemplate",
+				Content: "{{ .instance.metadata.uid }}",
+			},
+			objName: name,
+			values:  values,
+		},
+		{
+			name:     "different key for other name",
+			template: template,
+			objName:  types.NamespacedName{Name: "binding", Namespace: "sf-instance"},
+			values:   values,
+		},
+		{
+			name:     "different key for other values",
+			template: template,
+			objName:  name,
+			values: map[string]interface{}{
+				"instance": map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "other-instance", "resourceVersion": "1"},
+				},
+			},
+		},
+		{
+			name:     "same key for other volatile metadata",
+			template: template,
+			objName:  name,
+			values: map[string]interface{}{
+				"instance": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"name":            "instance",
+						"resourceVersion": "2",
+						"managedFields":   []interface{}{map[string]interface{}{"manager": "interoperator"}},
+					},
+				},
+			},
+			wantSame: true,
+		},
+		{
+			name:     "different key for other instance status",
+			template: template,
+			objName:  name,
+			values: map[string]interface{}{
+				"instance": map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "instance"},
+					"status":   map[string]interface{}{"state": "succeeded"},
+				},
+			},
+		},
+		{
+			name:      "different key for other library content",
+			template:  template,
+			objName:   name,
+			values:    values,
+			libraries: []map[string]string{{"helpers.tpl": `{{ define "name" }}other{{ end }}`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			libraries := tt.libraries
+			if libraries == nil {
+				libraries = []map[string]string{{"helpers.tpl": `{{ define "name" }}{{ end }}`}}
+			}
+			got, err := Key(tt.template, tt.objName, tt.values, libraries)
+			if err != nil {
+				t.Errorf("Key() error = %v", err)
+				return
+			}
+			if (got == key) != tt.wantSame {
+				t.Errorf("Key() = %v, key = %v, wantSame %v", got, key, tt.wantSame)
+			}
+		})
+	}
+}
+
+func Test_renderCache(t *testing.T) {
+	c := newRenderCache(2)
+	for i := 0; i < 3; i++ {
+		c.add(fmt.Sprintf("key-%d", i), &testOutput{content: fmt.Sprintf("output-%d", i)})
+		if i == 1 {
+			// key-0 becomes the most recently used entry
+			c.get("key-0")
+		}
+	}
+
+	if _, ok := c.get("key-1"); ok {
+		t.Errorf("renderCache.get() found key-1, want evicted")
+	}
+	for _, key := range []string{"key-0", "key-2"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("renderCache.get() did not find %s", key)
+		}
+	}
+
+	c.resize(1)
+	if got := c.order.Len(); got != 1 {
+		t.Errorf("renderCache size after resize = %d, want 1", got)
+	}
+
+	c.resize(0)
+	c.add("key-3", &testOutput{})
+	if _, ok := c.get("key-3"); ok {
+		t.Errorf("renderCache.get() found key-3 in disabled cache")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	defer func(c *renderCache) { renders = c }(renders)
+	renders = newRenderCache(10)
+
+	output := &testOutput{content: "output"}
+	Add("key", output)
+	got, ok := Get("key")
+	if !ok || got != output {
+		t.Errorf("Get() = %v, %v, want %v", got, ok, output)
+	}
+
+	Add("volatile", renderer.MarkVolatile(output))
+	if _, ok := Get("volatile"); ok {
+		t.Errorf("Get() found volatile output")
+	}
+
+	Configure(0)
+	misses := testutil.ToFloat64(renderCacheMisses)
+	if _, ok := Get("key"); ok {
+		t.Errorf("Get() found output in disabled cache")
+	}
+	if got := testutil.ToFloat64(renderCacheMisses); got != misses {
+		t.Errorf("Get() counted a miss in disabled cache")
+	}
+}
@@ -3,25 +3,133 @@ package factory
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
+	"time"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/cache"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/helm"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/jsonnet"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/kustomize"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/plugin"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-// GetRenderer returns a renderer based on the type
-func GetRenderer(rendererType string, clientSet *kubernetes.Clientset) (renderer.Renderer, error) {
+var log = logf.Log.WithName("renderer.factory")
+
+// Configure applies the renderer settings from the interoperator config.
+// Invalid values are logged and the defaults are used instead. It is called
+// once on start, so changes to the settings require a restart.
+func Configure(interoperatorCfg *config.InteroperatorConfig) {
+	if interoperatorCfg == nil {
+		return
+	}
+
+	chartCacheTTL, err := time.ParseDuration(interoperatorCfg.HelmChartCacheTTL)
+	if err != nil {
+		log.Error(err, "Failed to parse HelmChartCacheTTL",
+			"HelmChartCacheTTL", interoperatorCfg.HelmChartCacheTTL)
+		chartCacheTTL, _ = time.ParseDuration(constants.DefaultHelmChartCacheTTL)
+	}
+	chartCacheMaxSize, err := resource.ParseQuantity(interoperatorCfg.HelmChartCacheMaxSize)
+	if err != nil {
+		log.Error(err, "Failed to parse HelmChartCacheMaxSize",
+			"HelmChartCacheMaxSize", interoperatorCfg.HelmChartCacheMaxSize)
+		chartCacheMaxSize = resource.MustParse(constants.DefaultHelmChartCacheMaxSize)
+	}
+	helm.ConfigureChartCache(interoperatorCfg.HelmChartCacheDir, chartCacheTTL, chartCacheMaxSize.Value())
+	gotemplate.SetLookupAllowList(interoperatorCfg.LookupAllowList)
+	gotemplate.SetSecretGeneratorKeySecret(interoperatorCfg.SecretGeneratorKeySecret)
+
+	templateTimeout, err := time.ParseDuration(interoperatorCfg.TemplateTimeout)
+	if err != nil {
+		log.Error(err, "Failed to parse TemplateTimeout",
+			"TemplateTimeout", interoperatorCfg.TemplateTimeout)
+		templateTimeout, _ = time.ParseDuration(constants.DefaultTemplateTimeout)
+	}
+	templateMaxOutputSize, err := resource.ParseQuantity(interoperatorCfg.TemplateMaxOutputSize)
+	if err != nil {
+		log.Error(err, "Failed to parse TemplateMaxOutputSize",
+			"TemplateMaxOutputSize", interoperatorCfg.TemplateMaxOutputSize)
+		templateMaxOutputSize = resource.MustParse(constants.DefaultTemplateMaxOutputSize)
+	}
+	gotemplate.SetLimits(templateTimeout, templateMaxOutputSize.Value())
+	plugin.SetLimits(templateTimeout, templateMaxOutputSize.Value())
+	jsonnet.SetLimits(templateTimeout, templateMaxOutputSize.Value())
+	renderer.SetLocalRoot(interoperatorCfg.TemplateLocalRoot)
+
+	policies := make(map[string]gotemplate.FunctionPolicy, len(interoperatorCfg.TemplateFunctionPolicies))
+	for rendererType, policy := range interoperatorCfg.TemplateFunctionPolicies {
+		policies[strings.ToLower(rendererType)] = gotemplate.FunctionPolicy{
+			AllowList: policy.AllowList,
+			DenyList:  policy.DenyList,
+		}
+	}
+	gotemplate.SetFunctionPolicies(policies)
+
+	renderCacheSize := interoperatorCfg.RenderCacheSize
+	if interoperatorCfg.DisableRenderCache {
+		renderCacheSize = 0
+	}
+	cache.Configure(renderCacheSize)
+
+	plugins := make(map[string]plugin.Config, len(interoperatorCfg.RendererPlugins))
+	for rendererType, rendererPlugin := range interoperatorCfg.RendererPlugins {
+		if builtinRenderer(rendererType) {
+			log.Error(fmt.Errorf("renderer type %s is built in", rendererType), "Ignoring renderer plugin")
+			continue
+		}
+		if (len(rendererPlugin.Command) > 0) == (rendererPlugin.Socket != "") {
+			log.Error(fmt.Errorf("exactly one of command and socket must be set"), "Ignoring renderer plugin",
+				"rendererType", rendererType)
+			continue
+		}
+		plugins[rendererType] = plugin.Config{
+			Command: rendererPlugin.Command,
+			Socket:  rendererPlugin.Socket,
+		}
+	}
+	plugin.Register(plugins)
+}
+
+// builtinRenderer returns true if rendererType is implemented by the
+// interoperator itself
+func builtinRenderer(rendererType string) bool {
+	switch strings.ToLower(rendererType) {
+	case "helm", "gotemplate", "kustomize", "jsonnet":
+		return true
+	}
+	return false
+}
+
+// GetRenderer returns a renderer based on the type. The client is used by
+// the renderers to read additional objects like credentials secrets and
+// the objects read by the lookup template function. Types which are not
+// built in are rendered by the renderer plugin registered for them.
+func GetRenderer(rendererType string, c client.Client) (renderer.Renderer, error) {
 	switch rendererType {
 	case "helm", "Helm", "HELM":
-		return helm.New(clientSet)
+		return helm.New(c)
 	case "gotemplate", "Gotemplate", "GoTemplate", "GOTEMPLATE":
-		return gotemplate.New()
+		return gotemplate.New(c)
+	case "kustomize", "Kustomize", "KUSTOMIZE":
+		return kustomize.New(c)
+	case "jsonnet", "Jsonnet", "JSONNET":
+		return jsonnet.New()
 	default:
+		if plugin.Registered(rendererType) {
+			return plugin.New(rendererType)
+		}
 		return nil, fmt.Errorf("unable to create renderer for type %s. not implemented", rendererType)
 	}
 }
@@ -78,15 +186,24 @@ func GetRendererInput(template *osbv1alpha1.TemplateSpec, service *osbv1alpha1.S
 
 	switch rendererType {
 	case "helm", "Helm", "HELM":
-		input := helm.NewInput(template.URL, name.Name, name.Namespace, content, values)
-		return input, nil
+		return getHelmInput(template, name, template.Action, content, values)
 	case "gotemplate", "Gotemplate", "GoTemplate", "GOTEMPLATE":
+		if content == "" && template.URL == "" {
+			return nil, fmt.Errorf("url, content & contentEncoded fields empty for %s template ", template.Action)
+		}
+		input := gotemplate.NewInput(template.URL, template.Checksum, content, fmt.Sprintf("%s/%s", name.Name, template.Action), name.Namespace, template.Libraries, values)
+		return input, nil
+	case "kustomize", "Kustomize", "KUSTOMIZE":
+		return getKustomizeInput(template, name, template.Action, values)
+	case "jsonnet", "Jsonnet", "JSONNET":
 		if content == "" {
 			return nil, fmt.Errorf("content & contentEncoded fields empty for %s template ", template.Action)
 		}
-		input := gotemplate.NewInput(template.URL, content, fmt.Sprintf("%s/%s", name.Name, template.Action), values)
-		return input, nil
+		return getJsonnetInput(template, name, template.Action, content, values)
 	default:
+		if plugin.Registered(rendererType) {
+			return plugin.NewInput(template.Action, template.URL, content, fmt.Sprintf("%s/%s", name.Name, template.Action), name.Namespace, values), nil
+		}
 		return nil, fmt.Errorf("unable to create renderer for type %s. not implemented", rendererType)
 	}
 }
@@ -114,12 +231,73 @@ func GetRendererInputFromSources(template *osbv1alpha1.TemplateSpec, name types.
 		if action == osbv1alpha1.SourcesAction || action == osbv1alpha1.StatusAction {
 			return nil, fmt.Errorf("%s renderer type not supported for %s action", rendererType, action)
 		}
-		input := helm.NewInput(template.URL, name.Name, name.Namespace, content, sources)
-		return input, nil
+		return getHelmInput(template, name, action, content, sources)
 	case "gotemplate", "Gotemplate", "GoTemplate", "GOTEMPLATE":
-		input := gotemplate.NewInput(template.URL, content, fmt.Sprintf("%s/%s", name.Name, action), sources)
+		input := gotemplate.NewInput(template.URL, template.Checksum, content, fmt.Sprintf("%s/%s", name.Name, action), name.Namespace, template.Libraries, sources)
 		return input, nil
+	case "kustomize", "Kustomize", "KUSTOMIZE":
+		if action == osbv1alpha1.SourcesAction || action == osbv1alpha1.StatusAction {
+			return nil, fmt.Errorf("%s renderer type not supported for %s action", rendererType, action)
+		}
+		return getKustomizeInput(template, name, action, sources)
+	case "jsonnet", "Jsonnet", "JSONNET":
+		return getJsonnetInput(template, name, action, content, sources)
 	default:
+		if plugin.Registered(rendererType) {
+			return plugin.NewInput(action, template.URL, content, fmt.Sprintf("%s/%s", name.Name, action), name.Namespace, sources), nil
+		}
 		return nil, fmt.Errorf("unable to create renderer for type %s. not implemented", rendererType)
 	}
 }
+
+// getJsonnetInput constructs the input for the jsonnet renderer. Snippets
+// can only be provided in content, so url must not be set.
+func getJsonnetInput(template *osbv1alpha1.TemplateSpec, name types.NamespacedName, action string,
+	content string, values map[string]interface{}) (renderer.Input, error) {
+	if template.URL != "" {
+		return nil, errors.NewInputError("getJsonnetInput", "url",
+			fmt.Errorf("jsonnet snippets can't be fetched from %s, use content or contentEncoded", template.URL))
+	}
+	return jsonnet.NewInput(content, fmt.Sprintf("%s/%s", name.Name, action), values), nil
+}
+
+// getHelmInput constructs the input for the helm renderer. If url is not set,
+// contentEncoded holds the chart as a gzipped tarball and only content is
+// used as the gotemplate for the values.
+func getHelmInput(template *osbv1alpha1.TemplateSpec, name types.NamespacedName, action string,
+	valuesTemplate string, values map[string]interface{}) (renderer.Input, error) {
+	var chartArchive []byte
+	if template.URL == "" {
+		if template.ContentEncoded == "" {
+			return nil, fmt.Errorf("url & contentEncoded fields empty for %s template ", action)
+		}
+		decodedChart, err := base64.StdEncoding.DecodeString(template.ContentEncoded)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode base64 content %v", err)
+		}
+		chartArchive = decodedChart
+		valuesTemplate = template.Content
+	}
+	input := helm.NewInput(template.URL, chartArchive, template.CredentialsSecretRef, name.Name, name.Namespace, valuesTemplate, template.Libraries, values)
+	return input, nil
+}
+
+// getKustomizeInput constructs the input for the kustomize renderer. Unlike other
+// renderers, contentEncoded holds the base as a gzipped tarball and content holds
+// the gotemplate for the overlay.
+func getKustomizeInput(template *osbv1alpha1.TemplateSpec, name types.NamespacedName, action string,
+	values map[string]interface{}) (renderer.Input, error) {
+	var base []byte
+	if template.ContentEncoded != "" {
+		decodedBase, err := base64.StdEncoding.DecodeString(template.ContentEncoded)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode base64 content %v", err)
+		}
+		base = decodedBase
+	}
+	if template.URL == "" && base == nil {
+		return nil, fmt.Errorf("url & contentEncoded fields empty for %s template ", action)
+	}
+	input := kustomize.NewInput(template.URL, base, template.Content, fmt.Sprintf("%s/%s", name.Name, action), name.Namespace, template.Libraries, values)
+	return input, nil
+}
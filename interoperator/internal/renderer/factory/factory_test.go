@@ -5,31 +5,49 @@ import (
 	"testing"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/helm"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/jsonnet"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/kustomize"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/plugin"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func TestGetRenderer(t *testing.T) {
 	type args struct {
 		rendererType string
-		clientSet    *kubernetes.Clientset
+		c            client.Client
 	}
 
 	helmRenderer, err := helm.New(nil)
 	if err != nil {
 		t.Errorf("GetRenderer() failed to create  helmRenderer error = %v", err)
 	}
-	gotemplateRenderer, err := gotemplate.New()
+	gotemplateRenderer, err := gotemplate.New(nil)
 	if err != nil {
 		t.Errorf("GetRenderer() failed to create  gotemplateRenderer error = %v", err)
 	}
+	kustomizeRenderer, err := kustomize.New(nil)
+	if err != nil {
+		t.Errorf("GetRenderer() failed to create  kustomizeRenderer error = %v", err)
+	}
+	jsonnetRenderer, err := jsonnet.New()
+	if err != nil {
+		t.Errorf("GetRenderer() failed to create  jsonnetRenderer error = %v", err)
+	}
+	defer plugin.Register(nil)
+	plugin.Register(map[string]plugin.Config{"cue": {Command: []string{"cue-plugin"}}})
+	pluginRenderer, err := plugin.New("cue")
+	if err != nil {
+		t.Errorf("GetRenderer() failed to create  pluginRenderer error = %v", err)
+	}
 	tests := []struct {
 		name    string
 		args    args
@@ -40,7 +58,7 @@ func TestGetRenderer(t *testing.T) {
 			name: "testValidInput",
 			args: args{
 				rendererType: "helm",
-				clientSet:    nil,
+				c:            nil,
 			},
 			want:    helmRenderer,
 			wantErr: false,
@@ -49,16 +67,43 @@ func TestGetRenderer(t *testing.T) {
 			name: "testValidInputGotemplate",
 			args: args{
 				rendererType: "gotemplate",
-				clientSet:    nil,
+				c:            nil,
 			},
 			want:    gotemplateRenderer,
 			wantErr: false,
 		},
+		{
+			name: "testValidInputKustomize",
+			args: args{
+				rendererType: "kustomize",
+				c:            nil,
+			},
+			want:    kustomizeRenderer,
+			wantErr: false,
+		},
+		{
+			name: "testValidInputJsonnet",
+			args: args{
+				rendererType: "jsonnet",
+				c:            nil,
+			},
+			want:    jsonnetRenderer,
+			wantErr: false,
+		},
+		{
+			name: "testValidInputPlugin",
+			args: args{
+				rendererType: "cue",
+				c:            nil,
+			},
+			want:    pluginRenderer,
+			wantErr: false,
+		},
 		{
 			name: "testInvalidInput",
 			args: args{
 				rendererType: "abc",
-				clientSet:    nil,
+				c:            nil,
 			},
 			want:    nil,
 			wantErr: true,
@@ -66,7 +111,7 @@ func TestGetRenderer(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := GetRenderer(tt.args.rendererType, tt.args.clientSet)
+			got, err := GetRenderer(tt.args.rendererType, tt.args.c)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetRenderer() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -178,7 +223,7 @@ func TestGetRendererInput(t *testing.T) {
 	values["instance"] = instanceObj
 	bindingObj, _ := dynamic.ObjectToMapInterface(binding)
 	values["binding"] = bindingObj
-	helmInput := helm.NewInput(template.URL, name.Name, name.Namespace, "valuesTemplate", values)
+	helmInput := helm.NewInput(template.URL, nil, "", name.Name, name.Namespace, "valuesTemplate", nil, values)
 
 	type args struct {
 		template *osbv1alpha1.TemplateSpec
@@ -267,9 +312,60 @@ func TestGetRendererInput(t *testing.T) {
 				binding:  &binding,
 				name:     name,
 			},
-			want:    gotemplate.NewInput("", "ContentEncoded", name.Name, values),
+			want:    gotemplate.NewInput("", "", "ContentEncoded", name.Name, name.Namespace, nil, values),
 			wantErr: false,
 		},
+		{
+			name: "testValidInput jsonnet",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:  "provision",
+					Type:    "jsonnet",
+					Content: "[]",
+				},
+				service:  &service,
+				plan:     &plan,
+				instance: &instance,
+				binding:  &binding,
+				name:     name,
+			},
+			want:    jsonnet.NewInput("[]", name.Name, values),
+			wantErr: false,
+		},
+		{
+			name: "testInvalidInput jsonnet url",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:  "provision",
+					Type:    "jsonnet",
+					URL:     "https://example.com/provision.jsonnet",
+					Content: "[]",
+				},
+				service:  &service,
+				plan:     &plan,
+				instance: &instance,
+				binding:  &binding,
+				name:     name,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "testInvalidInput jsonnet no content and ContentEncoded",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action: "provision",
+					Type:   "jsonnet",
+				},
+				service:  &service,
+				plan:     &plan,
+				instance: &instance,
+				binding:  &binding,
+				name:     name,
+			},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -306,6 +402,9 @@ func TestGetRendererInputFromSources(t *testing.T) {
 	sources := make(map[string]interface{})
 	sources["key"] = make(map[string]interface{})
 
+	defer plugin.Register(nil)
+	plugin.Register(map[string]plugin.Config{"cue": {Command: []string{"cue-plugin"}}})
+
 	tests := []struct {
 		name    string
 		args    args
@@ -333,7 +432,7 @@ func TestGetRendererInputFromSources(t *testing.T) {
 				name:    name,
 				sources: nil,
 			},
-			want:    gotemplate.NewInput("", "statuscontent", "foo", nil),
+			want:    gotemplate.NewInput("", "", "statuscontent", "foo", name.Namespace, nil, nil),
 			wantErr: false,
 		},
 		{
@@ -347,7 +446,7 @@ func TestGetRendererInputFromSources(t *testing.T) {
 				name:    name,
 				sources: nil,
 			},
-			want:    gotemplate.NewInput("", "statuscontent", "foo", nil),
+			want:    gotemplate.NewInput("", "", "statuscontent", "foo", name.Namespace, nil, nil),
 			wantErr: false,
 		},
 		{
@@ -390,9 +489,138 @@ func TestGetRendererInputFromSources(t *testing.T) {
 				name:    name,
 				sources: nil,
 			},
-			want:    helm.NewInput("../helm/samples/postgresql", name.Name, name.Namespace, "valuesContent", nil),
+			want:    helm.NewInput("../helm/samples/postgresql", nil, "", name.Name, name.Namespace, "valuesContent", nil, nil),
+			wantErr: false,
+		},
+		{
+			name: "testValidInputHelm with inline chart and credentials",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:               "provision",
+					Type:                 "helm",
+					Content:              "valuesContent",
+					ContentEncoded:       "Y2hhcnQ=",
+					CredentialsSecretRef: "credentials",
+				},
+				name:    name,
+				sources: nil,
+			},
+			want:    helm.NewInput("", []byte("chart"), "credentials", name.Name, name.Namespace, "valuesContent", nil, nil),
 			wantErr: false,
 		},
+		{
+			name: "testInvalidInputHelm without url and contentEncoded",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:  "provision",
+					Type:    "helm",
+					Content: "valuesContent",
+				},
+				name:    name,
+				sources: nil,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "testValidInputKustomize with url",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:  "provision",
+					Type:    "kustomize",
+					URL:     "../kustomize/samples/base",
+					Content: "overlayContent",
+				},
+				name:    name,
+				sources: nil,
+			},
+			want:    kustomize.NewInput("../kustomize/samples/base", nil, "overlayContent", "foo", name.Namespace, nil, nil),
+			wantErr: false,
+		},
+		{
+			name: "testInvalidInput kustomize without url and contentEncoded",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:  "provision",
+					Type:    "kustomize",
+					Content: "overlayContent",
+				},
+				name:    name,
+				sources: nil,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "testInvalidInput kustomize fail to decode ContentEncoded",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:         "provision",
+					Type:           "kustomize",
+					ContentEncoded: "invalid bas64 content",
+				},
+				name:    name,
+				sources: nil,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "testValidInputJsonnet for status action",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:  "status",
+					Type:    "jsonnet",
+					Content: "{}",
+				},
+				name:    name,
+				sources: sources,
+			},
+			want:    jsonnet.NewInput("{}", "foo", sources),
+			wantErr: false,
+		},
+		{
+			name: "testInvalidInputJsonnet url for status action",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action: "status",
+					Type:   "jsonnet",
+					URL:    "https://example.com/status.jsonnet",
+				},
+				name:    name,
+				sources: sources,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "testValidInputPlugin for sources action",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action:  "sources",
+					Type:    "cue",
+					Content: "sourcesContent",
+				},
+				name:    name,
+				sources: nil,
+			},
+			want:    plugin.NewInput("sources", "", "sourcesContent", "foo/sources", name.Namespace, nil),
+			wantErr: false,
+		},
+		{
+			name: "testInvalidInput kustomize type for sources action",
+			args: args{
+				template: &osbv1alpha1.TemplateSpec{
+					Action: "sources",
+					Type:   "kustomize",
+					URL:    "../kustomize/samples/base",
+				},
+				name:    name,
+				sources: nil,
+			},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -407,3 +635,27 @@ func TestGetRendererInputFromSources(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigure_rendererPlugins(t *testing.T) {
+	defer plugin.Register(nil)
+	Configure(&config.InteroperatorConfig{
+		HelmChartCacheTTL:     constants.DefaultHelmChartCacheTTL,
+		HelmChartCacheMaxSize: constants.DefaultHelmChartCacheMaxSize,
+		TemplateTimeout:       constants.DefaultTemplateTimeout,
+		TemplateMaxOutputSize: constants.DefaultTemplateMaxOutputSize,
+		RenderCacheSize:       constants.DefaultRenderCacheSize,
+		RendererPlugins: map[string]config.RendererPlugin{
+			"cue":     {Command: []string{"cue-plugin"}},
+			"dsl":     {Socket: "/var/run/dsl/plugin.sock"},
+			"invalid": {Command: []string{"plugin"}, Socket: "/var/run/plugin.sock"},
+			"empty":   {},
+			"helm":    {Command: []string{"helm-plugin"}},
+		},
+	})
+
+	for rendererType, want := range map[string]bool{"cue": true, "dsl": true, "invalid": false, "empty": false, "helm": false} {
+		if got := plugin.Registered(rendererType); got != want {
+			t.Errorf("Configure() registered plugin %s = %v, want %v", rendererType, got, want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package golden regression tests the templates of plans against golden
+// files. A plan directory has the layout
+//
+//	<plan dir>/
+//	  service.yaml
+//	  plan.yaml
+//	  libraries.yaml                (optional)
+//	  testcases/
+//	    <test case>/
+//	      instance.yaml
+//	      binding.yaml              (optional)
+//	      objects.yaml              (optional)
+//	      provision.golden.yaml
+//	      bind.golden.yaml          (if binding.yaml exists)
+//	      unbind.golden.yaml        (if binding.yaml exists and the plan has an unbind template)
+//
+// libraries.yaml holds the ConfigMaps of the template libraries used by the
+// plan. Each test case is rendered with the offline renderer and the output
+// is compared with the golden file of the action.
+package golden
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/offline"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	serviceFile   = "service.yaml"
+	planFile      = "plan.yaml"
+	instanceFile  = "instance.yaml"
+	bindingFile   = "binding.yaml"
+	objectsFile   = "objects.yaml"
+	librariesFile = "libraries.yaml"
+	testCasesDir  = "testcases"
+	goldenSuffix  = ".golden.yaml"
+	goldenFileMod = 0644
+)
+
+// Result is the outcome of comparing one action of a test case
+type Result struct {
+	PlanDir  string
+	TestCase string
+	Action   string
+
+	// Diff between the golden file and the rendered output. Empty if
+	// they are the same.
+	Diff string
+
+	// Updated is set if the golden file was written in update mode
+	Updated bool
+
+	// Err is set if the test case could not be rendered
+	Err error
+}
+
+// Failed returns true if the rendered output does not match the golden file
+func (r Result) Failed() bool {
+	return r.Err != nil || (r.Diff != "" && !r.Updated)
+}
+
+func (r Result) String() string {
+	name := fmt.Sprintf("%s/%s/%s", r.PlanDir, r.TestCase, r.Action)
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("FAIL %s: %v", name, r.Err)
+	case r.Updated:
+		return fmt.Sprintf("UPDATED %s", name)
+	case r.Diff != "":
+		return fmt.Sprintf("FAIL %s: output differs from golden file (-want +got):\n%s", name, r.Diff)
+	default:
+		return fmt.Sprintf("ok %s", name)
+	}
+}
+
+// FindPlanDirs returns the plan directories within root, sorted by path
+func FindPlanDirs(root string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == testCasesDir {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && d.Name() == planFile {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// Run renders all the test cases of the plan directory and compares the
+// output with the golden files. In update mode, golden files which differ
+// or are missing are written instead.
+func Run(planDir string, update bool) ([]Result, error) {
+	service := &osbv1alpha1.SFService{}
+	err := offline.ReadObject(filepath.Join(planDir, serviceFile), service)
+	if err != nil {
+		return nil, err
+	}
+	plan := &osbv1alpha1.SFPlan{}
+	err = offline.ReadObject(filepath.Join(planDir, planFile), plan)
+	if err != nil {
+		return nil, err
+	}
+
+	var libraries []*unstructured.Unstructured
+	librariesPath := filepath.Join(planDir, librariesFile)
+	if fileExists(librariesPath) {
+		libraries, err = offline.ReadObjects(librariesPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(planDir, testCasesDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		caseDir := filepath.Join(planDir, testCasesDir, entry.Name())
+		input, err := readTestCase(caseDir, service, plan, libraries)
+		if err != nil {
+			results = append(results, Result{
+				PlanDir:  planDir,
+				TestCase: entry.Name(),
+				Err:      err,
+			})
+			continue
+		}
+		for _, action := range actions(input) {
+			result := runAction(input, caseDir, action, update)
+			result.PlanDir = planDir
+			result.TestCase = entry.Name()
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func readTestCase(caseDir string, service *osbv1alpha1.SFService, plan *osbv1alpha1.SFPlan,
+	libraries []*unstructured.Unstructured) (*offline.Input, error) {
+	input := &offline.Input{
+		// Templates may modify the objects, so each test case gets a copy
+		Service:   service.DeepCopy(),
+		Plan:      plan.DeepCopy(),
+		Instance:  &osbv1alpha1.SFServiceInstance{},
+		Libraries: libraries,
+	}
+	err := offline.ReadObject(filepath.Join(caseDir, instanceFile), input.Instance)
+	if err != nil {
+		return nil, err
+	}
+
+	bindingPath := filepath.Join(caseDir, bindingFile)
+	if fileExists(bindingPath) {
+		input.Binding = &osbv1alpha1.SFServiceBinding{}
+		err = offline.ReadObject(bindingPath, input.Binding)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	objectsPath := filepath.Join(caseDir, objectsFile)
+	if fileExists(objectsPath) {
+		input.Objects, err = offline.ReadObjects(objectsPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return input, nil
+}
+
+// actions returns the actions to be tested for the test case
+func actions(input *offline.Input) []string {
+	actions := []string{osbv1alpha1.ProvisionAction}
+	if input.Binding != nil {
+		actions = append(actions, osbv1alpha1.BindAction)
+		if _, err := input.Plan.GetTemplate(osbv1alpha1.UnbindAction); err == nil {
+			actions = append(actions, osbv1alpha1.UnbindAction)
+		}
+	}
+	return actions
+}
+
+func runAction(input *offline.Input, caseDir, action string, update bool) Result {
+	result := Result{
+		Action: action,
+	}
+
+	rendered, err := offline.Render(input, action)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	got, err := yaml.Marshal(rendered)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	goldenPath := filepath.Join(caseDir, action+goldenSuffix)
+	want, err := os.ReadFile(goldenPath)
+	if err != nil && !(update && os.IsNotExist(err)) {
+		result.Err = err
+		return result
+	}
+
+	result.Diff = cmp.Diff(string(want), string(got))
+	if result.Diff != "" && update {
+		result.Err = os.WriteFile(goldenPath, got, goldenFileMod)
+		result.Updated = result.Err == nil
+	}
+	return result
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golden
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// copyDir copies the directory src to a temporary directory
+func copyDir(t *testing.T, src string) string {
+	dst := t.TempDir()
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, relPath), 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, relPath), data, 0644)
+	})
+	if err != nil {
+		t.Fatalf("failed to copy %s: %v", src, err)
+	}
+	return dst
+}
+
+func TestFindPlanDirs(t *testing.T) {
+	got, err := FindPlanDirs("samples")
+	if err != nil {
+		t.Fatalf("FindPlanDirs() error = %v", err)
+	}
+	want := []string{filepath.Join("samples", "sample")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindPlanDirs() = %v, want %v", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("match golden files", func(t *testing.T) {
+		results, err := Run("samples/sample", false)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if len(results) != 3 {
+			t.Errorf("Run() returned %d results, want 3", len(results))
+		}
+		for _, result := range results {
+			if result.Failed() {
+				t.Errorf("Run() %s", result)
+			}
+		}
+	})
+
+	t.Run("report difference to golden file", func(t *testing.T) {
+		dir := copyDir(t, "samples/sample")
+		goldenPath := filepath.Join(dir, "testcases", "with-binding", "bind.golden.yaml")
+		if err := os.WriteFile(goldenPath, []byte("resources: []\n"), 0644); err != nil {
+			t.Fatalf("failed to modify golden file: %v", err)
+		}
+
+		results, err := Run(dir, false)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		for _, result := range results {
+			wantFailed := result.TestCase == "with-binding" && result.Action == "bind"
+			if result.Failed() != wantFailed {
+				t.Errorf("Run() %s, want failed %v", result, wantFailed)
+			}
+			if wantFailed && result.Diff == "" {
+				t.Errorf("Run() expected diff for %s", result.Action)
+			}
+		}
+	})
+
+	t.Run("fail if golden file missing", func(t *testing.T) {
+		dir := copyDir(t, "samples/sample")
+		goldenPath := filepath.Join(dir, "testcases", "instance-only", "provision.golden.yaml")
+		if err := os.Remove(goldenPath); err != nil {
+			t.Fatalf("failed to remove golden file: %v", err)
+		}
+
+		results, err := Run(dir, false)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if !results[0].Failed() || results[0].Err == nil {
+			t.Errorf("Run() %s, want error", results[0])
+		}
+	})
+
+	t.Run("fail if template library missing", func(t *testing.T) {
+		dir := copyDir(t, "samples/sample")
+		if err := os.Remove(filepath.Join(dir, "libraries.yaml")); err != nil {
+			t.Fatalf("failed to remove libraries: %v", err)
+		}
+
+		results, err := Run(dir, false)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		for _, result := range results {
+			wantFailed := result.Action == "provision"
+			if result.Failed() != wantFailed || (wantFailed && result.Err == nil) {
+				t.Errorf("Run() %s, want error %v", result, wantFailed)
+			}
+		}
+	})
+
+	t.Run("update golden files", func(t *testing.T) {
+		dir := copyDir(t, "samples/sample")
+		goldenPath := filepath.Join(dir, "testcases", "instance-only", "provision.golden.yaml")
+		want, err := os.ReadFile(goldenPath)
+		if err != nil {
+			t.Fatalf("failed to read golden file: %v", err)
+		}
+		if err := os.Remove(goldenPath); err != nil {
+			t.Fatalf("failed to remove golden file: %v", err)
+		}
+
+		results, err := Run(dir, true)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		for _, result := range results {
+			if result.Failed() {
+				t.Errorf("Run() %s", result)
+			}
+		}
+		if !results[0].Updated {
+			t.Errorf("Run() %s, want updated", results[0])
+		}
+		got, err := os.ReadFile(goldenPath)
+		if err != nil || string(got) != string(want) {
+			t.Errorf("Run() golden file = %s, %v, want %s", got, err, want)
+		}
+	})
+
+	t.Run("fail if plan directory is invalid", func(t *testing.T) {
+		_, err := Run("samples", false)
+		if err == nil {
+			t.Errorf("Run() expected error")
+		}
+	})
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"text/template"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// loadLibraries parses the template libraries into engine, so that their
+// named templates can be used by the template parsed later into engine. A
+// version of a library is a ConfigMap in the interoperator namespace
+// labelled with the name and the version of the library. Each key of the
+// ConfigMap holds templates, which are parsed in the order of the keys.
+func loadLibraries(c client.Reader, engine *template.Template, libraries []osbv1alpha1.TemplateLibraryRef) error {
+	for _, library := range libraries {
+		if c == nil {
+			return fmt.Errorf("can't load template library %s without a client", library.Name)
+		}
+		data, err := fetchLibrary(c, library)
+		if err != nil {
+			return err
+		}
+
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			// The content outside the named templates goes to a template of
+			// its own, which is never executed
+			name := fmt.Sprintf("%s@%s/%s", library.Name, library.Version, key)
+			_, err = engine.New(name).Parse(data[key])
+			if err != nil {
+				return fmt.Errorf("failed to parse %s of template library %s version %s. %v",
+					key, library.Name, library.Version, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LibraryContents returns the content of each of the template libraries,
+// in the order of libraries
+func LibraryContents(c client.Reader, libraries []osbv1alpha1.TemplateLibraryRef) ([]map[string]string, error) {
+	contents := make([]map[string]string, 0, len(libraries))
+	for _, library := range libraries {
+		if c == nil {
+			return nil, fmt.Errorf("can't load template library %s without a client", library.Name)
+		}
+		data, err := fetchLibrary(c, library)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, data)
+	}
+	return contents, nil
+}
+
+func fetchLibrary(c client.Reader, library osbv1alpha1.TemplateLibraryRef) (map[string]string, error) {
+	configMaps := &corev1.ConfigMapList{}
+	err := c.List(context.TODO(), configMaps,
+		client.InNamespace(constants.InteroperatorNamespace),
+		client.MatchingLabels{
+			constants.TemplateLibraryKey:        library.Name,
+			constants.TemplateLibraryVersionKey: library.Version,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch template library %s version %s. %v", library.Name, library.Version, err)
+	}
+	switch len(configMaps.Items) {
+	case 0:
+		return nil, fmt.Errorf("template library %s version %s not found", library.Name, library.Version)
+	case 1:
+		return configMaps.Items[0].Data, nil
+	default:
+		return nil, fmt.Errorf("found %d ConfigMaps for template library %s version %s",
+			len(configMaps.Items), library.Name, library.Version)
+	}
+}
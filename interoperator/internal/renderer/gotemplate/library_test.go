@@ -0,0 +1,178 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func libraryConfigMap(name, library, version string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: constants.InteroperatorNamespace,
+			Labels: map[string]string{
+				constants.TemplateLibraryKey:        library,
+				constants.TemplateLibraryVersionKey: version,
+			},
+		},
+		Data: data,
+	}
+}
+
+func Test_gotemplateRenderer_Render_libraries(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(
+		libraryConfigMap("common-1", "common", "1.0.0", map[string]string{
+			"labels.tpl": `{{ define "common.labels" }}app: {{ .value }}{{ end }}`,
+			"names.tpl":  `{{ define "common.name" }}in-{{ .value }}{{ end }}`,
+		}),
+		libraryConfigMap("common-2", "common", "2.0.0", map[string]string{
+			"labels.tpl": `{{ define "common.labels" }}app.kubernetes.io/name: {{ .value }}{{ end }}`,
+		}),
+		libraryConfigMap("files-1", "files", "1.0.0", map[string]string{
+			"files.tpl": `{{ define "file:library.yaml" }}from library{{ end }}`,
+		}),
+		libraryConfigMap("broken-1", "broken", "1.0.0", map[string]string{
+			"broken.tpl": `{{ define "broken" }}`,
+		}),
+		libraryConfigMap("duplicate-a", "duplicate", "1.0.0", nil),
+		libraryConfigMap("duplicate-b", "duplicate", "1.0.0", nil),
+	).Build()
+	values := map[string]interface{}{"value": "world"}
+
+	tests := []struct {
+		name      string
+		client    client.Client
+		libraries []osbv1alpha1.TemplateLibraryRef
+		content   string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "use named templates of library",
+			client:    c,
+			libraries: []osbv1alpha1.TemplateLibraryRef{{Name: "common", Version: "1.0.0"}},
+			content:   `{{ template "common.name" . }} {{ template "common.labels" . }}`,
+			want:      "in-world app: world",
+		},
+		{
+			name:      "use pinned version of library",
+			client:    c,
+			libraries: []osbv1alpha1.TemplateLibraryRef{{Name: "common", Version: "2.0.0"}},
+			content:   `{{ template "common.labels" . }}`,
+			want:      "app.kubernetes.io/name: world",
+		},
+		{
+			name:      "override named templates of library",
+			client:    c,
+			libraries: []osbv1alpha1.TemplateLibraryRef{{Name: "common", Version: "1.0.0"}},
+			content:   `{{ define "common.name" }}custom{{ end }}{{ template "common.name" . }}`,
+			want:      "custom",
+		},
+		{
+			name:      "use file templates of library as named templates only",
+			client:    c,
+			libraries: []osbv1alpha1.TemplateLibraryRef{{Name: "files", Version: "1.0.0"}},
+			content:   `{{ template "file:library.yaml" . }}`,
+			want:      "from library",
+		},
+		{
+			name:      "fail if library version not found",
+			client:    c,
+			libraries: []osbv1alpha1.TemplateLibraryRef{{Name: "common", Version: "3.0.0"}},
+			content:   `{{ template "common.labels" . }}`,
+			wantErr:   true,
+		},
+		{
+			name:      "fail if library version is ambiguous",
+			client:    c,
+			libraries: []osbv1alpha1.TemplateLibraryRef{{Name: "duplicate", Version: "1.0.0"}},
+			content:   `hello`,
+			wantErr:   true,
+		},
+		{
+			name:      "fail if library can not be parsed",
+			client:    c,
+			libraries: []osbv1alpha1.TemplateLibraryRef{{Name: "broken", Version: "1.0.0"}},
+			content:   `hello`,
+			wantErr:   true,
+		},
+		{
+			name:      "fail without client",
+			libraries: []osbv1alpha1.TemplateLibraryRef{{Name: "common", Version: "1.0.0"}},
+			content:   `{{ template "common.labels" . }}`,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := New(tt.client)
+			got, err := r.Render(NewInput("", "", tt.content, "name", "namespace", tt.libraries, values))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("gotemplateRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			out, _ := got.FileContent("main")
+			if out != tt.want {
+				t.Errorf("gotemplateRenderer.Render() = %v, want %v", out, tt.want)
+			}
+			files, _ := got.ListFiles()
+			if len(files) != 1 {
+				t.Errorf("gotemplateRenderer.Render() files = %v, want only main", files)
+			}
+		})
+	}
+}
+
+func TestLibraryContents(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(
+		libraryConfigMap("common-1", "common", "1.0.0", map[string]string{"helpers.tpl": "common"}),
+		libraryConfigMap("files-1", "files", "1.0.0", map[string]string{"files.tpl": "files"}),
+	).Build()
+	libraries := []osbv1alpha1.TemplateLibraryRef{
+		{Name: "files", Version: "1.0.0"},
+		{Name: "common", Version: "1.0.0"},
+	}
+
+	got, err := LibraryContents(c, libraries)
+	if err != nil {
+		t.Fatalf("LibraryContents() error = %v", err)
+	}
+	if len(got) != 2 || got[0]["files.tpl"] != "files" || got[1]["helpers.tpl"] != "common" {
+		t.Errorf("LibraryContents() = %v, want files and common", got)
+	}
+	if got, err := LibraryContents(nil, nil); err != nil || len(got) != 0 {
+		t.Errorf("LibraryContents() without libraries = %v, %v, want none", got, err)
+	}
+	if _, err := LibraryContents(c, []osbv1alpha1.TemplateLibraryRef{{Name: "common", Version: "2.0.0"}}); err == nil {
+		t.Errorf("LibraryContents() expected error for missing library")
+	}
+	if _, err := LibraryContents(nil, libraries); err == nil {
+		t.Errorf("LibraryContents() expected error without client")
+	}
+}
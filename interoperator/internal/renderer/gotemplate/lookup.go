@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// lookupAllowList is the list of kinds which can be read by the lookup
+// function. It is shared by all gotemplate renderers.
+var lookupAllowList = struct {
+	sync.RWMutex
+	kinds []osbv1alpha1.APIVersionKind
+}{}
+
+// SetLookupAllowList sets the kinds which templates are allowed to read
+// using the lookup function. Lookups of any other kind fail.
+func SetLookupAllowList(kinds []osbv1alpha1.APIVersionKind) {
+	lookupAllowList.Lock()
+	defer lookupAllowList.Unlock()
+	lookupAllowList.kinds = make([]osbv1alpha1.APIVersionKind, len(kinds))
+	copy(lookupAllowList.kinds, kinds)
+}
+
+func lookupAllowed(apiVersion, kind string) bool {
+	lookupAllowList.RLock()
+	defer lookupAllowList.RUnlock()
+	for _, allowed := range lookupAllowList.kinds {
+		if allowed.APIVersion == apiVersion && allowed.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupFunc returns the lookup template function for a render. Like the
+// helm lookup function, it returns the object as a map or, if name is
+// empty, a map with the list of objects under "items". An empty map is
+// returned if the object is not found or if there is no client, as is the
+// case when rendering offline.
+//
+// Objects can only be read from <namespace>, the namespace of the
+// instance. An empty namespace in the template refers to it as well. The
+// allow list is checked without a client too, so that offline renders fail
+// the same way.
+func lookupFunc(c client.Reader, namespace string) func(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+	allowedNamespace := namespace
+	return func(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+		if namespace == "" {
+			namespace = allowedNamespace
+		}
+		if namespace != allowedNamespace {
+			return nil, fmt.Errorf("lookup in namespace %s not allowed", namespace)
+		}
+		if !lookupAllowed(apiVersion, kind) {
+			return nil, fmt.Errorf("lookup of %s %s not allowed", kind, apiVersion)
+		}
+		if c == nil {
+			return map[string]interface{}{}, nil
+		}
+
+		if name == "" {
+			list := &unstructured.UnstructuredList{}
+			list.SetAPIVersion(apiVersion)
+			list.SetKind(kind + "List")
+			err := c.List(context.TODO(), list, client.InNamespace(namespace))
+			if err != nil {
+				return nil, err
+			}
+			return list.UnstructuredContent(), nil
+		}
+
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		err := c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, obj)
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				return map[string]interface{}{}, nil
+			}
+			return nil, err
+		}
+		return obj.Object, nil
+	}
+}
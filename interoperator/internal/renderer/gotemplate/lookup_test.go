@@ -0,0 +1,135 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_gotemplateRenderer_Render_lookup(t *testing.T) {
+	SetLookupAllowList([]osbv1alpha1.APIVersionKind{
+		{APIVersion: "v1", Kind: "Secret"},
+	})
+	defer SetLookupAllowList(nil)
+
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "password", Namespace: "sf-instance"},
+			Data:       map[string][]byte{"password": []byte("secret")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "sf-other"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "sf-instance"},
+		},
+	).Build()
+
+	tests := []struct {
+		name    string
+		client  client.Client
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "read object from the namespace of the instance",
+			client:  c,
+			content: `{{ (lookup "v1" "Secret" "sf-instance" "password").data.password }}`,
+			want:    "c2VjcmV0",
+		},
+		{
+			name:    "default to the namespace of the instance",
+			client:  c,
+			content: `{{ (lookup "v1" "Secret" "" "password").metadata.name }}`,
+			want:    "password",
+		},
+		{
+			name:    "return empty map if object is not found",
+			client:  c,
+			content: `{{ if not (lookup "v1" "Secret" "" "missing") }}generated{{ end }}`,
+			want:    "generated",
+		},
+		{
+			name:    "list objects if name is empty",
+			client:  c,
+			content: `{{ range (lookup "v1" "Secret" "" "").items }}{{ .metadata.name }}{{ end }}`,
+			want:    "password",
+		},
+		{
+			name:    "return empty map without client",
+			content: `{{ len (lookup "v1" "Secret" "" "password") }}`,
+			want:    "0",
+		},
+		{
+			name:    "fail for kinds not in the allow list",
+			client:  c,
+			content: `{{ lookup "v1" "ConfigMap" "" "defaults" }}`,
+			wantErr: true,
+		},
+		{
+			name:    "fail for kinds not in the allow list without client",
+			content: `{{ lookup "v1" "ConfigMap" "" "defaults" }}`,
+			wantErr: true,
+		},
+		{
+			name:    "fail for other namespaces",
+			client:  c,
+			content: `{{ lookup "v1" "Secret" "sf-other" "other" }}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := New(tt.client)
+			got, err := r.Render(NewInput("", "", tt.content, "name", "sf-instance", nil, nil))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("gotemplateRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			out, _ := got.FileContent("main")
+			if out != tt.want {
+				t.Errorf("gotemplateRenderer.Render() = %v, want %v", out, tt.want)
+			}
+			if !renderer.IsVolatile(got) {
+				t.Errorf("gotemplateRenderer.Render() output using lookup is not volatile")
+			}
+		})
+	}
+}
+
+func Test_gotemplateRenderer_Render_volatile(t *testing.T) {
+	r, _ := New(nil)
+	got, err := r.Render(NewInput("", "", `{{ "hello" | upper }}`, "name", "sf-instance", nil, nil))
+	if err != nil {
+		t.Fatalf("gotemplateRenderer.Render() error = %v", err)
+	}
+	if renderer.IsVolatile(got) {
+		t.Errorf("gotemplateRenderer.Render() output without lookup is volatile")
+	}
+}
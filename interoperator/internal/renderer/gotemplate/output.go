@@ -3,23 +3,41 @@ package gotemplate
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strings"
 )
 
+// mainFile is the name of the file holding the output of the template
+// outside the file templates
+const mainFile = "main"
+
 type gotemplateOutput struct {
 	content bytes.Buffer
+	files   map[string]string
 }
 
 // FileContent returns explicitly the content of the provided <filename>.
 func (c *gotemplateOutput) FileContent(filename string) (string, error) {
-	if filename == "main" {
+	if filename == mainFile {
 		return c.content.String(), nil
 	}
+	if content, ok := c.files[filename]; ok {
+		return content, nil
+	}
 	return "", fmt.Errorf("file not found")
 }
 
-// ListFiles returns list of file names rendered
+// ListFiles returns list of file names rendered. If the template defines
+// file templates, the main file is listed first only if it is not blank.
 func (c *gotemplateOutput) ListFiles() ([]string, error) {
-	fileNames := make([]string, 0, 1)
-	fileNames = append(fileNames, "main")
-	return fileNames, nil
+	fileNames := make([]string, 0, len(c.files)+1)
+	if len(c.files) == 0 || strings.TrimSpace(c.content.String()) != "" {
+		fileNames = append(fileNames, mainFile)
+	}
+	names := make([]string, 0, len(c.files))
+	for name := range c.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(fileNames, names...), nil
 }
@@ -9,6 +9,7 @@ import (
 func Test_gotemplateOutput_FileContent(t *testing.T) {
 	type fields struct {
 		content bytes.Buffer
+		files   map[string]string
 	}
 	type args struct {
 		filename string
@@ -31,6 +32,18 @@ func Test_gotemplateOutput_FileContent(t *testing.T) {
 			want:    "fileContent",
 			wantErr: false,
 		},
+		{
+			name: "should return content of file template",
+			fields: fields{
+				content: *bytes.NewBuffer([]byte("fileContent")),
+				files:   map[string]string{"status.yaml": "status"},
+			},
+			args: args{
+				filename: "status.yaml",
+			},
+			want:    "status",
+			wantErr: false,
+		},
 		{
 			name: "should fail if file is not present",
 			fields: fields{
@@ -47,6 +60,7 @@ func Test_gotemplateOutput_FileContent(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &gotemplateOutput{
 				content: tt.fields.content,
+				files:   tt.fields.files,
 			}
 			got, err := c.FileContent(tt.args.filename)
 			if (err != nil) != tt.wantErr {
@@ -63,6 +77,7 @@ func Test_gotemplateOutput_FileContent(t *testing.T) {
 func Test_gotemplateOutput_ListFiles(t *testing.T) {
 	type fields struct {
 		content bytes.Buffer
+		files   map[string]string
 	}
 	tests := []struct {
 		name    string
@@ -78,11 +93,30 @@ func Test_gotemplateOutput_ListFiles(t *testing.T) {
 			want:    []string{"main"},
 			wantErr: false,
 		},
+		{
+			name: "should list main followed by the file templates",
+			fields: fields{
+				content: *bytes.NewBuffer([]byte("fileContent")),
+				files:   map[string]string{"b.yaml": "b", "a.yaml": "a"},
+			},
+			want:    []string{"main", "a.yaml", "b.yaml"},
+			wantErr: false,
+		},
+		{
+			name: "should not list main if blank",
+			fields: fields{
+				content: *bytes.NewBuffer([]byte("\n  \n")),
+				files:   map[string]string{"a.yaml": "a"},
+			},
+			want:    []string{"a.yaml"},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &gotemplateOutput{
 				content: tt.fields.content,
+				files:   tt.fields.files,
 			}
 			got, err := c.ListFiles()
 			if (err != nil) != tt.wantErr {
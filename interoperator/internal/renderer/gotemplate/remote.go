@@ -0,0 +1,196 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Upper bound for the size of a template fetched from a url
+	maxRemoteTemplateSize = 10 << 20
+
+	// Upper bound for the number of templates cached in memory
+	maxCachedTemplates = 256
+
+	fetchTimeout = 30 * time.Second
+
+	checksumPrefix = "sha256:"
+)
+
+var (
+	log = logf.Log.WithName("renderer.gotemplate")
+
+	// remoteTemplates is the cache shared across all the gotemplate renderers
+	remoteTemplates = newTemplateCache(filepath.Join(os.TempDir(), "interoperator", "templates"))
+)
+
+// parseChecksum returns the hex encoded sha256 digest of a checksum of the
+// form sha256:<digest>
+func parseChecksum(checksum string) (string, error) {
+	if checksum == "" {
+		return "", fmt.Errorf("checksum is required for templates fetched from a url")
+	}
+	if !strings.HasPrefix(checksum, checksumPrefix) {
+		return "", fmt.Errorf("invalid checksum %s. must be of the form %s<digest>", checksum, checksumPrefix)
+	}
+	digest := strings.ToLower(strings.TrimPrefix(checksum, checksumPrefix))
+	decoded, err := hex.DecodeString(digest)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid checksum %s. must be a sha256 digest", checksum)
+	}
+	return digest, nil
+}
+
+func sha256Digest(content []byte) string {
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:])
+}
+
+// templateCache stores the fetched templates in memory and on disk. As the
+// entries are keyed by their checksum, they never have to be fetched again.
+type templateCache struct {
+	mu      sync.Mutex
+	dir     string
+	entries map[string]string
+}
+
+func newTemplateCache(dir string) *templateCache {
+	return &templateCache{
+		dir:     dir,
+		entries: make(map[string]string),
+	}
+}
+
+// load returns the template with the given checksum from the cache or
+// fetches it from url. The content is verified against the checksum.
+func (c *templateCache) load(url, checksum string, fetch func(url string) ([]byte, error)) (string, error) {
+	digest, err := parseChecksum(checksum)
+	if err != nil {
+		return "", err
+	}
+
+	content, ok := c.get(digest)
+	if ok {
+		return content, nil
+	}
+
+	data, err := fetch(url)
+	if err != nil {
+		return "", err
+	}
+	if actual := sha256Digest(data); actual != digest {
+		return "", fmt.Errorf("checksum mismatch for %s. expected sha256:%s, got sha256:%s", url, digest, actual)
+	}
+
+	c.put(digest, data)
+	return string(data), nil
+}
+
+func (c *templateCache) get(digest string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if content, ok := c.entries[digest]; ok {
+		return content, true
+	}
+
+	path := filepath.Join(c.dir, digest)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	if sha256Digest(data) != digest {
+		log.Info("removing corrupt template from cache", "file", path)
+		os.Remove(path)
+		return "", false
+	}
+	c.add(digest, string(data))
+	return string(data), true
+}
+
+// put adds the template to the cache. Failures to write to disk only
+// affect caching and are logged.
+func (c *templateCache) put(digest string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(digest, string(data))
+
+	err := os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		log.Error(err, "failed to create template cache directory", "dir", c.dir)
+		return
+	}
+	// Write to a temporary file first so that a partially written
+	// template is never visible in the cache
+	tmp, err := os.CreateTemp(c.dir, "download-*")
+	if err != nil {
+		log.Error(err, "failed to create file in template cache", "dir", c.dir)
+		return
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, digest))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Error(err, "failed to add template to cache", "digest", digest)
+	}
+}
+
+// add stores the template in memory. Must be called with the lock held.
+func (c *templateCache) add(digest, content string) {
+	if len(c.entries) >= maxCachedTemplates {
+		// The entries are still on disk, so simply start over
+		c.entries = make(map[string]string)
+	}
+	c.entries[digest] = content
+}
+
+// fetchTemplate downloads the template at url
+func fetchTemplate(httpClient *http.Client, url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s. status %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteTemplateSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRemoteTemplateSize {
+		return nil, fmt.Errorf("template at %s exceeds %d bytes", url, maxRemoteTemplateSize)
+	}
+	return data, nil
+}
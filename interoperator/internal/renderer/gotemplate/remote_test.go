@@ -0,0 +1,192 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+)
+
+const remoteTemplate = `hello {{ .value }}`
+
+func remoteTemplateServer(t *testing.T, requests *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*requests++
+		switch req.URL.Path {
+		case "/template.tpl":
+			fmt.Fprint(w, remoteTemplate)
+		case "/large.tpl":
+			fmt.Fprint(w, strings.Repeat("x", maxRemoteTemplateSize+1))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func Test_gotemplateRenderer_Render_url(t *testing.T) {
+	requests := 0
+	server := remoteTemplateServer(t, &requests)
+	checksum := checksumPrefix + sha256Digest([]byte(remoteTemplate))
+	values := map[string]interface{}{"value": "world"}
+
+	cache := remoteTemplates
+	defer func() { remoteTemplates = cache }()
+
+	tests := []struct {
+		name     string
+		url      string
+		checksum string
+		content  string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "render template fetched from url",
+			url:      server.URL + "/template.tpl",
+			checksum: checksum,
+			want:     "hello world",
+		},
+		{
+			name:     "accept upper case digest",
+			url:      server.URL + "/template.tpl",
+			checksum: checksumPrefix + strings.ToUpper(sha256Digest([]byte(remoteTemplate))),
+			want:     "hello world",
+		},
+		{
+			name:     "fail on checksum without prefix",
+			url:      server.URL + "/template.tpl",
+			checksum: sha256Digest([]byte(remoteTemplate)),
+			wantErr:  true,
+		},
+		{
+			name:     "prefer content over url",
+			url:      server.URL + "/template.tpl",
+			checksum: checksum,
+			content:  "inline {{ .value }}",
+			want:     "inline world",
+		},
+		{
+			name:     "fetch template if content is blank",
+			url:      server.URL + "/template.tpl",
+			checksum: checksum,
+			content:  " ",
+			want:     "hello world",
+		},
+		{
+			name:    "fail without checksum",
+			url:     server.URL + "/template.tpl",
+			wantErr: true,
+		},
+		{
+			name:     "fail on invalid checksum",
+			url:      server.URL + "/template.tpl",
+			checksum: "sha256:1234",
+			wantErr:  true,
+		},
+		{
+			name:     "fail on checksum mismatch",
+			url:      server.URL + "/template.tpl",
+			checksum: checksumPrefix + sha256Digest([]byte("other")),
+			wantErr:  true,
+		},
+		{
+			name:     "fail if template not found",
+			url:      server.URL + "/missing.tpl",
+			checksum: checksum,
+			wantErr:  true,
+		},
+		{
+			name:     "fail if template is too large",
+			url:      server.URL + "/large.tpl",
+			checksum: checksum,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remoteTemplates = newTemplateCache(t.TempDir())
+			r, _ := New(nil)
+			got, err := r.Render(NewInput(tt.url, tt.checksum, tt.content, "name", "namespace", nil, values))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("gotemplateRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.RendererError(err) {
+					t.Errorf("gotemplateRenderer.Render() error = %v, want RendererError", err)
+				}
+				return
+			}
+			out, _ := got.FileContent("main")
+			if out != tt.want {
+				t.Errorf("gotemplateRenderer.Render() = %v, want %v", out, tt.want)
+			}
+		})
+	}
+}
+
+func Test_templateCache_load(t *testing.T) {
+	requests := 0
+	server := remoteTemplateServer(t, &requests)
+	url := server.URL + "/template.tpl"
+	digest := sha256Digest([]byte(remoteTemplate))
+	fetch := func(url string) ([]byte, error) {
+		return fetchTemplate(http.DefaultClient, url)
+	}
+
+	dir := t.TempDir()
+	c := newTemplateCache(dir)
+	for i := 0; i < 3; i++ {
+		got, err := c.load(url, checksumPrefix+digest, fetch)
+		if err != nil || got != remoteTemplate {
+			t.Fatalf("templateCache.load() = %v, %v, want %v", got, err, remoteTemplate)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("templateCache.load() fetched %d times, want 1", requests)
+	}
+
+	// A new cache in the same directory reads the template from disk
+	c = newTemplateCache(dir)
+	if got, err := c.load(url, checksumPrefix+digest, fetch); err != nil || got != remoteTemplate {
+		t.Errorf("templateCache.load() = %v, %v, want %v", got, err, remoteTemplate)
+	}
+	if requests != 1 {
+		t.Errorf("templateCache.load() fetched %d times, want 1", requests)
+	}
+
+	// Corrupt entries on disk are fetched again
+	c = newTemplateCache(dir)
+	if err := os.WriteFile(filepath.Join(dir, digest), []byte("corrupt"), 0600); err != nil {
+		t.Fatalf("failed to corrupt cache entry: %v", err)
+	}
+	if got, err := c.load(url, checksumPrefix+digest, fetch); err != nil || got != remoteTemplate {
+		t.Errorf("templateCache.load() = %v, %v, want %v", got, err, remoteTemplate)
+	}
+	if requests != 2 {
+		t.Errorf("templateCache.load() fetched %d times, want 2", requests)
+	}
+}
@@ -17,40 +17,77 @@ limitations under the License.
 package gotemplate
 
 import (
-	"bytes"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"text/template"
+	"text/template/parse"
 
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// Templates defined with a name starting with fileTemplatePrefix are
+// rendered as separate files of the output, named without the prefix
+const fileTemplatePrefix = "file:"
+
 type gotemplateRenderer struct {
-	funcMap template.FuncMap
+	client       client.Client
+	httpClient   *http.Client
+	rendererType string
 }
 
 type gotemplateInput struct {
-	content string
-	name    string
-	values  map[string]interface{}
+	url       string
+	checksum  string
+	content   string
+	name      string
+	namespace string
+	libraries []osbv1alpha1.TemplateLibraryRef
+	values    map[string]interface{}
 }
 
-// NewInput creates a new gotemplate Renderer input object.
-func NewInput(url, content, name string, values map[string]interface{}) renderer.Input {
-	if content != "" {
+// NewInput creates a new gotemplate Renderer input object. If <content> is
+// blank, the template is fetched from <url> and verified against <checksum>.
+// The lookup function can only read objects from <namespace>. The named
+// templates of <libraries> can be used in the template.
+func NewInput(url, checksum, content, name, namespace string, libraries []osbv1alpha1.TemplateLibraryRef,
+	values map[string]interface{}) renderer.Input {
+	if content != "" || url != "" {
 		return gotemplateInput{
-			content: content,
-			name:    name,
-			values:  values,
+			url:       url,
+			checksum:  checksum,
+			content:   content,
+			name:      name,
+			namespace: namespace,
+			libraries: libraries,
+			values:    values,
 		}
 	}
 
 	return nil
 }
 
-// New creates a new gotemplate Renderer object.
-func New() (renderer.Renderer, error) {
-	return &gotemplateRenderer{funcMap: getFuncMap()}, nil
+// New creates a new gotemplate Renderer object. The client is used by the
+// lookup and secret generation functions and may be nil, in which case
+// lookups find no objects and generated secrets are not persisted.
+func New(c client.Client) (renderer.Renderer, error) {
+	return NewForRenderer(c, "gotemplate")
+}
+
+// NewForRenderer creates a new gotemplate Renderer object for the templates
+// embedded in other renderers, like the values of helm charts. The function
+// policy of <rendererType> applies to the templates.
+func NewForRenderer(c client.Client, rendererType string) (renderer.Renderer, error) {
+	return &gotemplateRenderer{
+		client:       c,
+		httpClient:   &http.Client{Timeout: fetchTimeout},
+		rendererType: rendererType,
+	}, nil
 }
 
 // Render loads the chart from the given location <chartPath> and calls the Render() function
@@ -61,16 +98,106 @@ func (r *gotemplateRenderer) Render(rawInput renderer.Input) (renderer.Output, e
 	if !ok {
 		return nil, errors.NewRendererError("gotemplate", "invalid input", nil)
 	}
-	engine, err := template.New(input.name).Funcs(r.funcMap).Parse(input.content)
+	content := input.content
+	if strings.TrimSpace(content) == "" && input.url != "" {
+		var err error
+		content, err = remoteTemplates.load(input.url, input.checksum, r.fetchTemplate)
+		if err != nil {
+			return nil, errors.NewRendererError("gotemplate", fmt.Sprintf("can't fetch template for %s from %s", input.name, input.url), err)
+		}
+	}
+
+	volatile := &atomic.Bool{}
+	exec := newExecution()
+	sandboxed := sandboxedFuncMap(r.rendererType)
+	engine := template.New(input.name).Funcs(sandboxed).Funcs(r.renderFuncMap(input, exec, volatile))
+	err := loadLibraries(r.client, engine, input.libraries)
+	if err != nil {
+		return nil, errors.NewRendererError("gotemplate", fmt.Sprintf("can't load template libraries for %s", input.name), err)
+	}
+	// File templates of libraries are only rendered as files if the
+	// template redefines them
+	libraryTrees := make(map[string]*parse.Tree)
+	for _, t := range engine.Templates() {
+		libraryTrees[t.Name()] = t.Tree
+	}
+	_, err = engine.Parse(content)
 	if err != nil {
 		return nil, errors.NewRendererError("gotemplate", fmt.Sprintf("can't create template for %s", input.name), err)
 	}
+	instrument(engine, sandboxed)
 
-	buf := new(bytes.Buffer)
-	err = engine.Execute(buf, input.values)
+	buf, err := execute(engine, input.values, exec)
 	if err != nil {
 		return nil, errors.NewRendererError("gotemplate", fmt.Sprintf("can't render template for %s", input.name), err)
 	}
 
-	return &gotemplateOutput{content: *buf}, nil
+	files := make(map[string]string)
+	for _, t := range engine.Templates() {
+		if !strings.HasPrefix(t.Name(), fileTemplatePrefix) {
+			continue
+		}
+		if tree, ok := libraryTrees[t.Name()]; ok && tree == t.Tree {
+			continue
+		}
+		fileName := strings.TrimPrefix(t.Name(), fileTemplatePrefix)
+		if fileName == "" || fileName == mainFile {
+			return nil, errors.NewRendererError("gotemplate", fmt.Sprintf("invalid file name %q in template %s", fileName, input.name), nil)
+		}
+		fileBuf, err := execute(t, input.values, exec)
+		if err != nil {
+			return nil, errors.NewRendererError("gotemplate", fmt.Sprintf("can't render file %s for %s", fileName, input.name), err)
+		}
+		files[fileName] = fileBuf.String()
+	}
+
+	output := &gotemplateOutput{content: *buf, files: files}
+	if volatile.Load() {
+		return renderer.MarkVolatile(output), nil
+	}
+	return output, nil
+}
+
+func (r *gotemplateRenderer) fetchTemplate(url string) ([]byte, error) {
+	httpClient := r.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: fetchTimeout}
+	}
+	return fetchTemplate(httpClient, url)
+}
+
+// renderFuncMap returns the functions bound to the render of input, in
+// addition to the sandboxed functions shared by all renders. They fail once
+// exec is done. volatile is set if the template calls a function whose
+// result depends on the state of the cluster.
+func (r *gotemplateRenderer) renderFuncMap(input gotemplateInput, exec *execution, volatile *atomic.Bool) template.FuncMap {
+	secrets := newSecretGenerator(r.client, input.namespace, input.values)
+	lookup := lookupFunc(r.client, input.namespace)
+	funcMap := template.FuncMap{
+		"lookup": func(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+			if exec.done() {
+				return nil, errCancelled
+			}
+			volatile.Store(true)
+			return lookup(apiVersion, kind, namespace, name)
+		},
+		"stableSecret": func(name string, length int) (string, error) {
+			if exec.done() {
+				return "", errCancelled
+			}
+			return secrets.stableSecret(name, length)
+		},
+		"persistedSecret": func(name string, length int) (string, error) {
+			if exec.done() {
+				return "", errCancelled
+			}
+			volatile.Store(true)
+			return secrets.persistedSecret(name, length)
+		},
+	}
+	funcMap = filterFuncMap(getPolicy(r.rendererType), funcMap)
+	for name, fn := range executionFuncMap(exec) {
+		funcMap[name] = fn
+	}
+	return funcMap
 }
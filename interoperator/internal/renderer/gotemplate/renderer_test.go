@@ -19,17 +19,17 @@ package gotemplate
 import (
 	"reflect"
 	"testing"
-	"text/template"
 
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
 )
 
 func TestNewInput(t *testing.T) {
 	type args struct {
-		url     string
-		content string
-		name    string
-		values  map[string]interface{}
+		url       string
+		content   string
+		name      string
+		namespace string
+		values    map[string]interface{}
 	}
 	tests := []struct {
 		name string
@@ -39,15 +39,17 @@ func TestNewInput(t *testing.T) {
 		{
 			name: "return renderer input",
 			args: args{
-				url:     "",
-				content: "content",
-				name:    "name",
-				values:  nil,
+				url:       "",
+				content:   "content",
+				name:      "name",
+				namespace: "namespace",
+				values:    nil,
 			},
 			want: gotemplateInput{
-				content: "content",
-				name:    "name",
-				values:  nil,
+				content:   "content",
+				name:      "name",
+				namespace: "namespace",
+				values:    nil,
 			},
 		},
 		{
@@ -63,7 +65,7 @@ func TestNewInput(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewInput(tt.args.url, tt.args.content, tt.args.name, tt.args.values); !reflect.DeepEqual(got, tt.want) {
+			if got := NewInput(tt.args.url, "", tt.args.content, tt.args.name, tt.args.namespace, nil, tt.args.values); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewInput() = %v, want %v", got, tt.want)
 			}
 		})
@@ -82,7 +84,7 @@ func TestNew(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := New()
+			got, err := New(nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -95,19 +97,14 @@ func TestNew(t *testing.T) {
 }
 
 func Test_gotemplateRenderer_Render(t *testing.T) {
-	funcMap := getFuncMap()
 	values := make(map[string]interface{})
 	values["value"] = "world"
 
-	type fields struct {
-		funcMap template.FuncMap
-	}
 	type args struct {
 		rawInput renderer.Input
 	}
 	tests := []struct {
 		name    string
-		fields  fields
 		args    args
 		want    bool
 		wantErr bool
@@ -115,9 +112,6 @@ func Test_gotemplateRenderer_Render(t *testing.T) {
 	}{
 		{
 			name: "fail on invalid input",
-			fields: fields{
-				funcMap: funcMap,
-			},
 			args: args{
 				rawInput: nil,
 			},
@@ -126,9 +120,6 @@ func Test_gotemplateRenderer_Render(t *testing.T) {
 		},
 		{
 			name: "fail on invalid template",
-			fields: fields{
-				funcMap: funcMap,
-			},
 			args: args{
 				rawInput: gotemplateInput{
 					content: "content{{sd",
@@ -141,9 +132,6 @@ func Test_gotemplateRenderer_Render(t *testing.T) {
 		},
 		{
 			name: "fail on render fail",
-			fields: fields{
-				funcMap: funcMap,
-			},
 			args: args{
 				rawInput: gotemplateInput{
 					content: "{{ .value | .func }}",
@@ -156,9 +144,6 @@ func Test_gotemplateRenderer_Render(t *testing.T) {
 		},
 		{
 			name: "render go template",
-			fields: fields{
-				funcMap: funcMap,
-			},
 			args: args{
 				rawInput: gotemplateInput{
 					content: "hello {{ .value }}",
@@ -174,7 +159,7 @@ func Test_gotemplateRenderer_Render(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &gotemplateRenderer{
-				funcMap: tt.fields.funcMap,
+				rendererType: "gotemplate",
 			}
 			got, err := r.Render(tt.args.rawInput)
 			if (err != nil) != tt.wantErr {
@@ -195,3 +180,66 @@ func Test_gotemplateRenderer_Render(t *testing.T) {
 		})
 	}
 }
+
+func Test_gotemplateRenderer_Render_files(t *testing.T) {
+	values := map[string]interface{}{"value": "world"}
+	tests := []struct {
+		name      string
+		content   string
+		wantFiles map[string]string
+		wantErr   bool
+	}{
+		{
+			name: "render file templates as separate files",
+			content: `{{- define "greeting" }}hello {{ .value }}{{ end }}
+{{- define "file:status.yaml" }}state: {{ template "greeting" . }}{{ end }}
+{{- define "file:secret.yaml" }}name: {{ .value }}{{ end }}`,
+			wantFiles: map[string]string{
+				"status.yaml": "state: hello world",
+				"secret.yaml": "name: world",
+			},
+		},
+		{
+			name: "render main file along with file templates",
+			content: `main {{ .value }}
+{{- define "file:a.yaml" }}a{{ end }}`,
+			wantFiles: map[string]string{
+				"main":   "main world",
+				"a.yaml": "a",
+			},
+		},
+		{
+			name:    "fail on empty file name",
+			content: `{{ define "file:" }}a{{ end }}`,
+			wantErr: true,
+		},
+		{
+			name:    "fail if file template fails",
+			content: `{{ define "file:a.yaml" }}{{ .value | .func }}{{ end }}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := New(nil)
+			got, err := r.Render(NewInput("", "", tt.content, "name", "namespace", nil, values))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("gotemplateRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			files, _ := got.ListFiles()
+			if len(files) != len(tt.wantFiles) {
+				t.Errorf("gotemplateRenderer.Render() files = %v, want %v", files, tt.wantFiles)
+			}
+			for _, file := range files {
+				content, err := got.FileContent(file)
+				if err != nil || content != tt.wantFiles[file] {
+					t.Errorf("gotemplateRenderer.Render() file %s = %v, want %v", file, content, tt.wantFiles[file])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// maxSequenceLength is the upper bound for the number of elements of
+	// the sequences created by templates with until, untilStep and seq
+	maxSequenceLength = 1 << 20
+
+	// checkFunc is the function called at the start of each template and
+	// each iteration of range loops to stop cancelled executions
+	checkFunc = "sandboxCheck"
+
+	// executionFunc is the function returning the execution of a render,
+	// which is passed to the sandboxed functions as their first argument
+	executionFunc = "sandboxExecution"
+)
+
+var errCancelled = fmt.Errorf("template execution cancelled")
+
+var executionType = reflect.TypeOf(&execution{})
+
+// The defaults of the interoperator config are used until the limits are
+// set
+var (
+	defaultTimeout, _    = time.ParseDuration(constants.DefaultTemplateTimeout)
+	defaultMaxOutputSize = resource.MustParse(constants.DefaultTemplateMaxOutputSize)
+)
+
+// DefaultFunctionDenyList is the list of functions which are not available
+// to templates unless they are in the allow list of the renderer type.
+// They expose the environment of the interoperator.
+var DefaultFunctionDenyList = []string{"env", "expandenv"}
+
+// FunctionPolicy restricts the functions available to templates. If
+// AllowList is not empty, only the functions in it are available. The
+// functions in DenyList are never available.
+type FunctionPolicy struct {
+	AllowList []string
+	DenyList  []string
+}
+
+// sandbox holds the function policies per renderer type and the limits
+// shared by all gotemplate renderers. The sandboxed functions per renderer
+// type are built once for them.
+var sandbox = struct {
+	sync.RWMutex
+	policies      map[string]FunctionPolicy
+	timeout       time.Duration
+	maxOutputSize int64
+	funcMaps      map[string]template.FuncMap
+}{
+	timeout:       defaultTimeout,
+	maxOutputSize: defaultMaxOutputSize.Value(),
+}
+
+// SetFunctionPolicies sets the function policies per renderer type. The
+// templates of renderer types without a policy can use all functions
+// except those in DefaultFunctionDenyList.
+func SetFunctionPolicies(policies map[string]FunctionPolicy) {
+	sandbox.Lock()
+	defer sandbox.Unlock()
+	sandbox.policies = make(map[string]FunctionPolicy, len(policies))
+	for rendererType, policy := range policies {
+		sandbox.policies[rendererType] = policy
+	}
+	sandbox.funcMaps = nil
+}
+
+// SetLimits sets the execution time and output size limits of templates.
+// A value less than or equal to zero disables the limit.
+func SetLimits(timeout time.Duration, maxOutputSize int64) {
+	sandbox.Lock()
+	defer sandbox.Unlock()
+	sandbox.timeout = timeout
+	sandbox.maxOutputSize = maxOutputSize
+	sandbox.funcMaps = nil
+}
+
+func getLimits() (time.Duration, int64) {
+	sandbox.RLock()
+	defer sandbox.RUnlock()
+	return sandbox.timeout, sandbox.maxOutputSize
+}
+
+func getPolicy(rendererType string) FunctionPolicy {
+	sandbox.RLock()
+	defer sandbox.RUnlock()
+	return sandbox.policies[rendererType]
+}
+
+// filterFuncMap returns the functions of funcMap permitted by policy
+func filterFuncMap(policy FunctionPolicy, funcMap template.FuncMap) template.FuncMap {
+	allowed := make(map[string]bool, len(policy.AllowList))
+	for _, name := range policy.AllowList {
+		allowed[name] = true
+	}
+	denied := make(map[string]bool, len(policy.DenyList)+len(DefaultFunctionDenyList))
+	for _, name := range DefaultFunctionDenyList {
+		denied[name] = !allowed[name]
+	}
+	for _, name := range policy.DenyList {
+		denied[name] = true
+	}
+
+	filtered := make(template.FuncMap, len(funcMap))
+	for name, fn := range funcMap {
+		if denied[name] || (len(allowed) > 0 && !allowed[name]) {
+			continue
+		}
+		filtered[name] = fn
+	}
+	return filtered
+}
+
+// execution is the state of the execution of the templates of a render,
+// which share the time and output size limits. Once it is cancelled,
+// writes to the output, function calls and iterations of range loops fail.
+type execution struct {
+	timeout       time.Duration
+	deadline      time.Time
+	maxOutputSize int64
+	written       atomic.Int64
+	cancelled     atomic.Bool
+}
+
+// newExecution starts an execution within the configured limits
+func newExecution() *execution {
+	timeout, maxOutputSize := getLimits()
+	exec := &execution{
+		timeout:       timeout,
+		maxOutputSize: maxOutputSize,
+	}
+	if timeout > 0 {
+		exec.deadline = time.Now().Add(timeout)
+	}
+	return exec
+}
+
+// done returns whether e is cancelled or past its deadline
+func (e *execution) done() bool {
+	if e.cancelled.Load() {
+		return true
+	}
+	return e.timeout > 0 && time.Now().After(e.deadline)
+}
+
+func (e *execution) check() (string, error) {
+	if e.done() {
+		return "", errCancelled
+	}
+	return "", nil
+}
+
+// executionFuncMap returns the functions of a render bound to exec. The
+// sandboxed functions get exec from the execution function.
+func executionFuncMap(exec *execution) template.FuncMap {
+	return template.FuncMap{
+		checkFunc: exec.check,
+		executionFunc: func() *execution {
+			return exec
+		},
+	}
+}
+
+// sandboxedFuncMap returns the functions of getFuncMap permitted by the
+// policy of the renderer type, with the sizes of created sequences and
+// strings limited and wrapped to fail once the execution passed as their
+// first argument is done. The functions are built once per renderer type
+// and configuration and shared by all renders, which pass their execution
+// through the call inserted by instrument.
+func sandboxedFuncMap(rendererType string) template.FuncMap {
+	sandbox.RLock()
+	funcMap, ok := sandbox.funcMaps[rendererType]
+	sandbox.RUnlock()
+	if ok {
+		return funcMap
+	}
+
+	sandbox.Lock()
+	defer sandbox.Unlock()
+	if funcMap, ok := sandbox.funcMaps[rendererType]; ok {
+		return funcMap
+	}
+	limited := limitSequences(filterFuncMap(sandbox.policies[rendererType], getFuncMap()), sandbox.maxOutputSize)
+	funcMap = make(template.FuncMap, len(limited))
+	for name, fn := range limited {
+		funcMap[name] = cancellable(fn)
+	}
+	if sandbox.funcMaps == nil {
+		sandbox.funcMaps = make(map[string]template.FuncMap)
+	}
+	sandbox.funcMaps[rendererType] = funcMap
+	return funcMap
+}
+
+// cancellable wraps fn in a function taking the execution of the render as
+// first argument, which fails once the execution is done. Templates recover
+// panics of functions as errors.
+func cancellable(fn interface{}) interface{} {
+	v := reflect.ValueOf(fn)
+	fnType := v.Type()
+	in := make([]reflect.Type, 0, fnType.NumIn()+1)
+	in = append(in, executionType)
+	for i := 0; i < fnType.NumIn(); i++ {
+		in = append(in, fnType.In(i))
+	}
+	out := make([]reflect.Type, 0, fnType.NumOut())
+	for i := 0; i < fnType.NumOut(); i++ {
+		out = append(out, fnType.Out(i))
+	}
+	variadic := fnType.IsVariadic()
+	return reflect.MakeFunc(reflect.FuncOf(in, out, variadic), func(args []reflect.Value) []reflect.Value {
+		if args[0].Interface().(*execution).done() {
+			panic(errCancelled)
+		}
+		if variadic {
+			return v.CallSlice(args[1:])
+		}
+		return v.Call(args[1:])
+	}).Interface()
+}
+
+// limitSequences returns funcMap with the functions creating sequences and
+// repeated strings replaced by functions failing for sizes above
+// maxSequenceLength and maxOutputSize respectively
+func limitSequences(funcMap template.FuncMap, maxOutputSize int64) template.FuncMap {
+	limited := make(template.FuncMap, len(funcMap))
+	for name, fn := range funcMap {
+		limited[name] = fn
+	}
+	checkLength := func(length int) error {
+		if length > maxSequenceLength || -length > maxSequenceLength {
+			return fmt.Errorf("sequence length %d exceeds %d", length, maxSequenceLength)
+		}
+		return nil
+	}
+	steps := func(start, stop, step int) int {
+		if step == 0 {
+			return 0
+		}
+		return (stop - start) / step
+	}
+	if until, ok := funcMap["until"].(func(int) []int); ok {
+		limited["until"] = func(count int) ([]int, error) {
+			if err := checkLength(count); err != nil {
+				return nil, err
+			}
+			return until(count), nil
+		}
+	}
+	if untilStep, ok := funcMap["untilStep"].(func(int, int, int) []int); ok {
+		limited["untilStep"] = func(start, stop, step int) ([]int, error) {
+			if err := checkLength(steps(start, stop, step)); err != nil {
+				return nil, err
+			}
+			return untilStep(start, stop, step), nil
+		}
+	}
+	if seq, ok := funcMap["seq"].(func(...int) string); ok {
+		limited["seq"] = func(params ...int) (string, error) {
+			length := 0
+			switch len(params) {
+			case 1:
+				length = params[0]
+			case 2:
+				length = params[1] - params[0]
+			case 3:
+				length = steps(params[0], params[2], params[1])
+			}
+			if err := checkLength(length); err != nil {
+				return "", err
+			}
+			return seq(params...), nil
+		}
+	}
+	if repeat, ok := funcMap["repeat"].(func(int, string) string); ok && maxOutputSize > 0 {
+		limited["repeat"] = func(count int, str string) (string, error) {
+			if count > 0 && int64(len(str)) > maxOutputSize/int64(count) {
+				return "", fmt.Errorf("repeated string exceeds %d bytes", maxOutputSize)
+			}
+			return repeat(count, str), nil
+		}
+	}
+	return limited
+}
+
+// instrument inserts a call of the check function at the start of all
+// templates associated with engine and of each iteration of their range
+// loops, so that executions which neither write nor call functions, like
+// empty loops or recursive templates, are stopped when cancelled. The
+// calls of the functions in sandboxed get the execution of the render as
+// first argument.
+func instrument(engine *template.Template, sandboxed template.FuncMap) {
+	visited := make(map[*parse.Tree]bool)
+	for _, t := range engine.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil || visited[t.Tree] {
+			continue
+		}
+		visited[t.Tree] = true
+		instrumentList(t.Tree.Root, sandboxed)
+	}
+}
+
+func instrumentList(list *parse.ListNode, sandboxed template.FuncMap) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			instrumentPipe(n.Pipe, sandboxed)
+		case *parse.TemplateNode:
+			instrumentPipe(n.Pipe, sandboxed)
+		case *parse.IfNode:
+			instrumentPipe(n.Pipe, sandboxed)
+			instrumentList(n.List, sandboxed)
+			instrumentList(n.ElseList, sandboxed)
+		case *parse.WithNode:
+			instrumentPipe(n.Pipe, sandboxed)
+			instrumentList(n.List, sandboxed)
+			instrumentList(n.ElseList, sandboxed)
+		case *parse.RangeNode:
+			instrumentPipe(n.Pipe, sandboxed)
+			instrumentList(n.List, sandboxed)
+			instrumentList(n.ElseList, sandboxed)
+		case *parse.ListNode:
+			instrumentList(n, sandboxed)
+		}
+	}
+	pos := list.Position()
+	check := &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      pos,
+				Args:     []parse.Node{parse.NewIdentifier(checkFunc).SetPos(pos)},
+			}},
+		},
+	}
+	list.Nodes = append([]parse.Node{check}, list.Nodes...)
+}
+
+// instrumentPipe passes the execution to the calls of the functions in
+// sandboxed within pipe
+func instrumentPipe(pipe *parse.PipeNode, sandboxed template.FuncMap) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		// Functions naming a command are called with its arguments
+		name, isFunc := cmd.Args[0].(*parse.IdentifierNode)
+		for i, arg := range cmd.Args {
+			if i > 0 || !isFunc {
+				cmd.Args[i] = instrumentArg(arg, sandboxed)
+			}
+		}
+		if !isFunc {
+			continue
+		}
+		if _, ok := sandboxed[name.Ident]; ok {
+			args := []parse.Node{name, parse.NewIdentifier(executionFunc).SetPos(name.Pos)}
+			cmd.Args = append(args, cmd.Args[1:]...)
+		}
+	}
+}
+
+// instrumentArg returns arg with the execution passed to the calls of the
+// functions in sandboxed. Functions used as arguments are called without
+// arguments and are replaced by pipes calling them with the execution.
+func instrumentArg(arg parse.Node, sandboxed template.FuncMap) parse.Node {
+	switch n := arg.(type) {
+	case *parse.IdentifierNode:
+		if _, ok := sandboxed[n.Ident]; !ok {
+			return n
+		}
+		return &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      n.Pos,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{n, parse.NewIdentifier(executionFunc).SetPos(n.Pos)},
+			}},
+		}
+	case *parse.ChainNode:
+		n.Node = instrumentArg(n.Node, sandboxed)
+	case *parse.PipeNode:
+		instrumentPipe(n, sandboxed)
+	}
+	return arg
+}
+
+// limitedWriter is a buffer which fails writes exceeding the output size
+// limit of the execution or after the execution is cancelled
+type limitedWriter struct {
+	buf  bytes.Buffer
+	exec *execution
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.exec.done() {
+		return 0, errCancelled
+	}
+	written := w.exec.written.Add(int64(len(p)))
+	if w.exec.maxOutputSize > 0 && written > w.exec.maxOutputSize {
+		return 0, fmt.Errorf("template output exceeds %d bytes", w.exec.maxOutputSize)
+	}
+	return w.buf.Write(p)
+}
+
+// execute runs the template within the remaining limits of exec. On
+// timeout, exec is cancelled, which stops the template at its next write,
+// function call or loop iteration.
+func execute(engine *template.Template, values map[string]interface{}, exec *execution) (*bytes.Buffer, error) {
+	w := &limitedWriter{exec: exec}
+	if exec.timeout <= 0 {
+		err := engine.Execute(w, values)
+		return &w.buf, err
+	}
+
+	remaining := time.Until(exec.deadline)
+	if remaining <= 0 {
+		exec.cancelled.Store(true)
+		return nil, fmt.Errorf("template execution exceeded %s", exec.timeout)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- engine.Execute(w, values)
+	}()
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return &w.buf, err
+	case <-timer.C:
+		exec.cancelled.Store(true)
+		return nil, fmt.Errorf("template execution exceeded %s", exec.timeout)
+	}
+}
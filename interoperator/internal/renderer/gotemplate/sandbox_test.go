@@ -0,0 +1,285 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func Test_gotemplateRenderer_Render_functionPolicy(t *testing.T) {
+	defer SetFunctionPolicies(nil)
+
+	tests := []struct {
+		name         string
+		rendererType string
+		policies     map[string]FunctionPolicy
+		content      string
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:         "deny env by default",
+			rendererType: "gotemplate",
+			content:      `{{ env "HOME" }}`,
+			wantErr:      true,
+		},
+		{
+			name:         "deny expandenv by default",
+			rendererType: "helm",
+			content:      `{{ expandenv "$HOME" }}`,
+			wantErr:      true,
+		},
+		{
+			name:         "allow env if in allow list",
+			rendererType: "gotemplate",
+			policies: map[string]FunctionPolicy{
+				"gotemplate": {AllowList: []string{"env", "upper"}},
+			},
+			content: `{{ env "INTEROPERATOR_SANDBOX_TEST" | upper }}`,
+			want:    "VALUE",
+		},
+		{
+			name:         "deny functions not in allow list",
+			rendererType: "gotemplate",
+			policies: map[string]FunctionPolicy{
+				"gotemplate": {AllowList: []string{"upper"}},
+			},
+			content: `{{ "a" | lower }}`,
+			wantErr: true,
+		},
+		{
+			name:         "deny functions in deny list",
+			rendererType: "gotemplate",
+			policies: map[string]FunctionPolicy{
+				"gotemplate": {DenyList: []string{"lookup"}},
+			},
+			content: `{{ lookup "v1" "Secret" "" "a" }}`,
+			wantErr: true,
+		},
+		{
+			name:         "apply policy of the renderer type only",
+			rendererType: "kustomize",
+			policies: map[string]FunctionPolicy{
+				"gotemplate": {DenyList: []string{"upper"}},
+			},
+			content: `{{ "a" | upper }}`,
+			want:    "A",
+		},
+	}
+	t.Setenv("INTEROPERATOR_SANDBOX_TEST", "value")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetFunctionPolicies(tt.policies)
+			r, _ := NewForRenderer(nil, tt.rendererType)
+			got, err := r.Render(NewInput("", "", tt.content, "name", "namespace", nil, nil))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("gotemplateRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			out, _ := got.FileContent("main")
+			if out != tt.want {
+				t.Errorf("gotemplateRenderer.Render() = %v, want %v", out, tt.want)
+			}
+		})
+	}
+}
+
+func Test_gotemplateRenderer_Render_limits(t *testing.T) {
+	defer SetLimits(defaultTimeout, defaultMaxOutputSize.Value())
+
+	tests := []struct {
+		name          string
+		timeout       time.Duration
+		maxOutputSize int64
+		content       string
+		wantErr       bool
+	}{
+		{
+			name:          "render within limits",
+			timeout:       time.Second,
+			maxOutputSize: 10,
+			content:       `{{ range until 10 }}x{{ end }}`,
+		},
+		{
+			name:          "fail if output size exceeded",
+			timeout:       time.Second,
+			maxOutputSize: 10,
+			content:       `{{ range until 11 }}x{{ end }}`,
+			wantErr:       true,
+		},
+		{
+			name:          "fail if output size of files exceeded",
+			timeout:       time.Second,
+			maxOutputSize: 10,
+			content:       `{{ range until 6 }}x{{ end }}{{ define "file:a.yaml" }}{{ range until 5 }}x{{ end }}{{ end }}`,
+			wantErr:       true,
+		},
+		{
+			name:    "fail if timeout exceeded",
+			timeout: 10 * time.Millisecond,
+			content: `{{ range until 1000000 }}{{ range until 1000 }}x{{ end }}{{ end }}`,
+			wantErr: true,
+		},
+		{
+			name:    "fail if sequence too long",
+			content: `{{ range until 100000000 }}x{{ end }}`,
+			wantErr: true,
+		},
+		{
+			name:          "fail if repeated string too long",
+			maxOutputSize: 10,
+			content:       `{{ $x := repeat 11 "x" }}`,
+			wantErr:       true,
+		},
+		{
+			name:    "render without limits",
+			content: `{{ range until 1000 }}x{{ end }}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetLimits(tt.timeout, tt.maxOutputSize)
+			r, _ := New(nil)
+			_, err := r.Render(NewInput("", "", tt.content, "name", "namespace", nil, nil))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("gotemplateRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_gotemplateRenderer_Render_cancel(t *testing.T) {
+	defer SetLimits(defaultTimeout, defaultMaxOutputSize.Value())
+	SetLimits(10*time.Millisecond, 0)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "stop loop without output",
+			content: `{{ $s := until 100000 }}{{ range $s }}{{ range $s }}{{ range $s }}{{ end }}{{ end }}{{ end }}`,
+		},
+		{
+			name:    "stop function calls without output",
+			content: `{{ $s := until 100000 }}{{ range $s }}{{ range $s }}{{ $x := sha256sum "x" }}{{ end }}{{ end }}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goroutines := runtime.NumGoroutine()
+			r, _ := New(nil)
+			_, err := r.Render(NewInput("", "", tt.content, "name", "namespace", nil, nil))
+			if err == nil {
+				t.Fatalf("gotemplateRenderer.Render() error = nil, want timeout")
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for runtime.NumGoroutine() > goroutines {
+				if time.Now().After(deadline) {
+					t.Fatalf("template execution not stopped after timeout")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func Test_gotemplateRenderer_Render_sandboxedCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "call function with arguments",
+			content: `{{ upper "x" }}`,
+			want:    "X",
+		},
+		{
+			name:    "call function in pipeline",
+			content: `{{ "x" | upper | repeat 2 }}`,
+			want:    "XX",
+		},
+		{
+			name:    "call function in parenthesized pipeline",
+			content: `{{ printf "%s-%s" (lower "X") ("Y" | lower) }}`,
+			want:    "x-y",
+		},
+		{
+			name:    "call function without arguments as argument",
+			content: `{{ list uuidv4 | len }}`,
+			want:    "1",
+		},
+		{
+			name:    "call function in chain",
+			content: `{{ gt now.Year 2000 }}`,
+			want:    "true",
+		},
+		{
+			name:    "call function in control structures",
+			content: `{{ if empty "" }}{{ range until 2 }}{{ with add . 1 }}{{ . }}{{ end }}{{ end }}{{ end }}`,
+			want:    "12",
+		},
+		{
+			name:    "call function in named templates",
+			content: `{{ define "t" }}{{ . | upper }}{{ end }}{{ template "t" (lower "X") }}`,
+			want:    "X",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := New(nil)
+			got, err := r.Render(NewInput("", "", tt.content, "name", "namespace", nil, nil))
+			if err != nil {
+				t.Fatalf("gotemplateRenderer.Render() error = %v", err)
+			}
+			out, _ := got.FileContent("main")
+			if out != tt.want {
+				t.Errorf("gotemplateRenderer.Render() = %v, want %v", out, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sandboxedFuncMap(t *testing.T) {
+	defer SetLimits(defaultTimeout, defaultMaxOutputSize.Value())
+	defer SetFunctionPolicies(nil)
+
+	funcMap := sandboxedFuncMap("gotemplate")
+	if reflect.ValueOf(sandboxedFuncMap("gotemplate")).Pointer() != reflect.ValueOf(funcMap).Pointer() {
+		t.Errorf("sandboxedFuncMap() built again for the same configuration")
+	}
+
+	SetFunctionPolicies(map[string]FunctionPolicy{
+		"gotemplate": {DenyList: []string{"upper"}},
+	})
+	if _, ok := sandboxedFuncMap("gotemplate")["upper"]; ok {
+		t.Errorf("sandboxedFuncMap() not built again after the function policies changed")
+	}
+
+	funcMap = sandboxedFuncMap("gotemplate")
+	SetLimits(time.Second, 0)
+	if reflect.ValueOf(sandboxedFuncMap("gotemplate")).Pointer() == reflect.ValueOf(funcMap).Pointer() {
+		t.Errorf("sandboxedFuncMap() not built again after the limits changed")
+	}
+}
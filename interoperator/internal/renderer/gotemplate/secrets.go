@@ -0,0 +1,262 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"sync"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Key of the master key in the secret generator key secret
+	secretGeneratorKey = "key"
+
+	// Upper bound for the length of a generated secret
+	maxGeneratedSecretLength = 1024
+
+	secretCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// secretGeneratorKeySecret is the name of the secret in the interoperator
+// namespace holding the master key. It is shared by all gotemplate renderers.
+var secretGeneratorKeySecret = struct {
+	sync.RWMutex
+	name string
+}{
+	name: constants.DefaultSecretGeneratorKeySecret,
+}
+
+// SetSecretGeneratorKeySecret sets the name of the secret in the
+// interoperator namespace which holds the master key used for generating
+// secrets in templates
+func SetSecretGeneratorKeySecret(name string) {
+	secretGeneratorKeySecret.Lock()
+	defer secretGeneratorKeySecret.Unlock()
+	secretGeneratorKeySecret.name = name
+}
+
+// NewSecretGeneratorKeySecret returns the secret holding key as the master
+// key used for generating secrets in templates
+func NewSecretGeneratorKeySecret(key string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getSecretGeneratorKeySecret(),
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Data: map[string][]byte{secretGeneratorKey: []byte(key)},
+	}
+}
+
+func getSecretGeneratorKeySecret() string {
+	secretGeneratorKeySecret.RLock()
+	defer secretGeneratorKeySecret.RUnlock()
+	return secretGeneratorKeySecret.name
+}
+
+// GeneratedSecretName returns the name of the secret in which the values
+// generated by persistedSecret are stored for the instance
+func GeneratedSecretName(instanceID string) string {
+	return fmt.Sprintf("%s-generated-secrets", instanceID)
+}
+
+// secretGenerator implements the secret generation template functions for
+// a render. The generated values are derived from the instance ID and the
+// master key, so that every render of the instance gets the same values.
+type secretGenerator struct {
+	client    client.Client
+	namespace string
+	values    map[string]interface{}
+
+	// The master key is read on first use
+	masterKey []byte
+	loaded    bool
+}
+
+func newSecretGenerator(c client.Client, namespace string, values map[string]interface{}) *secretGenerator {
+	return &secretGenerator{
+		client:    c,
+		namespace: namespace,
+		values:    values,
+	}
+}
+
+// stableSecret returns an alphanumeric string of the given length derived
+// from the instance ID, <name> and the master key. Without a client, as
+// is the case when rendering offline, an empty master key is used.
+func (g *secretGenerator) stableSecret(name string, length int) (string, error) {
+	if length <= 0 || length > maxGeneratedSecretLength {
+		return "", fmt.Errorf("invalid length %d for generated secret %s", length, name)
+	}
+	instance, err := g.instance()
+	if err != nil {
+		return "", err
+	}
+	masterKey, err := g.getMasterKey()
+	if err != nil {
+		return "", err
+	}
+	return deriveSecret(masterKey, instance.GetName()+"/"+name, length), nil
+}
+
+// persistedSecret returns the value stored under <name> in the generated
+// secrets secret of the instance. If it is not found, the value of
+// stableSecret is stored and returned. The secret is owned by the
+// instance, so it is deleted along with it.
+func (g *secretGenerator) persistedSecret(name string, length int) (string, error) {
+	value, err := g.stableSecret(name, length)
+	if err != nil || g.client == nil {
+		return value, err
+	}
+	instance, err := g.instance()
+	if err != nil {
+		return "", err
+	}
+
+	secretKey := types.NamespacedName{
+		Name:      GeneratedSecretName(instance.GetName()),
+		Namespace: g.namespace,
+	}
+	return g.storeSecret(secretKey, instance, name, value, 0)
+}
+
+// storeSecret returns the value stored under <name> in the secret with
+// secretKey, storing <value> if there is none. Concurrent renders of the
+// instance may create or update the secret at the same time, in which case
+// the stored value is read again.
+func (g *secretGenerator) storeSecret(secretKey types.NamespacedName, instance *unstructured.Unstructured,
+	name, value string, retryCount int) (string, error) {
+	secret := &corev1.Secret{}
+	err := g.client.Get(context.TODO(), secretKey, secret)
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return "", err
+	}
+	if err == nil {
+		if stored, ok := secret.Data[name]; ok {
+			return string(stored), nil
+		}
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[name] = []byte(value)
+		err = g.client.Update(context.TODO(), secret)
+		if err != nil {
+			if apiErrors.IsConflict(err) && retryCount < constants.ErrorThreshold {
+				return g.storeSecret(secretKey, instance, name, value, retryCount+1)
+			}
+			return "", err
+		}
+		return value, nil
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretKey.Name,
+			Namespace: secretKey.Namespace,
+		},
+		Data: map[string][]byte{
+			name: []byte(value),
+		},
+	}
+	if instance.GetUID() != "" && instance.GetNamespace() == g.namespace {
+		secret.SetOwnerReferences([]metav1.OwnerReference{
+			*metav1.NewControllerRef(instance, osbv1alpha1.GroupVersion.WithKind("SFServiceInstance")),
+		})
+	}
+	err = g.client.Create(context.TODO(), secret)
+	if err != nil {
+		if apiErrors.IsAlreadyExists(err) && retryCount < constants.ErrorThreshold {
+			return g.storeSecret(secretKey, instance, name, value, retryCount+1)
+		}
+		return "", err
+	}
+	return value, nil
+}
+
+func (g *secretGenerator) instance() (*unstructured.Unstructured, error) {
+	instance, ok := g.values["instance"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("instance not found for generating secret")
+	}
+	obj := &unstructured.Unstructured{Object: instance}
+	if obj.GetName() == "" {
+		return nil, fmt.Errorf("instance id not found for generating secret")
+	}
+	return obj, nil
+}
+
+func (g *secretGenerator) getMasterKey() ([]byte, error) {
+	if g.loaded || g.client == nil {
+		return g.masterKey, nil
+	}
+
+	secret := &corev1.Secret{}
+	secretKey := types.NamespacedName{
+		Name:      getSecretGeneratorKeySecret(),
+		Namespace: constants.InteroperatorNamespace,
+	}
+	err := g.client.Get(context.TODO(), secretKey, secret)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("secret generator key secret %s not found in namespace %s. It must exist in every cluster rendering templates that generate secrets",
+				secretKey.Name, secretKey.Namespace)
+		}
+		return nil, fmt.Errorf("failed to read secret generator key %s. %v", secretKey.Name, err)
+	}
+	masterKey, ok := secret.Data[secretGeneratorKey]
+	if !ok || len(masterKey) == 0 {
+		return nil, fmt.Errorf("key %s not found in secret %s", secretGeneratorKey, secretKey.Name)
+	}
+	g.masterKey = masterKey
+	g.loaded = true
+	return g.masterKey, nil
+}
+
+// deriveSecret returns an alphanumeric string of the given length using
+// HMAC-SHA256 as a pseudo random function. Bytes which would bias the
+// distribution of the characters are skipped.
+func deriveSecret(masterKey []byte, seed string, length int) string {
+	limit := 256 - (256 % len(secretCharset))
+	out := make([]byte, 0, length)
+	for counter := 0; len(out) < length; counter++ {
+		mac := hmac.New(sha256.New, masterKey)
+		mac.Write([]byte(seed + "/" + strconv.Itoa(counter)))
+		for _, b := range mac.Sum(nil) {
+			if int(b) >= limit {
+				continue
+			}
+			out = append(out, secretCharset[int(b)%len(secretCharset)])
+			if len(out) == length {
+				break
+			}
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func instanceValues(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"instance": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":      id,
+				"namespace": "sf-" + id,
+				"uid":       "uid-" + id,
+			},
+		},
+	}
+}
+
+func masterKeySecret(key string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      constants.DefaultSecretGeneratorKeySecret,
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Data: map[string][]byte{secretGeneratorKey: []byte(key)},
+	}
+}
+
+func renderSecret(t *testing.T, c client.Client, id, content string) (string, error) {
+	r, _ := New(c)
+	got, err := r.Render(NewInput("", "", content, "name", "sf-"+id, nil, instanceValues(id)))
+	if err != nil {
+		return "", err
+	}
+	out, err := got.FileContent("main")
+	if err != nil {
+		t.Fatalf("gotemplateRenderer.Render() did not return main file: %v", err)
+	}
+	return out, nil
+}
+
+func Test_deriveSecret(t *testing.T) {
+	a := deriveSecret([]byte("key"), "instance/password", 64)
+	if len(a) != 64 {
+		t.Errorf("deriveSecret() length = %d, want 64", len(a))
+	}
+	for _, ch := range a {
+		if !strings.ContainsRune(secretCharset, ch) {
+			t.Errorf("deriveSecret() = %s, contains invalid character %c", a, ch)
+		}
+	}
+	if b := deriveSecret([]byte("key"), "instance/password", 64); a != b {
+		t.Errorf("deriveSecret() = %s, want %s", b, a)
+	}
+	if b := deriveSecret([]byte("other"), "instance/password", 64); a == b {
+		t.Errorf("deriveSecret() returned the same value for a different key")
+	}
+	if b := deriveSecret([]byte("key"), "instance/password", 16); b != a[:16] {
+		t.Errorf("deriveSecret() = %s, want prefix %s", b, a[:16])
+	}
+}
+
+func Test_gotemplateRenderer_Render_stableSecret(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(masterKeySecret("master-key")).Build()
+
+	first, err := renderSecret(t, c, "instance-1", `{{ stableSecret "password" 32 }}`)
+	if err != nil || len(first) != 32 {
+		t.Fatalf("gotemplateRenderer.Render() = %v, %v, want secret of length 32", first, err)
+	}
+	if got, _ := renderSecret(t, c, "instance-1", `{{ stableSecret "password" 32 }}`); got != first {
+		t.Errorf("gotemplateRenderer.Render() = %v, want %v", got, first)
+	}
+	if got, _ := renderSecret(t, c, "instance-2", `{{ stableSecret "password" 32 }}`); got == first {
+		t.Errorf("gotemplateRenderer.Render() returned the same secret for a different instance")
+	}
+	if got, _ := renderSecret(t, c, "instance-1", `{{ stableSecret "username" 32 }}`); got == first {
+		t.Errorf("gotemplateRenderer.Render() returned the same secret for a different name")
+	}
+	if got, _ := renderSecret(t, nil, "instance-1", `{{ stableSecret "password" 32 }}`); got == first || len(got) != 32 {
+		t.Errorf("gotemplateRenderer.Render() without client = %v, want secret derived from empty key", got)
+	}
+
+	failures := []struct {
+		name    string
+		client  client.Client
+		content string
+	}{
+		{
+			name:    "fail on invalid length",
+			client:  c,
+			content: `{{ stableSecret "password" 0 }}`,
+		},
+		{
+			name:    "fail if master key secret is missing",
+			client:  fake.NewClientBuilder().Build(),
+			content: `{{ stableSecret "password" 32 }}`,
+		},
+		{
+			name:    "fail if master key is empty",
+			client:  fake.NewClientBuilder().WithObjects(masterKeySecret("")).Build(),
+			content: `{{ stableSecret "password" 32 }}`,
+		},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := renderSecret(t, tt.client, "instance-1", tt.content); err == nil {
+				t.Errorf("gotemplateRenderer.Render() expected error")
+			}
+		})
+	}
+}
+
+func Test_gotemplateRenderer_Render_persistedSecret(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(masterKeySecret("master-key")).Build()
+	secretKey := types.NamespacedName{
+		Name:      GeneratedSecretName("instance-1"),
+		Namespace: "sf-instance-1",
+	}
+
+	stable, _ := renderSecret(t, c, "instance-1", `{{ stableSecret "password" 16 }}`)
+	got, err := renderSecret(t, c, "instance-1", `{{ persistedSecret "password" 16 }}`)
+	if err != nil || got != stable {
+		t.Fatalf("gotemplateRenderer.Render() = %v, %v, want %v", got, err, stable)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), secretKey, secret); err != nil {
+		t.Fatalf("generated secret not found: %v", err)
+	}
+	if string(secret.Data["password"]) != stable {
+		t.Errorf("generated secret password = %s, want %s", secret.Data["password"], stable)
+	}
+	if refs := secret.GetOwnerReferences(); len(refs) != 1 || refs[0].UID != "uid-instance-1" {
+		t.Errorf("generated secret owner references = %v, want instance", refs)
+	}
+
+	// Stored values are used even if the master key changes
+	secret.Data["password"] = []byte("stored")
+	if err := c.Update(context.TODO(), secret); err != nil {
+		t.Fatalf("failed to update generated secret: %v", err)
+	}
+	got, err = renderSecret(t, c, "instance-1", `{{ persistedSecret "password" 16 }}`)
+	if err != nil || got != "stored" {
+		t.Errorf("gotemplateRenderer.Render() = %v, %v, want stored", got, err)
+	}
+
+	got, err = renderSecret(t, c, "instance-1", `{{ persistedSecret "username" 8 }}`)
+	if err != nil || len(got) != 8 {
+		t.Fatalf("gotemplateRenderer.Render() = %v, %v, want secret of length 8", got, err)
+	}
+	if err := c.Get(context.TODO(), secretKey, secret); err != nil {
+		t.Fatalf("generated secret not found: %v", err)
+	}
+	if string(secret.Data["username"]) != got || string(secret.Data["password"]) != "stored" {
+		t.Errorf("generated secret data = %v, want password and username", secret.Data)
+	}
+}
+
+func Test_gotemplateRenderer_Render_persistedSecret_concurrent(t *testing.T) {
+	// Another render creates the secret between the Get and the Create
+	c := fake.NewClientBuilder().WithObjects(masterKeySecret("master-key")).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if secret, ok := obj.(*corev1.Secret); ok {
+				concurrent := secret.DeepCopy()
+				concurrent.Data = map[string][]byte{"password": []byte("concurrent")}
+				if err := c.Create(ctx, concurrent, opts...); err != nil {
+					return err
+				}
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}).Build()
+
+	got, err := renderSecret(t, c, "instance-1", `{{ persistedSecret "password" 16 }}`)
+	if err != nil || got != "concurrent" {
+		t.Errorf("gotemplateRenderer.Render() = %v, %v, want concurrent", got, err)
+	}
+
+	// A missing value is added to the secret created concurrently
+	c = fake.NewClientBuilder().WithObjects(masterKeySecret("master-key")).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if secret, ok := obj.(*corev1.Secret); ok {
+				concurrent := secret.DeepCopy()
+				concurrent.Data = map[string][]byte{"username": []byte("concurrent")}
+				if err := c.Create(ctx, concurrent, opts...); err != nil {
+					return err
+				}
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}).Build()
+	got, err = renderSecret(t, c, "instance-1", `{{ persistedSecret "password" 16 }}`)
+	if err != nil || len(got) != 16 {
+		t.Fatalf("gotemplateRenderer.Render() = %v, %v, want secret of length 16", got, err)
+	}
+	secret := &corev1.Secret{}
+	secretKey := types.NamespacedName{
+		Name:      GeneratedSecretName("instance-1"),
+		Namespace: "sf-instance-1",
+	}
+	if err := c.Get(context.TODO(), secretKey, secret); err != nil {
+		t.Fatalf("generated secret not found: %v", err)
+	}
+	if string(secret.Data["password"]) != got || string(secret.Data["username"]) != "concurrent" {
+		t.Errorf("generated secret data = %v, want password and username", secret.Data)
+	}
+}
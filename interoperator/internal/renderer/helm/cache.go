@@ -0,0 +1,382 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/mitchellh/copystructure"
+	"github.com/prometheus/client_golang/prometheus"
+	chartapi "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"k8s.io/apimachinery/pkg/api/resource"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const chartCacheSuffix = ".tgz"
+
+var (
+	log = logf.Log.WithName("renderer.helm")
+
+	// The defaults of the interoperator config are used until the chart
+	// cache is configured
+	defaultChartCacheTTL, _  = time.ParseDuration(constants.DefaultHelmChartCacheTTL)
+	defaultChartCacheMaxSize = resource.MustParse(constants.DefaultHelmChartCacheMaxSize)
+
+	chartCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name:      "chart_cache_hits_total",
+			Namespace: "interoperator",
+			Subsystem: "helm",
+			Help:      "Number of helm charts served from the chart cache",
+		},
+	)
+	chartCacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name:      "chart_cache_misses_total",
+			Namespace: "interoperator",
+			Subsystem: "helm",
+			Help:      "Number of helm charts downloaded because they were not found in the chart cache",
+		},
+	)
+
+	// charts is the cache shared across all the helm renderers
+	charts = newChartCache(defaultChartCacheDir(), defaultChartCacheTTL, defaultChartCacheMaxSize.Value())
+)
+
+func init() {
+	metrics.Registry.MustRegister(chartCacheHits, chartCacheMisses)
+}
+
+// ConfigureChartCache sets the location and the limits of the chart cache
+// shared by all helm renderers. If dir is empty, a directory under the os
+// temp directory is used. A ttl or maxSize less than or equal to zero
+// disables the cache and charts are downloaded on every render.
+func ConfigureChartCache(dir string, ttl time.Duration, maxSize int64) {
+	if dir == "" {
+		dir = defaultChartCacheDir()
+	}
+	charts.configure(dir, ttl, maxSize)
+}
+
+func defaultChartCacheDir() string {
+	return filepath.Join(os.TempDir(), "interoperator", "helm-charts")
+}
+
+// chartCache stores the downloaded chart archives on disk. The entries are
+// keyed by the sha256 digest of the resolved chart URL, which contains the
+// chart version. Entries older than ttl are downloaded again and the oldest
+// entries are evicted once the total size exceeds maxSize. The charts parsed
+// from the archives and the resolved chart URLs are kept in memory for ttl
+// as well.
+type chartCache struct {
+	// Renders hold the read lock while loading a cached chart,
+	// inserts and evictions hold the write lock.
+	mu      sync.RWMutex
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	// memMu guards the in memory entries
+	memMu sync.Mutex
+	// loaded holds the parsed charts, keyed by the path of their archive
+	loaded map[string]loadedChart
+	// resolved holds the chart URLs, keyed by the chart reference and version
+	resolved map[string]resolvedChart
+}
+
+type loadedChart struct {
+	chart   *chartapi.Chart
+	modTime time.Time
+}
+
+type resolvedChart struct {
+	url        string
+	resolvedAt time.Time
+}
+
+func newChartCache(dir string, ttl time.Duration, maxSize int64) *chartCache {
+	return &chartCache{
+		dir:      dir,
+		ttl:      ttl,
+		maxSize:  maxSize,
+		loaded:   make(map[string]loadedChart),
+		resolved: make(map[string]resolvedChart),
+	}
+}
+
+func (c *chartCache) configure(dir string, ttl time.Duration, maxSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+	c.ttl = ttl
+	c.maxSize = maxSize
+
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+	c.loaded = make(map[string]loadedChart)
+	c.resolved = make(map[string]resolvedChart)
+}
+
+func (c *chartCache) enabled() bool {
+	return c.ttl > 0 && c.maxSize > 0
+}
+
+func (c *chartCache) entryPath(chartURL string) string {
+	digest := sha256.Sum256([]byte(chartURL))
+	return filepath.Join(c.dir, hex.EncodeToString(digest[:])+chartCacheSuffix)
+}
+
+// resolve returns the chart URL of version of the chart reference chartRef.
+// resolveURL is only called if the URL was not resolved within ttl, so that
+// the index of the repository is not fetched on every render.
+func (c *chartCache) resolve(chartRef, version string, resolveURL func() (string, error)) (string, error) {
+	c.mu.RLock()
+	enabled, ttl := c.enabled(), c.ttl
+	c.mu.RUnlock()
+
+	key := chartRef + " " + version
+	if enabled {
+		c.memMu.Lock()
+		entry, ok := c.resolved[key]
+		c.memMu.Unlock()
+		if ok && time.Since(entry.resolvedAt) <= ttl {
+			return entry.url, nil
+		}
+	}
+
+	chartURL, err := resolveURL()
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		c.memMu.Lock()
+		c.resolved[key] = resolvedChart{url: chartURL, resolvedAt: time.Now()}
+		c.memMu.Unlock()
+	}
+	return chartURL, nil
+}
+
+// load returns the chart for chartURL from the cache. If it is not cached
+// or has expired, download is called with a temporary directory and is
+// expected to return the path of the downloaded archive, which is then
+// added to the cache.
+func (c *chartCache) load(chartURL string, download func(dir string) (string, error)) (*chartapi.Chart, error) {
+	chart, ok := c.get(chartURL)
+	if ok {
+		chartCacheHits.Inc()
+		return chart, nil
+	}
+	chartCacheMisses.Inc()
+
+	dir, err := os.MkdirTemp("", "helm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path, err := download(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	chart, err = loader.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.put(chartURL, path)
+	return chart, nil
+}
+
+func (c *chartCache) get(chartURL string) (*chartapi.Chart, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.enabled() {
+		return nil, false
+	}
+
+	path := c.entryPath(chartURL)
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > c.ttl {
+		return nil, false
+	}
+
+	c.memMu.Lock()
+	entry, ok := c.loaded[path]
+	c.memMu.Unlock()
+	if !ok || !entry.modTime.Equal(info.ModTime()) {
+		chart, err := loader.Load(path)
+		if err != nil {
+			log.Error(err, "failed to load cached chart. downloading again", "url", chartURL)
+			return nil, false
+		}
+		entry = loadedChart{chart: chart, modTime: info.ModTime()}
+		c.memMu.Lock()
+		c.loaded[path] = entry
+		c.memMu.Unlock()
+	}
+
+	// Rendering modifies the chart, e.g. when importing the values of
+	// dependencies. Each render gets its own copy.
+	chart, err := copyChart(entry.chart)
+	if err != nil {
+		log.Error(err, "failed to copy cached chart. downloading again", "url", chartURL)
+		return nil, false
+	}
+	return chart, true
+}
+
+// put copies the archive at src into the cache. Failures only affect
+// caching and are logged.
+func (c *chartCache) put(chartURL, src string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled() {
+		return
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		log.Error(err, "failed to read downloaded chart for caching", "url", chartURL)
+		return
+	}
+	err = os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		log.Error(err, "failed to create chart cache directory", "dir", c.dir)
+		return
+	}
+
+	// Write to a temporary file first so that a partially written
+	// archive is never visible in the cache
+	tmp, err := os.CreateTemp(c.dir, "download-*")
+	if err != nil {
+		log.Error(err, "failed to create file in chart cache", "dir", c.dir)
+		return
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.entryPath(chartURL))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Error(err, "failed to add chart to cache", "url", chartURL)
+		return
+	}
+
+	c.prune()
+}
+
+// prune removes the expired entries and then the oldest entries until the
+// total size is within maxSize. Must be called with the write lock held.
+func (c *chartCache) prune() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		log.Error(err, "failed to list chart cache", "dir", c.dir)
+		return
+	}
+
+	var files []os.FileInfo
+	var totalSize int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), chartCacheSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > c.ttl {
+			c.remove(info.Name())
+			continue
+		}
+		files = append(files, info)
+		totalSize += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files {
+		if totalSize <= c.maxSize {
+			break
+		}
+		err = c.remove(info.Name())
+		if err != nil {
+			log.Error(err, "failed to evict chart from cache", "file", info.Name())
+			continue
+		}
+		totalSize -= info.Size()
+	}
+}
+
+// remove removes the archive name and its parsed chart from the cache. Must
+// be called with the write lock held.
+func (c *chartCache) remove(name string) error {
+	path := filepath.Join(c.dir, name)
+	c.memMu.Lock()
+	delete(c.loaded, path)
+	c.memMu.Unlock()
+	return os.Remove(path)
+}
+
+// copyChart returns a deep copy of the parts of chart modified by renders
+// along with copies of its dependencies. Templates and files are shared.
+func copyChart(chart *chartapi.Chart) (*chartapi.Chart, error) {
+	copied := *chart
+	if chart.Metadata != nil {
+		metadata := *chart.Metadata
+		metadata.Dependencies = make([]*chartapi.Dependency, len(chart.Metadata.Dependencies))
+		for i, dependency := range chart.Metadata.Dependencies {
+			d := *dependency
+			metadata.Dependencies[i] = &d
+		}
+		copied.Metadata = &metadata
+	}
+	values, err := copystructure.Copy(chart.Values)
+	if err != nil {
+		return nil, err
+	}
+	copied.Values, _ = values.(map[string]interface{})
+	copied.Templates = append([]*chartapi.File(nil), chart.Templates...)
+	copied.Files = append([]*chartapi.File(nil), chart.Files...)
+	copied.Raw = append([]*chartapi.File(nil), chart.Raw...)
+
+	copied.SetDependencies()
+	for _, dependency := range chart.Dependencies() {
+		d, err := copyChart(dependency)
+		if err != nil {
+			return nil, err
+		}
+		copied.AddDependency(d)
+	}
+	return &copied, nil
+}
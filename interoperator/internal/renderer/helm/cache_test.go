@@ -0,0 +1,289 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// sampleDownloader returns a download function which packages the sample
+// chart and counts the number of times it was called
+func sampleDownloader(t *testing.T, count *int) func(dir string) (string, error) {
+	chart, err := loader.Load("samples/postgresql")
+	if err != nil {
+		t.Fatalf("failed to load sample chart: %v", err)
+	}
+	return func(dir string) (string, error) {
+		*count++
+		return chartutil.Save(chart, dir)
+	}
+}
+
+func cachedEntries(t *testing.T, dir string) int {
+	entries, err := filepath.Glob(filepath.Join(dir, "*"+chartCacheSuffix))
+	if err != nil {
+		t.Fatalf("failed to list cache directory: %v", err)
+	}
+	return len(entries)
+}
+
+func Test_chartCache_load(t *testing.T) {
+	t.Run("serve chart from cache", func(t *testing.T) {
+		dir := t.TempDir()
+		c := newChartCache(dir, time.Hour, defaultChartCacheMaxSize.Value())
+		downloads := 0
+		download := sampleDownloader(t, &downloads)
+		hits := testutil.ToFloat64(chartCacheHits)
+		misses := testutil.ToFloat64(chartCacheMisses)
+
+		for i := 0; i < 3; i++ {
+			chart, err := c.load("https://charts.example.com/postgresql-0.1.0.tgz", download)
+			if err != nil || chart.Name() != "postgresql" {
+				t.Fatalf("chartCache.load() = %v, %v, want postgresql chart", chart, err)
+			}
+		}
+		if downloads != 1 {
+			t.Errorf("chartCache.load() downloaded %d times, want 1", downloads)
+		}
+		if got := testutil.ToFloat64(chartCacheHits) - hits; got != 2 {
+			t.Errorf("chartCache.load() hits = %v, want 2", got)
+		}
+		if got := testutil.ToFloat64(chartCacheMisses) - misses; got != 1 {
+			t.Errorf("chartCache.load() misses = %v, want 1", got)
+		}
+	})
+
+	t.Run("download again when entry expired", func(t *testing.T) {
+		dir := t.TempDir()
+		c := newChartCache(dir, time.Hour, defaultChartCacheMaxSize.Value())
+		downloads := 0
+		download := sampleDownloader(t, &downloads)
+		chartURL := "https://charts.example.com/postgresql-0.1.0.tgz"
+
+		if _, err := c.load(chartURL, download); err != nil {
+			t.Fatalf("chartCache.load() error = %v", err)
+		}
+		past := time.Now().Add(-2 * time.Hour)
+		if err := os.Chtimes(c.entryPath(chartURL), past, past); err != nil {
+			t.Fatalf("failed to age cache entry: %v", err)
+		}
+		if _, err := c.load(chartURL, download); err != nil {
+			t.Fatalf("chartCache.load() error = %v", err)
+		}
+		if downloads != 2 {
+			t.Errorf("chartCache.load() downloaded %d times, want 2", downloads)
+		}
+	})
+
+	t.Run("evict oldest entries when size exceeded", func(t *testing.T) {
+		dir := t.TempDir()
+		downloads := 0
+		download := sampleDownloader(t, &downloads)
+
+		// Determine the size of a single archive
+		c := newChartCache(dir, time.Hour, defaultChartCacheMaxSize.Value())
+		if _, err := c.load("https://charts.example.com/0.tgz", download); err != nil {
+			t.Fatalf("chartCache.load() error = %v", err)
+		}
+		info, err := os.Stat(c.entryPath("https://charts.example.com/0.tgz"))
+		if err != nil {
+			t.Fatalf("cache entry not found: %v", err)
+		}
+
+		c.configure(dir, time.Hour, 2*info.Size())
+		for i := 1; i <= 3; i++ {
+			if _, err := c.load(fmt.Sprintf("https://charts.example.com/%d.tgz", i), download); err != nil {
+				t.Fatalf("chartCache.load() error = %v", err)
+			}
+		}
+		if got := cachedEntries(t, dir); got != 2 {
+			t.Errorf("chartCache has %d entries, want 2", got)
+		}
+	})
+
+	t.Run("evict parsed charts along with their archives", func(t *testing.T) {
+		dir := t.TempDir()
+		downloads := 0
+		download := sampleDownloader(t, &downloads)
+		chartURL := "https://charts.example.com/0.tgz"
+
+		c := newChartCache(dir, time.Hour, defaultChartCacheMaxSize.Value())
+		for i := 0; i < 2; i++ {
+			if _, err := c.load(chartURL, download); err != nil {
+				t.Fatalf("chartCache.load() error = %v", err)
+			}
+		}
+		if got := len(c.loaded); got != 1 {
+			t.Fatalf("chartCache has %d parsed charts, want 1", got)
+		}
+
+		// Evict the entry by adding another one when only one fits
+		info, err := os.Stat(c.entryPath(chartURL))
+		if err != nil {
+			t.Fatalf("cache entry not found: %v", err)
+		}
+		past := time.Now().Add(-time.Minute)
+		if err := os.Chtimes(c.entryPath(chartURL), past, past); err != nil {
+			t.Fatalf("failed to age cache entry: %v", err)
+		}
+		c.maxSize = info.Size()
+		if _, err := c.load("https://charts.example.com/1.tgz", download); err != nil {
+			t.Fatalf("chartCache.load() error = %v", err)
+		}
+		if got := len(c.loaded); got != 0 {
+			t.Errorf("chartCache has %d parsed charts, want 0", got)
+		}
+	})
+
+	t.Run("serve a copy of the parsed chart on every hit", func(t *testing.T) {
+		c := newChartCache(t.TempDir(), time.Hour, defaultChartCacheMaxSize.Value())
+		downloads := 0
+		download := sampleDownloader(t, &downloads)
+		chartURL := "https://charts.example.com/postgresql-0.1.0.tgz"
+
+		if _, err := c.load(chartURL, download); err != nil {
+			t.Fatalf("chartCache.load() error = %v", err)
+		}
+		first, err := c.load(chartURL, download)
+		if err != nil {
+			t.Fatalf("chartCache.load() error = %v", err)
+		}
+		first.Values["modified"] = true
+		first.Metadata.Name = "modified"
+
+		second, err := c.load(chartURL, download)
+		if err != nil {
+			t.Fatalf("chartCache.load() error = %v", err)
+		}
+		if _, ok := second.Values["modified"]; ok || second.Name() != "postgresql" {
+			t.Errorf("chartCache.load() returned chart modified by previous render")
+		}
+		if got := len(c.loaded); got != 1 {
+			t.Errorf("chartCache has %d parsed charts, want 1", got)
+		}
+	})
+
+	t.Run("download every time when disabled", func(t *testing.T) {
+		dir := t.TempDir()
+		c := newChartCache(dir, 0, defaultChartCacheMaxSize.Value())
+		downloads := 0
+		download := sampleDownloader(t, &downloads)
+
+		for i := 0; i < 2; i++ {
+			if _, err := c.load("https://charts.example.com/postgresql-0.1.0.tgz", download); err != nil {
+				t.Fatalf("chartCache.load() error = %v", err)
+			}
+		}
+		if downloads != 2 {
+			t.Errorf("chartCache.load() downloaded %d times, want 2", downloads)
+		}
+		if got := cachedEntries(t, dir); got != 0 {
+			t.Errorf("chartCache has %d entries, want 0", got)
+		}
+	})
+
+	t.Run("fail when download fails", func(t *testing.T) {
+		c := newChartCache(t.TempDir(), time.Hour, defaultChartCacheMaxSize.Value())
+		_, err := c.load("https://charts.example.com/missing.tgz", func(dir string) (string, error) {
+			return "", fmt.Errorf("not found")
+		})
+		if err == nil {
+			t.Errorf("chartCache.load() expected error")
+		}
+	})
+}
+
+func Test_chartCache_resolve(t *testing.T) {
+	resolver := func(count *int) func() (string, error) {
+		return func() (string, error) {
+			*count++
+			return "https://charts.example.com/postgresql-0.1.0.tgz", nil
+		}
+	}
+
+	t.Run("resolve once within ttl", func(t *testing.T) {
+		c := newChartCache(t.TempDir(), time.Hour, defaultChartCacheMaxSize.Value())
+		resolves := 0
+		for i := 0; i < 3; i++ {
+			chartURL, err := c.resolve("https://charts.example.com/postgresql", "", resolver(&resolves))
+			if err != nil || chartURL != "https://charts.example.com/postgresql-0.1.0.tgz" {
+				t.Fatalf("chartCache.resolve() = %v, %v", chartURL, err)
+			}
+		}
+		if resolves != 1 {
+			t.Errorf("chartCache.resolve() resolved %d times, want 1", resolves)
+		}
+		if _, err := c.resolve("https://charts.example.com/postgresql", "0.2.0", resolver(&resolves)); err != nil {
+			t.Fatalf("chartCache.resolve() error = %v", err)
+		}
+		if resolves != 2 {
+			t.Errorf("chartCache.resolve() resolved %d times for another version, want 2", resolves)
+		}
+	})
+
+	t.Run("resolve again when expired", func(t *testing.T) {
+		c := newChartCache(t.TempDir(), time.Hour, defaultChartCacheMaxSize.Value())
+		resolves := 0
+		if _, err := c.resolve("https://charts.example.com/postgresql", "", resolver(&resolves)); err != nil {
+			t.Fatalf("chartCache.resolve() error = %v", err)
+		}
+		for key, entry := range c.resolved {
+			entry.resolvedAt = time.Now().Add(-2 * time.Hour)
+			c.resolved[key] = entry
+		}
+		if _, err := c.resolve("https://charts.example.com/postgresql", "", resolver(&resolves)); err != nil {
+			t.Fatalf("chartCache.resolve() error = %v", err)
+		}
+		if resolves != 2 {
+			t.Errorf("chartCache.resolve() resolved %d times, want 2", resolves)
+		}
+	})
+
+	t.Run("resolve every time when disabled", func(t *testing.T) {
+		c := newChartCache(t.TempDir(), 0, defaultChartCacheMaxSize.Value())
+		resolves := 0
+		for i := 0; i < 2; i++ {
+			if _, err := c.resolve("https://charts.example.com/postgresql", "", resolver(&resolves)); err != nil {
+				t.Fatalf("chartCache.resolve() error = %v", err)
+			}
+		}
+		if resolves != 2 {
+			t.Errorf("chartCache.resolve() resolved %d times, want 2", resolves)
+		}
+	})
+
+	t.Run("fail when resolving fails", func(t *testing.T) {
+		c := newChartCache(t.TempDir(), time.Hour, defaultChartCacheMaxSize.Value())
+		_, err := c.resolve("https://charts.example.com/missing", "", func() (string, error) {
+			return "", fmt.Errorf("not found")
+		})
+		if err == nil {
+			t.Errorf("chartCache.resolve() expected error")
+		}
+		if len(c.resolved) != 0 {
+			t.Errorf("chartCache.resolve() cached failed resolution")
+		}
+	})
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	chartapi "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// chartCredentials are the credentials for the repository or registry of a
+// chart. They are sent only to the host the chart was downloaded from.
+type chartCredentials struct {
+	host     string
+	username string
+	password string
+}
+
+func newChartCredentials(chartRef, username, password string) chartCredentials {
+	return chartCredentials{
+		host:     hostOf(chartRef),
+		username: username,
+		password: password,
+	}
+}
+
+// forRepository returns the credentials if repository is on the same host
+// as the chart, otherwise empty credentials.
+func (c chartCredentials) forRepository(repository string) (string, string) {
+	if c.host == "" || hostOf(repository) != c.host {
+		return "", ""
+	}
+	return c.username, c.password
+}
+
+func hostOf(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// resolveDependencies adds the dependencies declared in the Chart.yaml of
+// chart which are not vendored in its charts directory. Dependencies from
+// chart repositories and OCI registries are downloaded through the chart
+// cache. file:// dependencies are loaded relative to chartDir, which is
+// empty if the chart was not loaded from the local file system.
+// Dependencies of the resolved dependencies must be vendored.
+func resolveDependencies(chart *chartapi.Chart, chartDir string, credentials chartCredentials) error {
+	if chart.Metadata == nil {
+		return nil
+	}
+
+	vendored := make(map[string]bool)
+	for _, dependency := range chart.Dependencies() {
+		vendored[dependency.Name()] = true
+	}
+
+	for _, dependency := range chart.Metadata.Dependencies {
+		if vendored[dependency.Name] {
+			continue
+		}
+		subchart, err := loadDependency(dependency, chartDir, credentials)
+		if err != nil {
+			return errors.NewRendererError("helm", fmt.Sprintf("can't resolve dependency %s of chart %s", dependency.Name, chart.Name()), err)
+		}
+		chart.AddDependency(subchart)
+		vendored[dependency.Name] = true
+	}
+	return nil
+}
+
+func loadDependency(dependency *chartapi.Dependency, chartDir string, credentials chartCredentials) (*chartapi.Chart, error) {
+	repository := dependency.Repository
+	switch {
+	case repository == "":
+		return nil, fmt.Errorf("no repository set and chart not found in the charts directory")
+	case strings.HasPrefix(repository, renderer.FileScheme):
+		if chartDir == "" {
+			return nil, fmt.Errorf("file:// repositories are supported only for charts loaded from the local file system")
+		}
+		path := strings.TrimPrefix(repository, renderer.FileScheme)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(chartDir, path)
+		}
+		path, err := renderer.LocalPath(path)
+		if err != nil {
+			return nil, err
+		}
+		return loader.Load(path)
+	case registry.IsOCI(repository):
+		username, password := credentials.forRepository(repository)
+		chartRef := strings.TrimSuffix(repository, "/") + "/" + dependency.Name
+		return downloadChart(chartRef, dependency.Version, username, password)
+	case strings.HasPrefix(repository, "http://") || strings.HasPrefix(repository, "https://"):
+		username, password := credentials.forRepository(repository)
+		chartURL, err := repo.FindChartInAuthRepoURL(repository, username, password, dependency.Name, dependency.Version,
+			"", "", "", chartGetters())
+		if err != nil {
+			return nil, err
+		}
+		// The index may point to charts hosted elsewhere
+		username, password = credentials.forRepository(chartURL)
+		return downloadChart(chartURL, "", username, password)
+	default:
+		return nil, fmt.Errorf("unsupported repository %s. Only file://, oci:// and http(s):// repositories are supported", repository)
+	}
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	chartapi "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// chartRepositoryServer serves the sample chart from a chart repository
+// and counts the downloads of the chart archive
+func chartRepositoryServer(t *testing.T, downloads *int) *httptest.Server {
+	chart, err := loader.Load("samples/postgresql")
+	if err != nil {
+		t.Fatalf("failed to load sample chart: %v", err)
+	}
+	archivePath, err := chartutil.Save(chart, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to package sample chart: %v", err)
+	}
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("failed to read sample chart archive: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/index.yaml":
+			fmt.Fprint(w, `apiVersion: v1
+entries:
+  postgresql:
+  - apiVersion: v1
+    name: postgresql
+    version: 0.1.0
+    urls:
+    - postgresql-0.1.0.tgz
+`)
+		case "/postgresql-0.1.0.tgz":
+			*downloads++
+			w.Write(archive)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// chartWithDependency returns a chart depending on the postgresql chart
+// from repository
+func chartWithDependency(repository string) *chartapi.Chart {
+	return &chartapi.Chart{
+		Metadata: &chartapi.Metadata{
+			APIVersion: chartapi.APIVersionV2,
+			Name:       "app",
+			Version:    "0.1.0",
+			Dependencies: []*chartapi.Dependency{
+				{
+					Name:       "postgresql",
+					Version:    "~0.1.0",
+					Repository: repository,
+				},
+			},
+		},
+	}
+}
+
+func Test_resolveDependencies(t *testing.T) {
+	t.Setenv("HELM_CACHE_HOME", t.TempDir())
+	defer func(c *chartCache) { charts = c }(charts)
+	charts = newChartCache(t.TempDir(), time.Hour, defaultChartCacheMaxSize.Value())
+
+	downloads := 0
+	server := chartRepositoryServer(t, &downloads)
+	samplesDir, err := filepath.Abs("samples")
+	if err != nil {
+		t.Fatalf("failed to resolve samples directory: %v", err)
+	}
+	defer renderer.SetLocalRoot("")
+	renderer.SetLocalRoot(samplesDir)
+	sampleChart, err := loader.Load("samples/postgresql")
+	if err != nil {
+		t.Fatalf("failed to load sample chart: %v", err)
+	}
+	outsideDir := t.TempDir()
+	if err := chartutil.SaveDir(sampleChart, outsideDir); err != nil {
+		t.Fatalf("failed to copy sample chart: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		repository string
+		chartDir   string
+		wantErr    bool
+	}{
+		{
+			name:       "resolve dependency from chart repository",
+			repository: server.URL,
+		},
+		{
+			name:       "resolve file dependency relative to chart directory",
+			repository: "file://postgresql",
+			chartDir:   samplesDir,
+		},
+		{
+			name:       "fail on file dependency outside of local root",
+			repository: "file://" + filepath.Join(outsideDir, "postgresql"),
+			chartDir:   samplesDir,
+			wantErr:    true,
+		},
+		{
+			name:       "fail on file dependency of chart not loaded from file system",
+			repository: "file://postgresql",
+			wantErr:    true,
+		},
+		{
+			name:       "fail if dependency not found in chart repository",
+			repository: server.URL + "/missing",
+			wantErr:    true,
+		},
+		{
+			name:    "fail if dependency has no repository",
+			wantErr: true,
+		},
+		{
+			name:       "fail on repository alias",
+			repository: "@stable",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chart := chartWithDependency(tt.repository)
+			err := resolveDependencies(chart, tt.chartDir, chartCredentials{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveDependencies() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.RendererError(err) {
+					t.Errorf("resolveDependencies() error = %v, want RendererError", err)
+				}
+				return
+			}
+			if len(chart.Dependencies()) != 1 || chart.Dependencies()[0].Name() != "postgresql" {
+				t.Errorf("resolveDependencies() dependencies = %v, want postgresql", chart.Dependencies())
+			}
+		})
+	}
+
+	// Dependencies are downloaded through the chart cache
+	for i := 0; i < 2; i++ {
+		if err := resolveDependencies(chartWithDependency(server.URL), "", chartCredentials{}); err != nil {
+			t.Fatalf("resolveDependencies() error = %v", err)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("resolveDependencies() downloaded dependency %d times, want 1", downloads)
+	}
+
+	// Vendored dependencies are not resolved again
+	chart := chartWithDependency("@stable")
+	vendored, err := loader.Load("samples/postgresql")
+	if err != nil {
+		t.Fatalf("failed to load sample chart: %v", err)
+	}
+	chart.AddDependency(vendored)
+	if err := resolveDependencies(chart, "", chartCredentials{}); err != nil {
+		t.Errorf("resolveDependencies() error = %v", err)
+	}
+}
+
+func Test_chartCredentials_forRepository(t *testing.T) {
+	credentials := newChartCredentials("oci://registry.example.com/charts/app", "user", "password")
+	tests := []struct {
+		name         string
+		repository   string
+		wantUsername string
+	}{
+		{
+			name:         "send credentials to same host",
+			repository:   "oci://registry.example.com/charts",
+			wantUsername: "user",
+		},
+		{
+			name:       "not send credentials to other hosts",
+			repository: "https://charts.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, _ := credentials.forRepository(tt.repository)
+			if username != tt.wantUsername {
+				t.Errorf("chartCredentials.forRepository() username = %v, want %v", username, tt.wantUsername)
+			}
+		})
+	}
+}
+
+func Test_helmRenderer_renderRelease_schema(t *testing.T) {
+	r, _ := New(nil)
+	chart, err := loader.Load("samples/postgresql")
+	if err != nil {
+		t.Fatalf("failed to load sample chart: %v", err)
+	}
+	chart.Schema = []byte(`{
+  "type": "object",
+  "required": ["replicas"],
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1}
+  }
+}`)
+
+	tests := []struct {
+		name     string
+		values   map[string]interface{}
+		wantErr  bool
+		contains string
+	}{
+		{
+			name:   "render if values satisfy schema",
+			values: map[string]interface{}{"replicas": 2},
+		},
+		{
+			name:     "fail if value has wrong type",
+			values:   map[string]interface{}{"replicas": "two"},
+			wantErr:  true,
+			contains: "replicas",
+		},
+		{
+			name:     "fail if required value is missing",
+			values:   map[string]interface{}{},
+			wantErr:  true,
+			contains: "replicas",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.(*helmRenderer).renderRelease(chart, "release", "namespace", tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("helmRenderer.renderRelease() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.RendererError(err) || !strings.Contains(err.Error(), "values don't satisfy the schema of chart postgresql") ||
+					!strings.Contains(err.Error(), tt.contains) {
+					t.Errorf("helmRenderer.renderRelease() error = %v, want schema error for %s", err, tt.contains)
+				}
+				return
+			}
+			if got == nil {
+				t.Errorf("helmRenderer.renderRelease() = nil, want output")
+			}
+		})
+	}
+}
@@ -17,16 +17,23 @@ limitations under the License.
 package helm
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
-	"k8s.io/client-go/kubernetes"
 
 	chartapi "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
@@ -34,6 +41,17 @@ import (
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/engine"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Keys of the registry credentials in the secret. Same as the keys
+	// of secrets of type kubernetes.io/basic-auth
+	usernameKey = "username"
+	passwordKey = "password"
 )
 
 var (
@@ -41,45 +59,50 @@ var (
 )
 
 type helmRenderer struct {
-	chartDownloader    *downloader.ChartDownloader
+	client             client.Client
 	gotemplateRenderer renderer.Renderer
 }
 
 type helmInput struct {
-	chartPath      string
-	releaseName    string
-	namespace      string
-	valuesTemplate string
-	valuesInput    map[string]interface{}
+	chartPath         string
+	chartArchive      []byte
+	credentialsSecret string
+	releaseName       string
+	namespace         string
+	valuesTemplate    string
+	libraries         []osbv1alpha1.TemplateLibraryRef
+	valuesInput       map[string]interface{}
 }
 
-// NewInput creates a new helm Renderer input object.
-func NewInput(chartPath, releaseName, namespace string, valuesTemplate string, valuesInput map[string]interface{}) renderer.Input {
+// NewInput creates a new helm Renderer input object. The chart is read
+// from <chartArchive> (a gzipped tarball) if set, otherwise from <chartPath>.
+// <credentialsSecret> is the name of the secret in the interoperator namespace
+// holding the credentials for the chart repository or registry. The named
+// templates of <libraries> can be used in <valuesTemplate>.
+func NewInput(chartPath string, chartArchive []byte, credentialsSecret, releaseName, namespace string,
+	valuesTemplate string, libraries []osbv1alpha1.TemplateLibraryRef, valuesInput map[string]interface{}) renderer.Input {
 	shortName := fmt.Sprintf("in-%s", utils.Adler32sum(releaseName))
 	return helmInput{
-		chartPath:      chartPath,
-		releaseName:    shortName,
-		namespace:      namespace,
-		valuesTemplate: valuesTemplate,
-		valuesInput:    valuesInput,
+		chartPath:         chartPath,
+		chartArchive:      chartArchive,
+		credentialsSecret: credentialsSecret,
+		releaseName:       shortName,
+		namespace:         namespace,
+		valuesTemplate:    valuesTemplate,
+		libraries:         libraries,
+		valuesInput:       valuesInput,
 	}
 }
 
-// New creates a new helm Renderer object.
-func New(clientSet *kubernetes.Clientset) (renderer.Renderer, error) {
-	chartDownloader := &downloader.ChartDownloader{
-		Out: os.Stdout,
-		Getters: getter.Providers{getter.Provider{
-			Schemes: []string{"http", "https"},
-			New:     getter.NewHTTPGetter,
-		}},
-	}
-	gotemplateRenderer, err := gotemplate.New()
+// New creates a new helm Renderer object. The client is used for reading
+// the credentials secrets.
+func New(c client.Client) (renderer.Renderer, error) {
+	gotemplateRenderer, err := gotemplate.NewForRenderer(c, "helm")
 	if err != nil {
 		return nil, err
 	}
 	return &helmRenderer{
-		chartDownloader:    chartDownloader,
+		client:             c,
 		gotemplateRenderer: gotemplateRenderer,
 	}, nil
 }
@@ -94,9 +117,10 @@ func (r *helmRenderer) Render(rawInput renderer.Input) (renderer.Output, error)
 	}
 
 	var valuesString string
+	volatile := false
 
 	if input.valuesTemplate != "" {
-		gotemplateInput := gotemplate.NewInput("", input.valuesTemplate, input.releaseName, input.valuesInput)
+		gotemplateInput := gotemplate.NewInput("", "", input.valuesTemplate, input.releaseName, input.namespace, input.libraries, input.valuesInput)
 		gotemplateOutput, err := r.gotemplateRenderer.Render(gotemplateInput)
 		if err != nil {
 			return nil, errors.NewRendererError("helm", "failed to render values", err)
@@ -105,6 +129,7 @@ func (r *helmRenderer) Render(rawInput renderer.Input) (renderer.Output, error)
 		if err != nil {
 			return nil, errors.NewRendererError("helm", "failed to read rendered values", err)
 		}
+		volatile = renderer.IsVolatile(gotemplateOutput)
 	}
 
 	values, err := chartutil.ReadValues([]byte(valuesString))
@@ -112,35 +137,233 @@ func (r *helmRenderer) Render(rawInput renderer.Input) (renderer.Output, error)
 		return nil, errors.NewRendererError("helm", "failed to parse rendered values", err)
 	}
 
-	chartDownloader := r.chartDownloader
-	chartURL, err := chartDownloader.ResolveChartVersion(input.chartPath, "")
+	chart, err := r.loadChart(input)
 	if err != nil {
 		return nil, err
 	}
 
-	dir, err := os.MkdirTemp("", "helm")
+	output, err := r.renderRelease(chart, input.releaseName, input.namespace, values)
 	if err != nil {
 		return nil, err
 	}
+	if volatile {
+		return renderer.MarkVolatile(output), nil
+	}
+	return output, nil
+}
+
+// loadChart loads the chart from the inline archive, the local file system
+// (file://), an OCI registry (oci://) or a chart repository (http(s)://).
+// Charts downloaded from registries and repositories are cached. Missing
+// dependencies of the chart are resolved as well.
+func (r *helmRenderer) loadChart(input helmInput) (*chartapi.Chart, error) {
+	if len(input.chartArchive) > 0 {
+		chart, err := loader.LoadArchive(bytes.NewReader(input.chartArchive))
+		if err != nil {
+			return nil, err
+		}
+		return chart, resolveDependencies(chart, "", chartCredentials{})
+	}
+	if strings.HasPrefix(input.chartPath, renderer.FileScheme) {
+		chartDir, err := renderer.LocalPath(input.chartPath)
+		if err != nil {
+			return nil, err
+		}
+		chart, err := loader.Load(chartDir)
+		if err != nil {
+			return nil, err
+		}
+		return chart, resolveDependencies(chart, chartDir, chartCredentials{})
+	}
+
+	username, password, err := r.readCredentials(input.credentialsSecret)
+	if err != nil {
+		return nil, errors.NewRendererError("helm", fmt.Sprintf("failed to read credentials secret %s", input.credentialsSecret), err)
+	}
 
-	defer os.RemoveAll(dir)
+	chartRef, version := input.chartPath, ""
+	if registry.IsOCI(chartRef) {
+		chartRef, version = splitOCIReference(chartRef)
+	}
 
-	path, _, err := chartDownloader.DownloadTo(chartURL.String(), "", dir)
+	chart, err := downloadChart(chartRef, version, username, password)
 	if err != nil {
 		return nil, err
 	}
+	return chart, resolveDependencies(chart, "", newChartCredentials(chartRef, username, password))
+}
 
-	chart, err := loader.Load(path)
+// downloadChart downloads the chart <version> of the http(s) or oci
+// reference <chartRef> through the chart cache
+func downloadChart(chartRef, version, username, password string) (*chartapi.Chart, error) {
+	chartDownloader, cleanup, err := newChartDownloader(chartRef, username, password)
 	if err != nil {
 		return nil, err
 	}
+	defer cleanup()
+
+	chartURL, err := charts.resolve(chartRef, version, func() (string, error) {
+		chartURL, err := chartDownloader.ResolveChartVersion(chartRef, version)
+		if err != nil {
+			return "", err
+		}
+		return chartURL.String(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return charts.load(chartURL, func(dir string) (string, error) {
+		path, _, err := chartDownloader.DownloadTo(chartRef, version, dir)
+		return path, err
+	})
+}
 
-	return r.renderRelease(chart, input.releaseName, input.namespace, values)
+// readCredentials returns the username and password from the secret
+// <name> in the interoperator namespace. Empty credentials are returned
+// if no secret is configured.
+func (r *helmRenderer) readCredentials(name string) (string, string, error) {
+	if name == "" {
+		return "", "", nil
+	}
+	if r.client == nil {
+		return "", "", fmt.Errorf("no kubernetes client to read secret")
+	}
+
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: constants.InteroperatorNamespace,
+	}, secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	username, ok := secret.Data[usernameKey]
+	if !ok {
+		return "", "", fmt.Errorf("key %s not found in secret", usernameKey)
+	}
+	password, ok := secret.Data[passwordKey]
+	if !ok {
+		return "", "", fmt.Errorf("key %s not found in secret", passwordKey)
+	}
+	return string(username), string(password), nil
+}
+
+// newChartDownloader creates a chart downloader for http(s) and oci
+// references using the credentials if set. The returned cleanup function
+// must be called once the downloader is no longer used.
+func newChartDownloader(chartRef, username, password string) (*downloader.ChartDownloader, func(), error) {
+	cleanup := func() {}
+
+	var options []getter.Option
+	var registryOptions []registry.ClientOption
+	if username != "" || password != "" {
+		options = append(options, getter.WithBasicAuth(username, password))
+
+		if registry.IsOCI(chartRef) {
+			// The registry client reads the credentials only from a docker config file
+			credentialsFile, err := writeRegistryCredentials(chartRef, username, password)
+			if err != nil {
+				return nil, cleanup, err
+			}
+			cleanup = func() {
+				os.RemoveAll(filepath.Dir(credentialsFile))
+			}
+			registryOptions = append(registryOptions, registry.ClientOptCredentialsFile(credentialsFile))
+		}
+	}
+
+	registryOptions = append(registryOptions, registry.ClientOptWriter(io.Discard))
+	registryClient, err := registry.NewClient(registryOptions...)
+	if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	}
+	options = append(options, getter.WithRegistryClient(registryClient))
+
+	return &downloader.ChartDownloader{
+		Out:            os.Stdout,
+		Getters:        chartGetters(),
+		Options:        options,
+		RegistryClient: registryClient,
+	}, cleanup, nil
+}
+
+// chartGetters returns the getters for http(s) and oci references
+func chartGetters() getter.Providers {
+	return getter.Providers{
+		getter.Provider{
+			Schemes: []string{"http", "https"},
+			New:     getter.NewHTTPGetter,
+		},
+		getter.Provider{
+			Schemes: []string{registry.OCIScheme},
+			New:     getter.NewOCIGetter,
+		},
+	}
+}
+
+// writeRegistryCredentials writes a docker config file with the credentials
+// for the registry of chartRef into a new temporary directory.
+func writeRegistryCredentials(chartRef, username, password string) (string, error) {
+	host := strings.TrimPrefix(chartRef, fmt.Sprintf("%s://", registry.OCIScheme))
+	if index := strings.Index(host, "/"); index >= 0 {
+		host = host[:index]
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	config, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			host: map[string]string{
+				"auth": auth,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp("", "helm-registry")
+	if err != nil {
+		return "", err
+	}
+	credentialsFile := filepath.Join(dir, "config.json")
+	err = os.WriteFile(credentialsFile, config, 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return credentialsFile, nil
+}
+
+// splitOCIReference splits the tag from an oci reference. An empty
+// version is returned if the reference has no tag, in which case the
+// latest version available in the registry is used.
+func splitOCIReference(chartRef string) (string, string) {
+	name := chartRef[strings.LastIndex(chartRef, "/")+1:]
+	index := strings.LastIndex(name, ":")
+	if index < 0 {
+		return chartRef, ""
+	}
+	return strings.TrimSuffix(chartRef, name[index:]), name[index+1:]
 }
 
 func (r *helmRenderer) renderRelease(chart *chartapi.Chart, releaseName, namespace string, values map[string]interface{}) (renderer.Output, error) {
 	chartName := chart.Name()
 
+	// Same order as helm install. The conditions and tags of the
+	// dependencies are evaluated against the values passed.
+	err := chartutil.ProcessDependenciesWithMerge(chart, values)
+	if err != nil {
+		return nil, errors.NewRendererError("helm", fmt.Sprintf("can't process dependencies for chart %s", chartName), err)
+	}
+
+	err = validateValues(chart, values)
+	if err != nil {
+		return nil, errors.NewRendererError("helm", fmt.Sprintf("values don't satisfy the schema of chart %s", chartName), err)
+	}
+
 	valuesToRender, err := chartutil.ToRenderValues(chart, values, chartutil.ReleaseOptions{
 		Name:      releaseName,
 		Namespace: namespace,
@@ -151,12 +374,18 @@ func (r *helmRenderer) renderRelease(chart *chartapi.Chart, releaseName, namespa
 		return nil, errors.NewRendererError("helm", fmt.Sprintf("can't parse variables for chart %s", chartName), err)
 	}
 
-	err = chartutil.ProcessDependencies(chart, valuesToRender)
+	return r.renderResources(chart, valuesToRender)
+}
+
+// validateValues validates the values merged with the default values of
+// the chart against the values.schema.json of the chart and its
+// dependencies
+func validateValues(chart *chartapi.Chart, values map[string]interface{}) error {
+	mergedValues, err := chartutil.CoalesceValues(chart, values)
 	if err != nil {
-		return nil, errors.NewRendererError("helm", fmt.Sprintf("can't process dependencies for chart %s", chartName), err)
+		return err
 	}
-
-	return r.renderResources(chart, valuesToRender)
+	return chartutil.ValidateAgainstSchema(chart, mergedValues)
 }
 
 func (r *helmRenderer) renderResources(ch *chartapi.Chart, values chartutil.Values) (renderer.Output, error) {
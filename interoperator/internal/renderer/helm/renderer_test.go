@@ -19,24 +19,31 @@ package helm
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
 	chartapi "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
-	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestNewInput(t *testing.T) {
 	type args struct {
-		chartPath      string
-		releaseName    string
-		namespace      string
-		valuesTemplate string
-		valuesInput    map[string]interface{}
+		chartPath         string
+		chartArchive      []byte
+		credentialsSecret string
+		releaseName       string
+		namespace         string
+		valuesTemplate    string
+		valuesInput       map[string]interface{}
 	}
 	tests := []struct {
 		name string
@@ -46,24 +53,28 @@ func TestNewInput(t *testing.T) {
 		{
 			name: "return renderer input",
 			args: args{
-				chartPath:      "chartPath",
-				releaseName:    "releaseName",
-				namespace:      "namespace",
-				valuesTemplate: "valuesTemplate",
-				valuesInput:    nil,
+				chartPath:         "chartPath",
+				chartArchive:      []byte("chartArchive"),
+				credentialsSecret: "credentialsSecret",
+				releaseName:       "releaseName",
+				namespace:         "namespace",
+				valuesTemplate:    "valuesTemplate",
+				valuesInput:       nil,
 			},
 			want: helmInput{
-				chartPath:      "chartPath",
-				releaseName:    fmt.Sprintf("in-%s", utils.Adler32sum("releaseName")),
-				namespace:      "namespace",
-				valuesTemplate: "valuesTemplate",
-				valuesInput:    nil,
+				chartPath:         "chartPath",
+				chartArchive:      []byte("chartArchive"),
+				credentialsSecret: "credentialsSecret",
+				releaseName:       fmt.Sprintf("in-%s", utils.Adler32sum("releaseName")),
+				namespace:         "namespace",
+				valuesTemplate:    "valuesTemplate",
+				valuesInput:       nil,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewInput(tt.args.chartPath, tt.args.releaseName, tt.args.namespace, tt.args.valuesTemplate, tt.args.valuesInput); !reflect.DeepEqual(got, tt.want) {
+			if got := NewInput(tt.args.chartPath, tt.args.chartArchive, tt.args.credentialsSecret, tt.args.releaseName, tt.args.namespace, tt.args.valuesTemplate, nil, tt.args.valuesInput); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewInput() = %v, want %v", got, tt.want)
 			}
 		})
@@ -72,7 +83,7 @@ func TestNewInput(t *testing.T) {
 
 func TestNew(t *testing.T) {
 	type args struct {
-		clientSet *kubernetes.Clientset
+		c client.Client
 	}
 	tests := []struct {
 		name    string
@@ -83,14 +94,14 @@ func TestNew(t *testing.T) {
 		{
 			name: "create helm renderer",
 			args: args{
-				clientSet: nil,
+				c: nil,
 			},
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := New(tt.args.clientSet)
+			got, err := New(tt.args.c)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -105,6 +116,21 @@ func TestNew(t *testing.T) {
 func Test_helmRenderer_Render(t *testing.T) {
 	url := "https://raw.githubusercontent.com/cloudfoundry-incubator/service-fabrik-broker/gh-pages/helm-charts/interoperator-0.4.3.tgz"
 	r, _ := New(nil)
+	defer renderer.SetLocalRoot("")
+	renderer.SetLocalRoot("samples")
+
+	sampleChart, err := loader.Load("./samples/postgresql")
+	if err != nil {
+		t.Fatalf("helmRenderer.Render() failed to load chart %v", err)
+	}
+	archivePath, err := chartutil.Save(sampleChart, t.TempDir())
+	if err != nil {
+		t.Fatalf("helmRenderer.Render() failed to package chart %v", err)
+	}
+	chartArchive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("helmRenderer.Render() failed to read chart archive %v", err)
+	}
 	type args struct {
 		rawInput renderer.Input
 	}
@@ -184,6 +210,82 @@ func Test_helmRenderer_Render(t *testing.T) {
 			want:    true,
 			wantErr: false,
 		},
+		{
+			name: "render helm chart from local path",
+			r:    r.(*helmRenderer),
+			args: args{
+				rawInput: helmInput{
+					chartPath:      "file://./samples/postgresql",
+					releaseName:    "releaseName",
+					namespace:      "namespace",
+					valuesTemplate: "name: name",
+					valuesInput:    nil,
+				},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name: "fail on local chart outside of local root",
+			r:    r.(*helmRenderer),
+			args: args{
+				rawInput: helmInput{
+					chartPath:      "file://.",
+					releaseName:    "releaseName",
+					namespace:      "namespace",
+					valuesTemplate: "name: name",
+					valuesInput:    nil,
+				},
+			},
+			want:    false,
+			wantErr: true,
+		},
+		{
+			name: "render helm chart from inline archive",
+			r:    r.(*helmRenderer),
+			args: args{
+				rawInput: helmInput{
+					chartArchive:   chartArchive,
+					releaseName:    "releaseName",
+					namespace:      "namespace",
+					valuesTemplate: "name: name",
+					valuesInput:    nil,
+				},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name: "fail when inline archive is invalid",
+			r:    r.(*helmRenderer),
+			args: args{
+				rawInput: helmInput{
+					chartArchive:   []byte("invalid"),
+					releaseName:    "releaseName",
+					namespace:      "namespace",
+					valuesTemplate: "name: name",
+					valuesInput:    nil,
+				},
+			},
+			want:    false,
+			wantErr: true,
+		},
+		{
+			name: "fail when credentials secret can not be read",
+			r:    r.(*helmRenderer),
+			args: args{
+				rawInput: helmInput{
+					chartPath:         "oci://registry.example.com/charts/postgresql:0.1.0",
+					credentialsSecret: "registry-credentials",
+					releaseName:       "releaseName",
+					namespace:         "namespace",
+					valuesTemplate:    "name: name",
+					valuesInput:       nil,
+				},
+			},
+			want:    false,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -323,3 +425,132 @@ func Test_helmRenderer_renderResources(t *testing.T) {
 		})
 	}
 }
+
+func Test_helmRenderer_readCredentials(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "registry-credentials",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"username": []byte("user"),
+			"password": []byte("pass"),
+		},
+	}
+	incomplete := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "incomplete-credentials",
+			Namespace: constants.InteroperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"username": []byte("user"),
+		},
+	}
+	c := fake.NewClientBuilder().WithObjects(secret, incomplete).Build()
+
+	tests := []struct {
+		name         string
+		c            client.Client
+		secret       string
+		wantUsername string
+		wantPassword string
+		wantErr      bool
+	}{
+		{
+			name:   "return empty credentials if no secret configured",
+			c:      nil,
+			secret: "",
+		},
+		{
+			name:    "fail if no client",
+			c:       nil,
+			secret:  "registry-credentials",
+			wantErr: true,
+		},
+		{
+			name:    "fail if secret not found",
+			c:       c,
+			secret:  "unknown",
+			wantErr: true,
+		},
+		{
+			name:    "fail if password not found",
+			c:       c,
+			secret:  "incomplete-credentials",
+			wantErr: true,
+		},
+		{
+			name:         "return credentials from secret",
+			c:            c,
+			secret:       "registry-credentials",
+			wantUsername: "user",
+			wantPassword: "pass",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := New(tt.c)
+			username, password, err := r.(*helmRenderer).readCredentials(tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("helmRenderer.readCredentials() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if username != tt.wantUsername || password != tt.wantPassword {
+				t.Errorf("helmRenderer.readCredentials() = %v, %v, want %v, %v", username, password, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func Test_writeRegistryCredentials(t *testing.T) {
+	credentialsFile, err := writeRegistryCredentials("oci://registry.example.com:5000/charts/postgresql", "user", "pass")
+	if err != nil {
+		t.Fatalf("writeRegistryCredentials() error = %v", err)
+	}
+	defer os.RemoveAll(filepath.Dir(credentialsFile))
+
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		t.Fatalf("writeRegistryCredentials() failed to read file. error = %v", err)
+	}
+	want := `{"auths":{"registry.example.com:5000":{"auth":"dXNlcjpwYXNz"}}}`
+	if string(data) != want {
+		t.Errorf("writeRegistryCredentials() = %s, want %s", data, want)
+	}
+}
+
+func Test_splitOCIReference(t *testing.T) {
+	tests := []struct {
+		name        string
+		chartRef    string
+		wantRef     string
+		wantVersion string
+	}{
+		{
+			name:        "split tag from reference",
+			chartRef:    "oci://registry.example.com/charts/postgresql:0.1.0",
+			wantRef:     "oci://registry.example.com/charts/postgresql",
+			wantVersion: "0.1.0",
+		},
+		{
+			name:        "split tag from reference with registry port",
+			chartRef:    "oci://registry.example.com:5000/charts/postgresql:0.1.0",
+			wantRef:     "oci://registry.example.com:5000/charts/postgresql",
+			wantVersion: "0.1.0",
+		},
+		{
+			name:        "return empty version if no tag",
+			chartRef:    "oci://registry.example.com:5000/charts/postgresql",
+			wantRef:     "oci://registry.example.com:5000/charts/postgresql",
+			wantVersion: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRef, gotVersion := splitOCIReference(tt.chartRef)
+			if gotRef != tt.wantRef || gotVersion != tt.wantVersion {
+				t.Errorf("splitOCIReference() = %v, %v, want %v, %v", gotRef, gotVersion, tt.wantRef, tt.wantVersion)
+			}
+		})
+	}
+}
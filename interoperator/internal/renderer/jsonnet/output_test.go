@@ -0,0 +1,44 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonnet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func Test_jsonnetOutput(t *testing.T) {
+	c := &jsonnetOutput{
+		content: *bytes.NewBuffer([]byte("fileContent")),
+	}
+
+	files, err := c.ListFiles()
+	if err != nil || !reflect.DeepEqual(files, []string{"main"}) {
+		t.Errorf("jsonnetOutput.ListFiles() = %v, %v, want [main]", files, err)
+	}
+
+	got, err := c.FileContent("main")
+	if err != nil || got != "fileContent" {
+		t.Errorf("jsonnetOutput.FileContent() = %v, %v, want fileContent", got, err)
+	}
+
+	_, err = c.FileContent("file2")
+	if err == nil {
+		t.Errorf("jsonnetOutput.FileContent() expected error for unknown file")
+	}
+}
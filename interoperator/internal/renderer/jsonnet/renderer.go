@@ -0,0 +1,204 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/google/go-jsonnet"
+	"sigs.k8s.io/yaml"
+)
+
+// Evaluations of jsonnet can't be interrupted. Evaluations exceeding the
+// timeout are abandoned and keep running until they complete. At most
+// maxAbandonedEvaluations of them run at a time, further evaluations fail
+// until they complete.
+const maxAbandonedEvaluations = 4
+
+var limits = struct {
+	sync.RWMutex
+	timeout       time.Duration
+	maxOutputSize int64
+}{}
+
+// abandoned is the number of evaluations which exceeded the timeout and
+// are still running
+var abandoned atomic.Int32
+
+// SetLimits sets the evaluation time and output size limits of snippets.
+// A value less than or equal to zero disables the limit.
+func SetLimits(timeout time.Duration, maxOutputSize int64) {
+	limits.Lock()
+	defer limits.Unlock()
+	limits.timeout = timeout
+	limits.maxOutputSize = maxOutputSize
+}
+
+func getLimits() (time.Duration, int64) {
+	limits.RLock()
+	defer limits.RUnlock()
+	return limits.timeout, limits.maxOutputSize
+}
+
+// rejectingImporter fails all imports, so that snippets can't read the
+// files of the interoperator
+type rejectingImporter struct {
+}
+
+func (rejectingImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	return jsonnet.Contents{}, "", fmt.Errorf("import of %s not allowed", importedPath)
+}
+
+type jsonnetRenderer struct {
+}
+
+type jsonnetInput struct {
+	content string
+	name    string
+	values  map[string]interface{}
+}
+
+// NewInput creates a new jsonnet Renderer input object. Snippets are only
+// provided in <content>, they can't be fetched from a url.
+func NewInput(content, name string, values map[string]interface{}) renderer.Input {
+	if content != "" {
+		return jsonnetInput{
+			content: content,
+			name:    name,
+			values:  values,
+		}
+	}
+	return nil
+}
+
+// New creates a new jsonnet Renderer object.
+func New() (renderer.Renderer, error) {
+	return &jsonnetRenderer{}, nil
+}
+
+// Render evaluates the jsonnet snippet with each of the values passed as an
+// external variable and converts the result into a renderer.Output object.
+// If the snippet evaluates to an array, each element is emitted as a separate
+// yaml document. If it evaluates to an object, it is emitted as a single document.
+// TODO Consider using streams (io.Writer or io.Reader) in the API instead of buffers.
+func (r *jsonnetRenderer) Render(rawInput renderer.Input) (renderer.Output, error) {
+	input, ok := rawInput.(jsonnetInput)
+	if !ok {
+		return nil, errors.NewRendererError("jsonnet", "invalid input", nil)
+	}
+
+	vm := jsonnet.MakeVM()
+	vm.Importer(rejectingImporter{})
+
+	// Sort keys so that errors are reported deterministically
+	keys := make([]string, 0, len(input.values))
+	for key := range input.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := json.Marshal(input.values[key])
+		if err != nil {
+			return nil, errors.NewRendererError("jsonnet", fmt.Sprintf("can't marshal external variable %s for %s", key, input.name), err)
+		}
+		vm.ExtCode(key, string(value))
+	}
+
+	timeout, maxOutputSize := getLimits()
+	jsonString, err := evaluate(vm, input.name, input.content, timeout)
+	if err != nil {
+		return nil, errors.NewRendererError("jsonnet", fmt.Sprintf("can't evaluate snippet for %s", input.name), err)
+	}
+	if maxOutputSize > 0 && int64(len(jsonString)) > maxOutputSize {
+		return nil, errors.NewRendererError("jsonnet", fmt.Sprintf("output for %s exceeds %d bytes", input.name, maxOutputSize), nil)
+	}
+
+	var result interface{}
+	err = json.Unmarshal([]byte(jsonString), &result)
+	if err != nil {
+		return nil, errors.NewRendererError("jsonnet", fmt.Sprintf("can't parse output for %s", input.name), err)
+	}
+
+	var documents []interface{}
+	switch x := result.(type) {
+	case nil:
+	case []interface{}:
+		documents = x
+	case map[string]interface{}:
+		documents = []interface{}{x}
+	default:
+		return nil, errors.NewRendererError("jsonnet", fmt.Sprintf("output for %s must be an object or an array. found %T", input.name, result), nil)
+	}
+
+	buf := new(bytes.Buffer)
+	for i, document := range documents {
+		if _, ok := document.(map[string]interface{}); !ok {
+			return nil, errors.NewRendererError("jsonnet", fmt.Sprintf("array elements for %s must be objects. found %T", input.name, document), nil)
+		}
+		out, err := yaml.Marshal(document)
+		if err != nil {
+			return nil, errors.NewRendererError("jsonnet", fmt.Sprintf("can't convert output for %s to yaml", input.name), err)
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(out)
+	}
+	return &jsonnetOutput{content: *buf}, nil
+}
+
+// evaluate evaluates the snippet within timeout
+func evaluate(vm *jsonnet.VM, name, content string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return vm.EvaluateAnonymousSnippet(name, content)
+	}
+	if abandoned.Load() >= maxAbandonedEvaluations {
+		return "", fmt.Errorf("%d evaluations exceeding the timeout still running", maxAbandonedEvaluations)
+	}
+
+	type result struct {
+		json string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		jsonString, err := vm.EvaluateAnonymousSnippet(name, content)
+		done <- result{json: jsonString, err: err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.json, r.err
+	case <-timer.C:
+		abandoned.Add(1)
+		go func() {
+			<-done
+			abandoned.Add(-1)
+		}()
+		return "", fmt.Errorf("evaluation exceeded %s", timeout)
+	}
+}
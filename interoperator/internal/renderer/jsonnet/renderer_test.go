@@ -0,0 +1,216 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonnet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/properties"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+)
+
+func TestNewInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    renderer.Input
+	}{
+		{
+			name:    "return renderer input",
+			content: "content",
+			want: jsonnetInput{
+				content: "content",
+				name:    "name",
+				values:  nil,
+			},
+		},
+		{
+			name:    "return nil if no content found",
+			content: "",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewInput(tt.content, "name", nil); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewInput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	got, err := New()
+	if err != nil {
+		t.Errorf("New() error = %v", err)
+		return
+	}
+	if got == nil || reflect.TypeOf(got) != reflect.TypeOf(&jsonnetRenderer{}) {
+		t.Errorf("New() = %v, want renderer.Renderer", got)
+	}
+}
+
+func Test_jsonnetRenderer_Render(t *testing.T) {
+	values := map[string]interface{}{
+		"instance": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":      "foo",
+				"namespace": "bar",
+			},
+		},
+	}
+
+	r, _ := New()
+	tests := []struct {
+		name     string
+		rawInput renderer.Input
+		wantErr  bool
+		want     string
+	}{
+		{
+			name:     "fail on invalid input",
+			rawInput: nil,
+			wantErr:  true,
+		},
+		{
+			name:     "fail on invalid snippet",
+			rawInput: NewInput("{ a: ", "name", values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail on unknown external variable",
+			rawInput: NewInput("std.extVar('binding')", "name", values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail if output is not an object or array",
+			rawInput: NewInput("'hello'", "name", values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail if array contains non objects",
+			rawInput: NewInput("[1, 2]", "name", values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail on import",
+			rawInput: NewInput("import '/var/run/secrets/kubernetes.io/serviceaccount/token'", "name", values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail on importstr",
+			rawInput: NewInput("{ token: importstr '/etc/hostname' }", "name", values),
+			wantErr:  true,
+		},
+		{
+			name:     "render null as empty output",
+			rawInput: NewInput("null", "name", values),
+			want:     "",
+		},
+		{
+			name: "render a single object",
+			rawInput: NewInput(`local instance = std.extVar('instance');
+{
+  provision: {
+    state: 'succeeded',
+    response: instance.metadata.name,
+  },
+}`, "name", values),
+			want: "provision:\n  response: foo\n  state: succeeded\n",
+		},
+		{
+			name: "render a list of objects",
+			rawInput: NewInput(`local instance = std.extVar('instance');
+[
+  { apiVersion: 'v1', kind: 'Secret', metadata: { name: instance.metadata.name } },
+  { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: instance.metadata.name } },
+]`, "name", values),
+			want: "apiVersion: v1\nkind: Secret\nmetadata:\n  name: foo\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Render(tt.rawInput)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jsonnetRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			out, err := got.FileContent("main")
+			if err != nil {
+				t.Errorf("jsonnetRenderer.Render() = result does not contain main file. error = %v", err)
+				return
+			}
+			if out != tt.want {
+				t.Errorf("jsonnetRenderer.Render() = %v, want %v", out, tt.want)
+			}
+		})
+	}
+}
+
+func Test_jsonnetRenderer_RenderConsumable(t *testing.T) {
+	r, _ := New()
+
+	got, err := r.Render(NewInput(`[{ apiVersion: 'v1', kind: 'Secret', metadata: { name: 'a' } },
+{ apiVersion: 'v1', kind: 'Secret', metadata: { name: 'b' } }]`, "name", nil))
+	if err != nil {
+		t.Fatalf("jsonnetRenderer.Render() error = %v", err)
+	}
+	out, _ := got.FileContent("main")
+	objects, err := dynamic.StringToUnstructured(out)
+	if err != nil || len(objects) != 2 || objects[1].GetName() != "b" {
+		t.Errorf("jsonnetRenderer.Render() output not convertible to objects. got = %v, err = %v", objects, err)
+	}
+
+	got, err = r.Render(NewInput(`{ provision: { state: 'in progress' } }`, "name", nil))
+	if err != nil {
+		t.Fatalf("jsonnetRenderer.Render() error = %v", err)
+	}
+	out, _ = got.FileContent("main")
+	status, err := properties.ParseStatus(out)
+	if err != nil || status.Provision.State != "in progress" {
+		t.Errorf("jsonnetRenderer.Render() output not parsable as status. got = %v, err = %v", status, err)
+	}
+}
+
+func Test_jsonnetRenderer_RenderLimits(t *testing.T) {
+	defer SetLimits(0, 0)
+	r, _ := New()
+
+	SetLimits(0, 16)
+	_, err := r.Render(NewInput(`{ data: std.repeat('x', 32) }`, "name", nil))
+	if err == nil {
+		t.Errorf("jsonnetRenderer.Render() succeeded, want output size error")
+	}
+
+	SetLimits(time.Millisecond, 0)
+	_, err = r.Render(NewInput(`{ sum: std.foldl(function(a, b) a + b, std.range(1, 1000000), 0) }`, "name", nil))
+	if err == nil {
+		t.Errorf("jsonnetRenderer.Render() succeeded, want timeout error")
+	}
+	for i := 0; i < 100 && abandoned.Load() > 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if abandoned.Load() != 0 {
+		t.Errorf("jsonnetRenderer.Render() abandoned evaluation still running")
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kustomize
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type kustomizeOutput struct {
+	content bytes.Buffer
+}
+
+// FileContent returns explicitly the content of the provided <filename>.
+func (c *kustomizeOutput) FileContent(filename string) (string, error) {
+	if filename == "main" {
+		return c.content.String(), nil
+	}
+	return "", fmt.Errorf("file %s not found in kustomize output", filename)
+}
+
+// ListFiles returns list of file names rendered
+func (c *kustomizeOutput) ListFiles() ([]string, error) {
+	return []string{"main"}, nil
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kustomize
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	// Directories in the in-memory filesystem where the base and the
+	// overlay are placed. Overlays refer to the base as ../base
+	baseDir    = "/base"
+	overlayDir = "/overlay"
+
+	// Upper bounds for the size of a base tarball and of the files
+	// extracted from it
+	maxBaseSize          = 10 << 20
+	maxExtractedBaseSize = 50 << 20
+
+	fetchTimeout = 30 * time.Second
+)
+
+type kustomizeRenderer struct {
+	gotemplateRenderer renderer.Renderer
+	httpClient         *http.Client
+}
+
+type kustomizeInput struct {
+	url             string
+	base            []byte
+	overlayTemplate string
+	name            string
+	namespace       string
+	libraries       []osbv1alpha1.TemplateLibraryRef
+	values          map[string]interface{}
+}
+
+// NewInput creates a new kustomize Renderer input object.
+// The base is read from <base> (a gzipped tarball) if set, otherwise from <url>.
+// <overlayTemplate> is a gotemplate for the kustomization.yaml of the overlay,
+// which can use the named templates of <libraries>.
+func NewInput(url string, base []byte, overlayTemplate, name, namespace string,
+	libraries []osbv1alpha1.TemplateLibraryRef, values map[string]interface{}) renderer.Input {
+	return kustomizeInput{
+		url:             url,
+		base:            base,
+		overlayTemplate: overlayTemplate,
+		name:            name,
+		namespace:       namespace,
+		libraries:       libraries,
+		values:          values,
+	}
+}
+
+// New creates a new kustomize Renderer object. The client is used by the
+// lookup function of the overlay template.
+func New(c client.Client) (renderer.Renderer, error) {
+	gotemplateRenderer, err := gotemplate.NewForRenderer(c, "kustomize")
+	if err != nil {
+		return nil, err
+	}
+	return &kustomizeRenderer{
+		gotemplateRenderer: gotemplateRenderer,
+		httpClient:         &http.Client{Timeout: fetchTimeout},
+	}, nil
+}
+
+// Render loads the kustomize base, renders the overlay and builds the
+// kustomization into a renderer.Output object.
+// TODO Consider using streams (io.Writer or io.Reader) in the API instead of buffers.
+func (r *kustomizeRenderer) Render(rawInput renderer.Input) (renderer.Output, error) {
+	input, ok := rawInput.(kustomizeInput)
+	if !ok {
+		return nil, errors.NewRendererError("kustomize", "invalid input to renderer", nil)
+	}
+
+	fSys := filesys.MakeFsInMemory()
+	err := r.loadBase(fSys, input)
+	if err != nil {
+		return nil, errors.NewRendererError("kustomize", fmt.Sprintf("failed to load base for %s", input.name), err)
+	}
+
+	target := baseDir
+	volatile := false
+	if strings.TrimSpace(input.overlayTemplate) != "" {
+		gotemplateInput := gotemplate.NewInput("", "", input.overlayTemplate, input.name, input.namespace, input.libraries, input.values)
+		gotemplateOutput, err := r.gotemplateRenderer.Render(gotemplateInput)
+		if err != nil {
+			return nil, errors.NewRendererError("kustomize", "failed to render overlay", err)
+		}
+		overlay, err := gotemplateOutput.FileContent("main")
+		if err != nil {
+			return nil, errors.NewRendererError("kustomize", "failed to read rendered overlay", err)
+		}
+		err = fSys.WriteFile(path.Join(overlayDir, konfig.DefaultKustomizationFileName()), []byte(overlay))
+		if err != nil {
+			return nil, errors.NewRendererError("kustomize", "failed to write overlay", err)
+		}
+		target = overlayDir
+		volatile = renderer.IsVolatile(gotemplateOutput)
+	}
+
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resMap, err := kustomizer.Run(fSys, target)
+	if err != nil {
+		return nil, errors.NewRendererError("kustomize", fmt.Sprintf("can't build kustomization for %s", input.name), err)
+	}
+
+	content, err := resMap.AsYaml()
+	if err != nil {
+		return nil, errors.NewRendererError("kustomize", fmt.Sprintf("can't convert kustomization for %s to yaml", input.name), err)
+	}
+	output := &kustomizeOutput{content: *bytes.NewBuffer(content)}
+	if volatile {
+		return renderer.MarkVolatile(output), nil
+	}
+	return output, nil
+}
+
+// loadBase populates the base directory in fSys either from the inline
+// tarball or from the url.
+func (r *kustomizeRenderer) loadBase(fSys filesys.FileSystem, input kustomizeInput) error {
+	if len(input.base) > 0 {
+		return extractTarball(fSys, bytes.NewReader(input.base))
+	}
+
+	url := input.url
+	switch {
+	case url == "":
+		return fmt.Errorf("neither base tarball nor url provided")
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		resp, err := r.httpClient.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to fetch %s. status %s", url, resp.Status)
+		}
+		return extractTarball(fSys, resp.Body)
+	}
+
+	localPath, err := renderer.LocalPath(url)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return copyDir(fSys, localPath)
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return extractTarball(fSys, file)
+}
+
+// copyDir copies the regular files of the local directory src into the
+// base directory of fSys. Symbolic links are skipped, as they may point
+// outside of the local template root.
+func copyDir(fSys filesys.FileSystem, src string) error {
+	return filepath.WalkDir(src, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		return fSys.WriteFile(path.Join(baseDir, filepath.ToSlash(relPath)), data)
+	})
+}
+
+// extractTarball extracts a gzipped tarball into the base directory of fSys.
+// If all the files are within a single top level directory, that directory
+// is stripped.
+func extractTarball(fSys filesys.FileSystem, src io.Reader) error {
+	gzipReader, err := gzip.NewReader(newLimitedReader(src, maxBaseSize))
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	files := make(map[string][]byte)
+	tarReader := tar.NewReader(newLimitedReader(gzipReader, maxExtractedBaseSize))
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("illegal file path %s in tarball", header.Name)
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return err
+		}
+		files[name] = data
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("tarball is empty")
+	}
+
+	prefix := commonDir(files)
+	for name, data := range files {
+		err = fSys.WriteFile(path.Join(baseDir, strings.TrimPrefix(name, prefix)), data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitedReader fails reads beyond limit bytes, unlike io.LimitReader which
+// ends the content silently
+type limitedReader struct {
+	reader    io.Reader
+	limit     int64
+	remaining int64
+}
+
+func newLimitedReader(reader io.Reader, limit int64) *limitedReader {
+	return &limitedReader{reader: reader, limit: limit, remaining: limit}
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, fmt.Errorf("base exceeds %d bytes", r.limit)
+	}
+	return n, err
+}
+
+// commonDir returns the top level directory (with trailing slash) shared
+// by all the files, or an empty string if there is none.
+func commonDir(files map[string][]byte) string {
+	prefix := ""
+	for name := range files {
+		index := strings.Index(name, "/")
+		if index < 0 {
+			return ""
+		}
+		dir := name[:index+1]
+		if prefix == "" {
+			prefix = dir
+		} else if prefix != dir {
+			return ""
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kustomize
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+)
+
+const sampleOverlay = `resources:
+- ../base
+namePrefix: {{ .instance.metadata.name }}-
+`
+
+func sampleTarball(t *testing.T, prefix string) []byte {
+	files := map[string]string{
+		"kustomization.yaml": "resources:\n- configmap.yaml\n",
+		"configmap.yaml":     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: sample\ndata:\n  key: value\n",
+	}
+	buf := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:     prefix + name,
+			Mode:     0600,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	return buf.Bytes()
+}
+
+// largeTarball returns a small tarball of a file exceeding
+// maxExtractedBaseSize
+func largeTarball(t *testing.T) []byte {
+	buf := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	err := tarWriter.WriteHeader(&tar.Header{
+		Name:     "kustomization.yaml",
+		Mode:     0600,
+		Size:     maxExtractedBaseSize + 1,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tarWriter.Write(make([]byte, maxExtractedBaseSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	return buf.Bytes()
+}
+
+func TestNewInput(t *testing.T) {
+	want := kustomizeInput{
+		url:             "url",
+		base:            []byte("base"),
+		overlayTemplate: "overlay",
+		name:            "name",
+		namespace:       "namespace",
+		values:          nil,
+	}
+	if got := NewInput("url", []byte("base"), "overlay", "name", "namespace", nil, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("NewInput() = %v, want %v", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	got, err := New(nil)
+	if err != nil {
+		t.Errorf("New(nil) error = %v", err)
+		return
+	}
+	if got == nil || reflect.TypeOf(got) != reflect.TypeOf(&kustomizeRenderer{}) {
+		t.Errorf("New(nil) = %v, want renderer.Renderer", got)
+	}
+}
+
+func Test_kustomizeRenderer_Render(t *testing.T) {
+	values := map[string]interface{}{
+		"instance": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": "foo",
+			},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/base.tgz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(sampleTarball(t, "base/"))
+	}))
+	defer server.Close()
+
+	defer renderer.SetLocalRoot("")
+	renderer.SetLocalRoot("samples")
+
+	r, _ := New(nil)
+	tests := []struct {
+		name     string
+		rawInput renderer.Input
+		wantErr  bool
+		contains []string
+	}{
+		{
+			name:     "fail on invalid input",
+			rawInput: nil,
+			wantErr:  true,
+		},
+		{
+			name:     "fail if no base is provided",
+			rawInput: NewInput("", nil, sampleOverlay, "name", "namespace", nil, values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail if base is not a tarball",
+			rawInput: NewInput("", []byte("base"), sampleOverlay, "name", "namespace", nil, values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail if overlay fails to render",
+			rawInput: NewInput("./samples/base", nil, "{{ .value | unknown_function }}", "name", "namespace", nil, values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail if url is not found",
+			rawInput: NewInput(server.URL+"/unknown.tgz", nil, sampleOverlay, "name", "namespace", nil, values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail on local directory outside of local root",
+			rawInput: NewInput("file://.", nil, sampleOverlay, "name", "namespace", nil, values),
+			wantErr:  true,
+		},
+		{
+			name:     "fail on base exceeding size once extracted",
+			rawInput: NewInput("", largeTarball(t), sampleOverlay, "name", "namespace", nil, values),
+			wantErr:  true,
+		},
+		{
+			name:     "render base from local directory",
+			rawInput: NewInput("./samples/base", nil, "", "name", "namespace", nil, values),
+			contains: []string{"name: sample", "key: value"},
+		},
+		{
+			name:     "render overlay on base from local directory",
+			rawInput: NewInput("file://./samples/base", nil, sampleOverlay, "name", "namespace", nil, values),
+			contains: []string{"name: foo-sample"},
+		},
+		{
+			name:     "render overlay on inline base",
+			rawInput: NewInput("", sampleTarball(t, ""), sampleOverlay, "name", "namespace", nil, values),
+			contains: []string{"name: foo-sample"},
+		},
+		{
+			name:     "render overlay on base fetched from url",
+			rawInput: NewInput(server.URL+"/base.tgz", nil, sampleOverlay, "name", "namespace", nil, values),
+			contains: []string{"name: foo-sample"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Render(tt.rawInput)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("kustomizeRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			content, err := got.FileContent("main")
+			if err != nil {
+				t.Errorf("kustomizeRenderer.Render() = result does not contain main file. error = %v", err)
+				return
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(content, s) {
+					t.Errorf("kustomizeRenderer.Render() = %v, want it to contain %v", content, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renderer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileScheme is the prefix of urls referring to the local file system
+const FileScheme = "file://"
+
+// localRoot is the directory below which templates can refer to local
+// charts and bases. Local files are not available if it is empty.
+var localRoot = struct {
+	sync.RWMutex
+	dir string
+}{}
+
+// SetLocalRoot sets the directory below which templates can refer to local
+// charts and bases, like those baked into the interoperator image. An
+// empty dir disables local files.
+func SetLocalRoot(dir string) {
+	localRoot.Lock()
+	defer localRoot.Unlock()
+	localRoot.dir = dir
+}
+
+// LocalPath returns the absolute path of the local file referred by url,
+// with or without the file:// prefix. Relative paths are resolved against
+// the working directory. It fails if the file, after resolving symbolic
+// links, is not below the local root.
+func LocalPath(url string) (string, error) {
+	localRoot.RLock()
+	root := localRoot.dir
+	localRoot.RUnlock()
+	if root == "" {
+		return "", fmt.Errorf("local path %s not allowed. No local template root configured", url)
+	}
+
+	path, err := filepath.Abs(strings.TrimPrefix(url, FileScheme))
+	if err != nil {
+		return "", err
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("local path %s not allowed. It is outside of the local template root %s", url, root)
+	}
+	return path, nil
+}
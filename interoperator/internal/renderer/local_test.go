@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renderer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalPath(t *testing.T) {
+	defer SetLocalRoot("")
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "templates")
+	chart := filepath.Join(root, "chart")
+	outside := filepath.Join(dir, "secrets")
+	for _, d := range []string{chart, outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "resolve path below root",
+			root: root,
+			url:  "file://" + chart,
+			want: chart,
+		},
+		{
+			name: "resolve path without scheme",
+			root: root,
+			url:  chart,
+			want: chart,
+		},
+		{
+			name:    "fail without root",
+			url:     "file://" + chart,
+			wantErr: true,
+		},
+		{
+			name:    "fail on path outside of root",
+			root:    root,
+			url:     "file://" + outside,
+			wantErr: true,
+		},
+		{
+			name:    "fail on path escaping root",
+			root:    root,
+			url:     "file://" + root + "/../secrets",
+			wantErr: true,
+		},
+		{
+			name:    "fail on link to path outside of root",
+			root:    root,
+			url:     "file://" + filepath.Join(root, "link"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetLocalRoot(tt.root)
+			got, err := LocalPath(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LocalPath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				want, _ := filepath.EvalSymlinks(tt.want)
+				if got != want {
+					t.Errorf("LocalPath() = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package offline renders the templates of a plan without a cluster. The
+// templates are rendered by the same code as in the provisioners, against
+// a fake client holding the service, plan, instance and binding along with
+// a list of objects provided upfront, which stand in for the objects in the
+// cluster.
+package offline
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/properties"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/resources"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// secretGeneratorKey is the master key for generating secrets in templates,
+// unless the objects hold the secret generator key secret
+const secretGeneratorKey = "offline"
+
+// Input holds the objects required for rendering the templates of a plan
+type Input struct {
+	Service  *osbv1alpha1.SFService
+	Plan     *osbv1alpha1.SFPlan
+	Instance *osbv1alpha1.SFServiceInstance
+	Binding  *osbv1alpha1.SFServiceBinding
+
+	// Objects is the list of objects which can be referred in the sources
+	// template. They stand in for the objects in the cluster. Objects
+	// without a namespace are put in the namespace of the instance.
+	Objects []*unstructured.Unstructured
+
+	// Libraries is the list of ConfigMaps holding the template libraries
+	// used by the plan. They are put in the interoperator namespace.
+	Libraries []*unstructured.Unstructured
+}
+
+// Result holds the outcome of rendering the templates of a plan
+type Result struct {
+	Resources []*unstructured.Unstructured  `json:"resources"`
+	Sources   map[string]osbv1alpha1.Source `json:"sources"`
+	Status    *properties.Status            `json:"status"`
+
+	// ClusterSelector is the label selector rendered by the clusterSelector
+	// template of the plan for provision
+	ClusterSelector string `json:"clusterSelector,omitempty"`
+}
+
+// Render renders the template of the plan for the action along with the
+// sources and status templates. As for the provisioners, the plan must
+// have the sources and the status templates.
+func Render(input *Input, action string) (*Result, error) {
+	if input == nil || input.Service == nil {
+		return nil, errors.NewInputError("Render", "service", nil)
+	}
+	if input.Plan == nil {
+		return nil, errors.NewInputError("Render", "plan", nil)
+	}
+	if input.Instance == nil {
+		return nil, errors.NewInputError("Render", "instance", nil)
+	}
+
+	bindingID := ""
+	switch action {
+	case osbv1alpha1.ProvisionAction:
+	case osbv1alpha1.BindAction, osbv1alpha1.UnbindAction:
+		if input.Binding == nil {
+			return nil, errors.NewInputError("Render", "binding", nil)
+		}
+		bindingID = input.Binding.GetName()
+	default:
+		return nil, errors.NewPreconditionError("Render", fmt.Sprintf("action %s not supported", action), nil)
+	}
+
+	c, err := newClient(input)
+	if err != nil {
+		return nil, err
+	}
+	instanceID := input.Instance.GetName()
+	serviceID := input.Service.Spec.ID
+	planID := input.Plan.Spec.ID
+	namespace := input.Instance.GetNamespace()
+	resourceManager := resources.New()
+
+	result := &Result{}
+	result.Sources, err = resources.ComputeSources(c, instanceID, bindingID, serviceID, planID, namespace)
+	if err != nil {
+		return nil, err
+	}
+	result.Resources, err = resourceManager.ComputeExpectedResources(c, instanceID, bindingID, serviceID, planID, action, namespace)
+	if err != nil {
+		return nil, err
+	}
+	result.Status, err = resourceManager.ComputeStatus(c, instanceID, bindingID, serviceID, planID, action, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := input.Plan.GetTemplate(osbv1alpha1.ClusterLabelSelectorAction); err == nil && action == osbv1alpha1.ProvisionAction {
+		result.ClusterSelector, err = resources.ComputeClusterSelector(c, input.Instance, input.Plan)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// newClient returns a fake client holding the objects of input. The service
+// and the plan are put in the interoperator namespace and labelled the way
+// the provisioners look them up.
+func newClient(input *Input) (client.Client, error) {
+	scheme := runtime.NewScheme()
+	err := clientgoscheme.AddToScheme(scheme)
+	if err != nil {
+		return nil, err
+	}
+	err = osbv1alpha1.AddToScheme(scheme)
+	if err != nil {
+		return nil, err
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	service := input.Service.DeepCopy()
+	service.SetNamespace(constants.InteroperatorNamespace)
+	service.SetLabels(addLabels(service.GetLabels(), map[string]string{
+		"serviceId": service.Spec.ID,
+	}))
+	plan := input.Plan.DeepCopy()
+	plan.SetNamespace(constants.InteroperatorNamespace)
+	plan.SetLabels(addLabels(plan.GetLabels(), map[string]string{
+		"serviceId": service.Spec.ID,
+		"planId":    plan.Spec.ID,
+	}))
+	objects := []client.Object{service, plan, input.Instance.DeepCopy()}
+	if input.Binding != nil {
+		objects = append(objects, input.Binding.DeepCopy())
+	}
+
+	keySecret := gotemplate.NewSecretGeneratorKeySecret(secretGeneratorKey)
+	hasKeySecret := false
+	for _, obj := range input.Objects {
+		obj = obj.DeepCopy()
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(input.Instance.GetNamespace())
+		}
+		if obj.GetAPIVersion() == "v1" && obj.GetKind() == "Secret" &&
+			obj.GetName() == keySecret.GetName() && obj.GetNamespace() == keySecret.GetNamespace() {
+			hasKeySecret = true
+		}
+		objects = append(objects, obj)
+	}
+	for _, library := range input.Libraries {
+		library = library.DeepCopy()
+		library.SetNamespace(constants.InteroperatorNamespace)
+		objects = append(objects, library)
+	}
+	if !hasKeySecret {
+		objects = append(objects, keySecret)
+	}
+
+	for _, obj := range objects {
+		obj.SetResourceVersion("")
+		err = c.Create(context.TODO(), obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s %s. %v",
+				obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+	}
+	return c, nil
+}
+
+func addLabels(labels map[string]string, added map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for key, value := range added {
+		labels[key] = value
+	}
+	return labels
+}
+
+// ReadObject decodes the yaml file at path into obj
+func ReadObject(path string, obj interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = yaml.Unmarshal(data, obj)
+	if err != nil {
+		return errors.NewUnmarshalError(fmt.Sprintf("unable to unmarshal %s", path), err)
+	}
+	return nil
+}
+
+// ReadObjects decodes the multi document yaml file at path
+func ReadObjects(path string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.StringToUnstructured(string(data))
+}
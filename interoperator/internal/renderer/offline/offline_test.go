@@ -0,0 +1,204 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package offline
+
+import (
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func readSamples(t *testing.T) *Input {
+	input := &Input{
+		Service:  &osbv1alpha1.SFService{},
+		Plan:     &osbv1alpha1.SFPlan{},
+		Instance: &osbv1alpha1.SFServiceInstance{},
+		Binding:  &osbv1alpha1.SFServiceBinding{},
+	}
+	files := map[string]interface{}{
+		"samples/service.yaml":  input.Service,
+		"samples/plan.yaml":     input.Plan,
+		"samples/instance.yaml": input.Instance,
+		"samples/binding.yaml":  input.Binding,
+	}
+	for path, obj := range files {
+		if err := ReadObject(path, obj); err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+	}
+	objects, err := ReadObjects("samples/objects.yaml")
+	if err != nil {
+		t.Fatalf("failed to read objects: %v", err)
+	}
+	input.Objects = objects
+	return input
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(input *Input)
+		action        string
+		wantErr       bool
+		wantResources []string
+		wantState     string
+	}{
+		{
+			name:          "render provision with objects from sources",
+			action:        osbv1alpha1.ProvisionAction,
+			wantResources: []string{"ConfigMap/instance-id", "Secret/instance-id"},
+			wantState:     "succeeded",
+		},
+		{
+			name: "render provision without objects",
+			setup: func(input *Input) {
+				input.Objects = nil
+			},
+			action:        osbv1alpha1.ProvisionAction,
+			wantResources: []string{"ConfigMap/instance-id", "Secret/instance-id"},
+			wantState:     "in progress",
+		},
+		{
+			name: "render provision with objects without namespace",
+			setup: func(input *Input) {
+				input.Objects[0].SetNamespace("")
+			},
+			action:        osbv1alpha1.ProvisionAction,
+			wantResources: []string{"ConfigMap/instance-id", "Secret/instance-id"},
+			wantState:     "succeeded",
+		},
+		{
+			name:          "render bind",
+			action:        osbv1alpha1.BindAction,
+			wantResources: []string{"Secret/binding-id"},
+			wantState:     "succeeded",
+		},
+		{
+			name: "fail bind without binding",
+			setup: func(input *Input) {
+				input.Binding = nil
+			},
+			action:  osbv1alpha1.BindAction,
+			wantErr: true,
+		},
+		{
+			name:    "fail on unsupported action",
+			action:  osbv1alpha1.StatusAction,
+			wantErr: true,
+		},
+		{
+			name: "fail without plan",
+			setup: func(input *Input) {
+				input.Plan = nil
+			},
+			action:  osbv1alpha1.ProvisionAction,
+			wantErr: true,
+		},
+		{
+			name: "fail if plan has no sources template",
+			setup: func(input *Input) {
+				var templates []osbv1alpha1.TemplateSpec
+				for _, template := range input.Plan.Spec.Templates {
+					if template.Action != osbv1alpha1.SourcesAction {
+						templates = append(templates, template)
+					}
+				}
+				input.Plan.Spec.Templates = templates
+			},
+			action:  osbv1alpha1.ProvisionAction,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := readSamples(t)
+			if tt.setup != nil {
+				tt.setup(input)
+			}
+			got, err := Render(input, tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			var resources []string
+			for _, obj := range got.Resources {
+				if obj.GetNamespace() != "sf-instance-id" {
+					t.Errorf("Render() namespace of %s = %s, want sf-instance-id", obj.GetName(), obj.GetNamespace())
+				}
+				resources = append(resources, obj.GetKind()+"/"+obj.GetName())
+			}
+			if len(resources) != len(tt.wantResources) {
+				t.Fatalf("Render() resources = %v, want %v", resources, tt.wantResources)
+			}
+			for i := range resources {
+				if resources[i] != tt.wantResources[i] {
+					t.Errorf("Render() resources = %v, want %v", resources, tt.wantResources)
+				}
+			}
+			if got.Sources["cm"].Name != "instance-id" {
+				t.Errorf("Render() sources = %v, want cm", got.Sources)
+			}
+			if got.Status == nil || got.Status.Provision.State != tt.wantState {
+				t.Errorf("Render() status = %v, want %s", got.Status, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestRender_provisioner(t *testing.T) {
+	// The resources are computed like in the provisioners
+	input := readSamples(t)
+	input.Plan.Spec.ServerSideApply = true
+	input.Plan.Spec.Templates[0].Content = `apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .instance.metadata.name }}
+stringData:
+  password: {{ stableSecret "password" 16 }}
+  persisted: {{ persistedSecret "password" 16 }}`
+	got, err := Render(input, osbv1alpha1.ProvisionAction)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if len(got.Resources) != 1 {
+		t.Fatalf("Render() resources = %v, want secret", got.Resources)
+	}
+	secret := got.Resources[0]
+	if secret.GetAnnotations()[constants.ServerSideApplyKey] != "true" {
+		t.Errorf("Render() annotations = %v, want server-side apply", secret.GetAnnotations())
+	}
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "stringData")
+	if len(data["password"]) != 16 || data["persisted"] != data["password"] {
+		t.Errorf("Render() secret data = %v, want generated password", data)
+	}
+}
+
+func TestReadObject(t *testing.T) {
+	plan := &osbv1alpha1.SFPlan{}
+	if err := ReadObject("samples/missing.yaml", plan); err == nil {
+		t.Errorf("ReadObject() expected error for missing file")
+	}
+	if err := ReadObject("samples/plan.yaml", plan); err != nil || plan.Spec.ID != "plan-id" {
+		t.Errorf("ReadObject() = %v, %v, want plan-id", plan.Spec.ID, err)
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_pluginOutput(t *testing.T) {
+	c := &pluginOutput{
+		content: "fileContent",
+	}
+
+	files, err := c.ListFiles()
+	if err != nil || !reflect.DeepEqual(files, []string{"main"}) {
+		t.Errorf("pluginOutput.ListFiles() = %v, %v, want [main]", files, err)
+	}
+
+	got, err := c.FileContent("main")
+	if err != nil || got != "fileContent" {
+		t.Errorf("pluginOutput.FileContent() = %v, %v, want fileContent", got, err)
+	}
+
+	_, err = c.FileContent("file2")
+	if err == nil {
+		t.Errorf("pluginOutput.FileContent() expected error for unknown file")
+	}
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements renderers which run outside the interoperator.
+// A plugin is either a binary executed for every render or a server
+// listening on a unix socket. The render request is passed to the plugin as
+// a JSON document and the plugin returns the rendered objects as a multi
+// document yaml.
+//
+// An executed plugin reads the request from stdin and writes the objects
+// to stdout. It fails the render by exiting with a non zero status, in
+// which case stderr is reported in the error. A plugin listening on a unix
+// socket serves the request as the body of a POST to /render and fails the
+// render by responding with a status other than 200.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+)
+
+const (
+	// ProtocolVersion is the version of the request sent to the plugins
+	ProtocolVersion = "v1"
+
+	// Maximum length of the stderr of a plugin or the error response
+	// included in the render error
+	maxErrorLength = 4096
+
+	socketRenderURL = "http://plugin/render"
+
+	// Duration for which the output of a killed plugin is read
+	waitDelay = time.Second
+)
+
+// Config is the configuration of a plugin. Exactly one of Command and
+// Socket is set.
+type Config struct {
+	// Command is the binary and its arguments executed for every render
+	Command []string
+
+	// Socket is the path of the unix socket the plugin listens on
+	Socket string
+}
+
+var plugins = struct {
+	sync.RWMutex
+	configs       map[string]Config
+	timeout       time.Duration
+	maxOutputSize int64
+}{
+	configs: make(map[string]Config),
+}
+
+// Register replaces the registered plugins with configs, keyed by the
+// renderer type. Renderer types are case insensitive.
+func Register(configs map[string]Config) {
+	registered := make(map[string]Config, len(configs))
+	for rendererType, config := range configs {
+		registered[strings.ToLower(rendererType)] = config
+	}
+	plugins.Lock()
+	defer plugins.Unlock()
+	plugins.configs = registered
+}
+
+// SetLimits sets the execution time and output size limits of the plugins.
+// A value less than or equal to zero disables the limit.
+func SetLimits(timeout time.Duration, maxOutputSize int64) {
+	plugins.Lock()
+	defer plugins.Unlock()
+	plugins.timeout = timeout
+	plugins.maxOutputSize = maxOutputSize
+}
+
+func getPlugin(rendererType string) (Config, time.Duration, int64, bool) {
+	plugins.RLock()
+	defer plugins.RUnlock()
+	config, ok := plugins.configs[strings.ToLower(rendererType)]
+	return config, plugins.timeout, plugins.maxOutputSize, ok
+}
+
+// Registered returns true if a plugin is registered for rendererType
+func Registered(rendererType string) bool {
+	_, _, _, ok := getPlugin(rendererType)
+	return ok
+}
+
+type pluginRenderer struct {
+	rendererType string
+}
+
+// request is the JSON document passed to the plugin
+type request struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Type            string                 `json:"type"`
+	Action          string                 `json:"action"`
+	Name            string                 `json:"name"`
+	Namespace       string                 `json:"namespace"`
+	URL             string                 `json:"url,omitempty"`
+	Content         string                 `json:"content,omitempty"`
+	Values          map[string]interface{} `json:"values"`
+}
+
+type pluginInput struct {
+	action    string
+	url       string
+	content   string
+	name      string
+	namespace string
+	values    map[string]interface{}
+}
+
+// NewInput creates a new plugin Renderer input object. The plugin receives
+// the <url> and the <content> of the template to render with <values>.
+func NewInput(action, url, content, name, namespace string, values map[string]interface{}) renderer.Input {
+	if strings.TrimSpace(content) == "" {
+		content = ""
+	}
+	return pluginInput{
+		action:    action,
+		url:       url,
+		content:   content,
+		name:      name,
+		namespace: namespace,
+		values:    values,
+	}
+}
+
+// New creates a new Renderer object for the plugin registered for
+// rendererType
+func New(rendererType string) (renderer.Renderer, error) {
+	if !Registered(rendererType) {
+		return nil, fmt.Errorf("no renderer plugin registered for type %s", rendererType)
+	}
+	return &pluginRenderer{
+		rendererType: rendererType,
+	}, nil
+}
+
+// Render passes the input to the plugin and returns the objects rendered
+// by it as the main file of the output
+func (r *pluginRenderer) Render(rawInput renderer.Input) (renderer.Output, error) {
+	input, ok := rawInput.(pluginInput)
+	if !ok {
+		return nil, errors.NewRendererError(r.rendererType, "invalid input to renderer", nil)
+	}
+
+	config, timeout, maxOutputSize, ok := getPlugin(r.rendererType)
+	if !ok {
+		return nil, errors.NewRendererError(r.rendererType, "renderer plugin not registered", nil)
+	}
+
+	body, err := json.Marshal(request{
+		ProtocolVersion: ProtocolVersion,
+		Type:            strings.ToLower(r.rendererType),
+		Action:          input.action,
+		Name:            input.name,
+		Namespace:       input.namespace,
+		URL:             input.url,
+		Content:         input.content,
+		Values:          input.values,
+	})
+	if err != nil {
+		return nil, errors.NewRendererError(r.rendererType, "failed to marshal values", err)
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var content []byte
+	if len(config.Command) > 0 {
+		content, err = execPlugin(ctx, config.Command, body, maxOutputSize)
+	} else {
+		content, err = callPlugin(ctx, config.Socket, body, maxOutputSize)
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		return nil, errors.NewRendererError(r.rendererType, fmt.Sprintf("plugin failed to render %s", input.name), err)
+	}
+
+	return &pluginOutput{
+		content: string(content),
+	}, nil
+}
+
+// execPlugin runs command with body on stdin and returns its stdout
+func execPlugin(ctx context.Context, command []string, body []byte, maxOutputSize int64) ([]byte, error) {
+	stdout := &limitedBuffer{max: maxOutputSize}
+	stderr := &limitedBuffer{max: maxErrorLength}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Children of the plugin may keep its output open after it is killed
+	cmd.WaitDelay = waitDelay
+	err := cmd.Run()
+	if err != nil {
+		message := strings.TrimSpace(stderr.buf.String())
+		if message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+		return nil, err
+	}
+	if stdout.exceeded {
+		return nil, fmt.Errorf("output exceeds the maximum size of %d bytes", maxOutputSize)
+	}
+	return stdout.buf.Bytes(), nil
+}
+
+// callPlugin posts body to the plugin listening on the unix socket and
+// returns the response
+func callPlugin(ctx context.Context, socket string, body []byte, maxOutputSize int64) ([]byte, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, socketRenderURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	reader := io.Reader(resp.Body)
+	if maxOutputSize > 0 {
+		reader = io.LimitReader(resp.Body, maxOutputSize+1)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxOutputSize > 0 && int64(len(content)) > maxOutputSize {
+		return nil, fmt.Errorf("output exceeds the maximum size of %d bytes", maxOutputSize)
+	}
+	return content, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the
+// rest, so that the plugin is not blocked writing its output
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max <= 0 {
+		return b.buf.Write(p)
+	}
+	remaining := b.max - int64(b.buf.Len())
+	if int64(len(p)) > remaining {
+		b.exceeded = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+)
+
+const renderedObjects = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`
+
+// socketPlugin starts a plugin listening on a unix socket which echoes the
+// content of the request
+func socketPlugin(t *testing.T) string {
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on socket: %v", err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var r request
+			if req.URL.Path != "/render" || json.NewDecoder(req.Body).Decode(&r) != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if r.Content == "fail" {
+				http.Error(w, "invalid template", http.StatusUnprocessableEntity)
+				return
+			}
+			fmt.Fprint(w, r.Content)
+		}),
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socket
+}
+
+func TestNew(t *testing.T) {
+	defer Register(nil)
+	Register(map[string]Config{"CUE": {Command: []string{"cue-plugin"}}})
+
+	if _, err := New("cue"); err != nil {
+		t.Errorf("New() error = %v", err)
+	}
+	if !Registered("Cue") {
+		t.Errorf("Registered() = false, want renderer types case insensitive")
+	}
+	if _, err := New("dsl"); err == nil {
+		t.Errorf("New() expected error for type without plugin")
+	}
+}
+
+func Test_pluginRenderer_Render(t *testing.T) {
+	defer Register(nil)
+	defer SetLimits(0, 0)
+
+	dir := t.TempDir()
+	requestFile := filepath.Join(dir, "request.json")
+	values := map[string]interface{}{
+		"instance": map[string]interface{}{"metadata": map[string]interface{}{"name": "instance-id"}},
+	}
+
+	tests := []struct {
+		name          string
+		config        Config
+		content       string
+		timeout       time.Duration
+		maxOutputSize int64
+		want          string
+		wantErr       string
+	}{
+		{
+			name: "render with executed plugin",
+			config: Config{
+				Command: []string{"sh", "-c", fmt.Sprintf("cat > %s; printf '%s'", requestFile, renderedObjects)},
+			},
+			content: "template",
+			want:    renderedObjects,
+		},
+		{
+			name:    "render with plugin listening on socket",
+			config:  Config{Socket: socketPlugin(t)},
+			content: renderedObjects,
+			want:    renderedObjects,
+		},
+		{
+			name: "fail with stderr if executed plugin fails",
+			config: Config{
+				Command: []string{"sh", "-c", "echo invalid template >&2; exit 3"},
+			},
+			wantErr: "invalid template",
+		},
+		{
+			name:    "fail with response if plugin listening on socket fails",
+			config:  Config{Socket: socketPlugin(t)},
+			content: "fail",
+			wantErr: "invalid template",
+		},
+		{
+			name:    "fail if socket not found",
+			config:  Config{Socket: filepath.Join(dir, "missing.sock")},
+			wantErr: "missing.sock",
+		},
+		{
+			name: "fail if executed plugin times out",
+			config: Config{
+				Command: []string{"sh", "-c", "sleep 5"},
+			},
+			timeout: 100 * time.Millisecond,
+			wantErr: "timed out",
+		},
+		{
+			name: "fail if output of executed plugin is too large",
+			config: Config{
+				Command: []string{"sh", "-c", "head -c 2048 /dev/zero"},
+			},
+			maxOutputSize: 1024,
+			wantErr:       "maximum size",
+		},
+		{
+			name:          "fail if output of plugin listening on socket is too large",
+			config:        Config{Socket: socketPlugin(t)},
+			content:       strings.Repeat("x", 2048),
+			maxOutputSize: 1024,
+			wantErr:       "maximum size",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Register(map[string]Config{"cue": tt.config})
+			SetLimits(tt.timeout, tt.maxOutputSize)
+			r, err := New("cue")
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			got, err := r.Render(NewInput("provision", "", tt.content, "instance-id/provision", "sf-instance-id", values))
+			if (err != nil) != (tt.wantErr != "") {
+				t.Errorf("pluginRenderer.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if !errors.RendererError(err) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("pluginRenderer.Render() error = %v, want RendererError containing %s", err, tt.wantErr)
+				}
+				return
+			}
+			content, _ := got.FileContent("main")
+			if content != tt.want {
+				t.Errorf("pluginRenderer.Render() = %v, want %v", content, tt.want)
+			}
+		})
+	}
+
+	// The executed plugin received the request on stdin
+	data, err := os.ReadFile(requestFile)
+	if err != nil {
+		t.Fatalf("failed to read request passed to plugin: %v", err)
+	}
+	var got request
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to unmarshal request passed to plugin: %v", err)
+	}
+	want := request{
+		ProtocolVersion: ProtocolVersion,
+		Type:            "cue",
+		Action:          "provision",
+		Name:            "instance-id/provision",
+		Namespace:       "sf-instance-id",
+		Content:         "template",
+		Values:          values,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("plugin request = %v, want %v", got, want)
+	}
+}
+
+func Test_pluginRenderer_Render_invalidInput(t *testing.T) {
+	defer Register(nil)
+	Register(map[string]Config{"cue": {Command: []string{"cat"}}})
+	r, _ := New("cue")
+	if _, err := r.Render(nil); !errors.RendererError(err) {
+		t.Errorf("pluginRenderer.Render() error = %v, want RendererError", err)
+	}
+}
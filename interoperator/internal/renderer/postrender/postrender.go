@@ -0,0 +1,248 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package postrender applies the post render patches of a template to the
+// objects rendered by any of the renderers.
+package postrender
+
+import (
+	"fmt"
+	"strings"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Apply renders the post render patches of template with values and
+// applies them in order to the objects of all the files in output. The
+// output is returned unchanged if the template has no patches. Patches are
+// only supported by the templates rendering resources, i.e. provision, bind,
+// unbind and the hooks. The client is used by the lookup function of the
+// patches and may be nil.
+func Apply(c client.Client, template *osbv1alpha1.TemplateSpec, name types.NamespacedName,
+	values map[string]interface{}, output renderer.Output) (renderer.Output, error) {
+	if template == nil || len(template.PostRender) == 0 {
+		return output, nil
+	}
+	if !supported(template.Action) {
+		return nil, errors.NewRendererError(template.Type, fmt.Sprintf("postRender is not supported by the %s template", template.Action), nil)
+	}
+
+	patches, volatile, err := renderPatches(c, template, name, values)
+	if err != nil {
+		return nil, err
+	}
+	volatile = volatile || renderer.IsVolatile(output)
+
+	files, err := output.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	patched := &postRenderOutput{
+		files:    files,
+		contents: make(map[string]string, len(files)),
+	}
+	for _, file := range files {
+		content, err := output.FileContent(file)
+		if err != nil {
+			return nil, err
+		}
+		objects, err := dynamic.StringToUnstructured(content)
+		if err != nil {
+			return nil, errors.NewRendererError(template.Type, fmt.Sprintf("failed to parse objects of file %s for post render", file), err)
+		}
+		for _, obj := range objects {
+			for i, p := range patches {
+				if !p.matches(obj) {
+					continue
+				}
+				err = p.apply(obj)
+				if err != nil {
+					return nil, errors.NewRendererError(template.Type,
+						fmt.Sprintf("failed to apply post render patch %d to %s %s", i, obj.GetKind(), obj.GetName()), err)
+				}
+			}
+		}
+		patched.contents[file], err = objectsToString(objects)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if volatile {
+		return renderer.MarkVolatile(patched), nil
+	}
+	return patched, nil
+}
+
+type patch struct {
+	patchType string
+	target    *osbv1alpha1.PatchTarget
+	data      []byte
+	jsonPatch jsonpatch.Patch
+}
+
+// renderPatches renders the patches of template as gotemplates and decodes
+// them. The patches are volatile if any of them looked up objects.
+func renderPatches(c client.Client, template *osbv1alpha1.TemplateSpec, name types.NamespacedName,
+	values map[string]interface{}) ([]*patch, bool, error) {
+	gotemplateRenderer, err := gotemplate.NewForRenderer(c, strings.ToLower(template.Type))
+	if err != nil {
+		return nil, false, err
+	}
+
+	volatile := false
+	patches := make([]*patch, 0, len(template.PostRender))
+	for i, postRender := range template.PostRender {
+		if postRender.Type != osbv1alpha1.StrategicMergePatchType && postRender.Type != osbv1alpha1.JSONPatchType {
+			return nil, false, errors.NewRendererError(template.Type, fmt.Sprintf("unsupported type %s of post render patch %d", postRender.Type, i), nil)
+		}
+
+		input := gotemplate.NewInput("", "", postRender.Patch, fmt.Sprintf("%s/%s/postRender/%d", name.Name, template.Action, i),
+			name.Namespace, template.Libraries, values)
+		if input == nil {
+			return nil, false, errors.NewRendererError(template.Type, fmt.Sprintf("post render patch %d is empty", i), nil)
+		}
+		output, err := gotemplateRenderer.Render(input)
+		if err != nil {
+			return nil, false, errors.NewRendererError(template.Type, fmt.Sprintf("failed to render post render patch %d", i), err)
+		}
+		volatile = volatile || renderer.IsVolatile(output)
+
+		content, err := output.FileContent("main")
+		if err != nil {
+			return nil, false, errors.NewRendererError(template.Type, fmt.Sprintf("failed to read post render patch %d", i), err)
+		}
+		data, err := yaml.YAMLToJSON([]byte(content))
+		if err != nil {
+			return nil, false, errors.NewRendererError(template.Type, fmt.Sprintf("failed to parse post render patch %d", i), err)
+		}
+
+		p := &patch{
+			patchType: postRender.Type,
+			target:    postRender.Target,
+			data:      data,
+		}
+		if p.patchType == osbv1alpha1.JSONPatchType {
+			p.jsonPatch, err = jsonpatch.DecodePatch(data)
+			if err != nil {
+				return nil, false, errors.NewRendererError(template.Type, fmt.Sprintf("failed to decode json patch %d", i), err)
+			}
+		}
+		patches = append(patches, p)
+	}
+	return patches, volatile, nil
+}
+
+// matches returns true if obj is selected by the target of the patch
+func (p *patch) matches(obj *unstructured.Unstructured) bool {
+	if p.target == nil {
+		return true
+	}
+	return (p.target.APIVersion == "" || p.target.APIVersion == obj.GetAPIVersion()) &&
+		(p.target.Kind == "" || p.target.Kind == obj.GetKind()) &&
+		(p.target.Name == "" || p.target.Name == obj.GetName())
+}
+
+// apply patches obj in place. Strategic merge patches of kinds not
+// registered in the client-go scheme are applied as json merge patches.
+func (p *patch) apply(obj *unstructured.Unstructured) error {
+	original, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	switch p.patchType {
+	case osbv1alpha1.JSONPatchType:
+		patched, err = p.jsonPatch.Apply(original)
+	default:
+		dataStruct, schemeErr := scheme.Scheme.New(obj.GroupVersionKind())
+		if schemeErr == nil {
+			patched, err = strategicpatch.StrategicMergePatch(original, p.data, dataStruct)
+		} else {
+			patched, err = jsonpatch.MergePatch(original, p.data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	patchedObj := &unstructured.Unstructured{}
+	err = patchedObj.UnmarshalJSON(patched)
+	if err != nil {
+		return err
+	}
+	obj.Object = patchedObj.Object
+	return nil
+}
+
+// objectsToString converts the objects to a multi document yaml string
+func objectsToString(objects []*unstructured.Unstructured) (string, error) {
+	documents := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return "", errors.NewMarshalError("unable to marshal to yaml", err)
+		}
+		documents = append(documents, string(data))
+	}
+	return strings.Join(documents, "---\n"), nil
+}
+
+// supported checks whether the output of the template of action holds
+// resources post render patches can be applied to
+func supported(action string) bool {
+	switch action {
+	case osbv1alpha1.ProvisionAction, osbv1alpha1.BindAction, osbv1alpha1.UnbindAction,
+		osbv1alpha1.PreProvisionAction, osbv1alpha1.PostProvisionAction, osbv1alpha1.PreUpdateAction,
+		osbv1alpha1.PostUpdateAction, osbv1alpha1.PreDeprovisionAction, osbv1alpha1.PostBindAction:
+		return true
+	}
+	return false
+}
+
+// postRenderOutput holds the patched files in the order of the original output
+type postRenderOutput struct {
+	files    []string
+	contents map[string]string
+}
+
+// FileContent returns the patched content of <filename>
+func (o *postRenderOutput) FileContent(filename string) (string, error) {
+	content, ok := o.contents[filename]
+	if !ok {
+		return "", fmt.Errorf("file not found")
+	}
+	return content, nil
+}
+
+// ListFiles returns the files of the original output
+func (o *postRenderOutput) ListFiles() ([]string, error) {
+	return o.files, nil
+}
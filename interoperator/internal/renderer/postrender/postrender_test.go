@@ -0,0 +1,351 @@
+/*
+Copyright 2024 The Service Fabrik Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postrender
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const renderedObjects = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: postgres
+spec:
+  template:
+    spec:
+      containers:
+      - name: postgres
+        image: docker.io/postgres:15
+      - name: exporter
+        image: docker.io/exporter:1
+---
+apiVersion: kubedb.com/v1alpha1
+kind: Postgres
+metadata:
+  name: postgres
+spec:
+  version: "15"
+  podTemplate:
+    spec:
+      nodeSelector:
+        pool: default
+`
+
+type testOutput struct {
+	files map[string]string
+}
+
+func (o *testOutput) FileContent(filename string) (string, error) {
+	content, ok := o.files[filename]
+	if !ok {
+		return "", fmt.Errorf("file not found")
+	}
+	return content, nil
+}
+
+func (o *testOutput) ListFiles() ([]string, error) {
+	return []string{"main", "config.yaml"}, nil
+}
+
+func newTestOutput() *testOutput {
+	return &testOutput{
+		files: map[string]string{
+			"main":        renderedObjects,
+			"config.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n",
+		},
+	}
+}
+
+func findObject(t *testing.T, output renderer.Output, kind string) *unstructured.Unstructured {
+	files, _ := output.ListFiles()
+	for _, file := range files {
+		content, err := output.FileContent(file)
+		if err != nil {
+			t.Fatalf("FileContent() error = %v", err)
+		}
+		objects, err := dynamic.StringToUnstructured(content)
+		if err != nil {
+			t.Fatalf("failed to parse patched output: %v", err)
+		}
+		for _, obj := range objects {
+			if obj.GetKind() == kind {
+				return obj
+			}
+		}
+	}
+	t.Fatalf("%s not found in patched output", kind)
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	gotemplate.SetLookupAllowList([]osbv1alpha1.APIVersionKind{
+		{APIVersion: "v1", Kind: "Secret"},
+	})
+	defer gotemplate.SetLookupAllowList(nil)
+
+	values := map[string]interface{}{
+		"instance": map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "instance-id"},
+		},
+	}
+	name := types.NamespacedName{Name: "instance-id", Namespace: "sf-instance-id"}
+
+	tests := []struct {
+		name         string
+		action       string
+		patches      []osbv1alpha1.PostRenderPatch
+		kind         string
+		path         []string
+		want         interface{}
+		wantErr      bool
+		wantVolatile bool
+	}{
+		{
+			name: "merge strategic patch into list by key",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:   osbv1alpha1.StrategicMergePatchType,
+					Target: &osbv1alpha1.PatchTarget{Kind: "Deployment"},
+					Patch: `spec:
+  template:
+    spec:
+      containers:
+      - name: postgres
+        image: registry.example.com/postgres:15`,
+				},
+			},
+			kind: "Deployment",
+			path: []string{"spec", "template", "spec", "containers"},
+			want: []interface{}{
+				map[string]interface{}{"name": "postgres", "image": "registry.example.com/postgres:15"},
+				map[string]interface{}{"name": "exporter", "image": "docker.io/exporter:1"},
+			},
+		},
+		{
+			name: "render patch with values",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:   osbv1alpha1.StrategicMergePatchType,
+					Target: &osbv1alpha1.PatchTarget{Kind: "Deployment"},
+					Patch:  `{"metadata": {"labels": {"instance": "{{ .instance.metadata.name }}"}}}`,
+				},
+			},
+			kind: "Deployment",
+			path: []string{"metadata", "labels", "instance"},
+			want: "instance-id",
+		},
+		{
+			name: "apply strategic patch of unknown kind as merge patch",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:   osbv1alpha1.StrategicMergePatchType,
+					Target: &osbv1alpha1.PatchTarget{APIVersion: "kubedb.com/v1alpha1", Kind: "Postgres", Name: "postgres"},
+					Patch: `spec:
+  podTemplate:
+    spec:
+      nodeSelector:
+        pool: {{ "services" }}`,
+				},
+			},
+			kind: "Postgres",
+			path: []string{"spec", "podTemplate", "spec", "nodeSelector"},
+			want: map[string]interface{}{"pool": "services"},
+		},
+		{
+			name: "apply json patch",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:   osbv1alpha1.JSONPatchType,
+					Target: &osbv1alpha1.PatchTarget{Kind: "Deployment"},
+					Patch: `- op: replace
+  path: /spec/template/spec/containers/1/image
+  value: registry.example.com/exporter:1`,
+				},
+			},
+			kind: "Deployment",
+			path: []string{"spec", "template", "spec", "containers"},
+			want: []interface{}{
+				map[string]interface{}{"name": "postgres", "image": "docker.io/postgres:15"},
+				map[string]interface{}{"name": "exporter", "image": "registry.example.com/exporter:1"},
+			},
+		},
+		{
+			name: "apply patches without target to all objects",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:  osbv1alpha1.StrategicMergePatchType,
+					Patch: `metadata: {annotations: {landscape: dev}}`,
+				},
+			},
+			kind: "ConfigMap",
+			path: []string{"metadata", "annotations", "landscape"},
+			want: "dev",
+		},
+		{
+			name: "apply patches in order",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:  osbv1alpha1.StrategicMergePatchType,
+					Patch: `metadata: {annotations: {landscape: dev}}`,
+				},
+				{
+					Type:  osbv1alpha1.JSONPatchType,
+					Patch: `[{"op": "replace", "path": "/metadata/annotations/landscape", "value": "live"}]`,
+				},
+			},
+			kind: "Postgres",
+			path: []string{"metadata", "annotations", "landscape"},
+			want: "live",
+		},
+		{
+			name: "not patch objects not matching target",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:   osbv1alpha1.StrategicMergePatchType,
+					Target: &osbv1alpha1.PatchTarget{Kind: "Deployment", Name: "other"},
+					Patch:  `metadata: {annotations: {landscape: dev}}`,
+				},
+			},
+			kind: "Deployment",
+			path: []string{"metadata", "annotations"},
+			want: nil,
+		},
+		{
+			name: "mark output volatile if patch looks up objects",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:  osbv1alpha1.StrategicMergePatchType,
+					Patch: `metadata: {annotations: {found: "{{ len (lookup "v1" "Secret" "" "secret") }}"}}`,
+				},
+			},
+			kind:         "ConfigMap",
+			path:         []string{"metadata", "annotations", "found"},
+			want:         "0",
+			wantVolatile: true,
+		},
+		{
+			name:   "apply patches to hook templates",
+			action: osbv1alpha1.PreUpdateAction,
+			patches: []osbv1alpha1.PostRenderPatch{
+				{Type: osbv1alpha1.StrategicMergePatchType, Patch: `metadata: {labels: {team: db}}`},
+			},
+			kind: "ConfigMap",
+			path: []string{"metadata", "labels", "team"},
+			want: "db",
+		},
+		{
+			name:   "fail on patches of status template",
+			action: osbv1alpha1.StatusAction,
+			patches: []osbv1alpha1.PostRenderPatch{
+				{Type: osbv1alpha1.StrategicMergePatchType, Patch: `metadata: {}`},
+			},
+			wantErr: true,
+		},
+		{
+			name:   "fail on patches of clusterSelector template",
+			action: osbv1alpha1.ClusterLabelSelectorAction,
+			patches: []osbv1alpha1.PostRenderPatch{
+				{Type: osbv1alpha1.StrategicMergePatchType, Patch: `metadata: {}`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail on unsupported patch type",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{Type: "merge", Patch: `metadata: {}`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail on empty patch",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{Type: osbv1alpha1.StrategicMergePatchType},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail on invalid patch",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{Type: osbv1alpha1.StrategicMergePatchType, Patch: `metadata: [}`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail if json patch can not be applied",
+			patches: []osbv1alpha1.PostRenderPatch{
+				{
+					Type:  osbv1alpha1.JSONPatchType,
+					Patch: `[{"op": "replace", "path": "/spec/missing", "value": "x"}]`,
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &osbv1alpha1.TemplateSpec{
+				Action:     osbv1alpha1.ProvisionAction,
+				Type:       "helm",
+				PostRender: tt.patches,
+			}
+			if tt.action != "" {
+				template.Action = tt.action
+			}
+			got, err := Apply(nil, template, name, values, newTestOutput())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.RendererError(err) {
+					t.Errorf("Apply() error = %v, want RendererError", err)
+				}
+				return
+			}
+			if renderer.IsVolatile(got) != tt.wantVolatile {
+				t.Errorf("Apply() volatile = %v, want %v", renderer.IsVolatile(got), tt.wantVolatile)
+			}
+			files, _ := got.ListFiles()
+			if !reflect.DeepEqual(files, []string{"main", "config.yaml"}) {
+				t.Errorf("Apply() files = %v, want files of original output", files)
+			}
+			value, _, _ := unstructured.NestedFieldNoCopy(findObject(t, got, tt.kind).Object, tt.path...)
+			if !reflect.DeepEqual(value, tt.want) {
+				t.Errorf("Apply() %s %v = %v, want %v", tt.kind, tt.path, value, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply_noPatches(t *testing.T) {
+	output := newTestOutput()
+	got, err := Apply(nil, &osbv1alpha1.TemplateSpec{Type: "gotemplate"}, types.NamespacedName{}, nil, output)
+	if err != nil || got != output {
+		t.Errorf("Apply() = %v, %v, want original output", got, err)
+	}
+}
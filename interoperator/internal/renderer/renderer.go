@@ -31,3 +31,33 @@ type Output interface {
 	FileContent(filename string) (string, error)
 	ListFiles() ([]string, error)
 }
+
+// VolatileOutput is implemented by outputs which depend on more than the
+// input, like the objects read from the cluster by templates. Volatile
+// outputs are not cached.
+type VolatileOutput interface {
+	Output
+	Volatile() bool
+}
+
+// IsVolatile returns true if output depends on more than the input
+func IsVolatile(output Output) bool {
+	volatile, ok := output.(VolatileOutput)
+	return ok && volatile.Volatile()
+}
+
+type volatileOutput struct {
+	Output
+}
+
+func (volatileOutput) Volatile() bool {
+	return true
+}
+
+// MarkVolatile marks output as volatile
+func MarkVolatile(output Output) Output {
+	if IsVolatile(output) {
+		return output
+	}
+	return volatileOutput{Output: output}
+}
@@ -0,0 +1,108 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// adoptionAllowed returns true if object is annotated to allow the adoption
+// of existing resources
+func adoptionAllowed(object metav1.Object) bool {
+	enabled, _ := strconv.ParseBool(object.GetAnnotations()[constants.AdoptKey])
+	return enabled
+}
+
+// sfOwnerReferences returns the owner references of resource to instances
+// and bindings
+func sfOwnerReferences(resource *unstructured.Unstructured) []metav1.OwnerReference {
+	ownerReferences := []metav1.OwnerReference{}
+	for _, ref := range resource.GetOwnerReferences() {
+		if ref.APIVersion == osbv1alpha1.GroupVersion.String() {
+			ownerReferences = append(ownerReferences, ref)
+		}
+	}
+	return ownerReferences
+}
+
+// adoptResource checks that foundResource, the existing object of
+// expectedResource, belongs to the owner of expectedResource. Objects owned
+// by other instances or bindings are never adopted. Objects not owned by any
+// instance or binding are adopted if they were retained by the same
+// instance, or if the object, the rendered resource or the owning instance
+// are annotated to allow adoption. Adopted objects get the owner references
+// of expectedResource and lose their retention markers. An AdoptionConflict
+// is returned if foundResource is not adopted.
+func adoptResource(client kubernetes.Client, expectedResource, foundResource *unstructured.Unstructured) error {
+	owners := sfOwnerReferences(expectedResource)
+	if len(owners) == 0 {
+		return nil
+	}
+	foundOwners := sfOwnerReferences(foundResource)
+	for _, owner := range owners {
+		for _, foundOwner := range foundOwners {
+			if owner.UID == foundOwner.UID {
+				return nil
+			}
+		}
+	}
+
+	kind := expectedResource.GetKind()
+	namespacedName := types.NamespacedName{
+		Name:      expectedResource.GetName(),
+		Namespace: expectedResource.GetNamespace(),
+	}
+	if len(foundOwners) > 0 {
+		return errors.NewAdoptionConflict(kind, namespacedName.String(),
+			fmt.Sprintf("is owned by %s %s", foundOwners[0].Kind, foundOwners[0].Name), nil)
+	}
+
+	instanceID := ownerInstanceID(expectedResource)
+	allowed := adoptionAllowed(foundResource) || adoptionAllowed(expectedResource) ||
+		(instanceID != "" && foundResource.GetLabels()[constants.RetainedInstanceIDKey] == instanceID)
+	if !allowed && instanceID != "" {
+		instance := &osbv1alpha1.SFServiceInstance{}
+		err := client.Get(context.TODO(), types.NamespacedName{
+			Name:      instanceID,
+			Namespace: namespacedName.Namespace,
+		}, instance)
+		if err != nil && !apiErrors.IsNotFound(err) {
+			log.Error(err, "reconcile - failed fetching owner of resource", "kind", kind, "namespacedName", namespacedName)
+			return err
+		}
+		allowed = err == nil && adoptionAllowed(instance)
+	}
+	if !allowed {
+		return errors.NewAdoptionConflict(kind, namespacedName.String(),
+			fmt.Sprintf("is not managed by the interoperator. Annotate it with %s: \"true\" to adopt it", constants.AdoptKey), nil)
+	}
+
+	log.Info("reconcile - adopting resource", "kind", kind, "namespacedName", namespacedName, "owner", owners[0].Name)
+	return updateWithRetry(client, foundResource, func() error {
+		if len(sfOwnerReferences(foundResource)) > 0 {
+			return fmt.Errorf("adopted concurrently")
+		}
+		foundResource.SetOwnerReferences(append(foundResource.GetOwnerReferences(), owners...))
+
+		labels := foundResource.GetLabels()
+		delete(labels, constants.RetainedInstanceIDKey)
+		foundResource.SetLabels(labels)
+
+		// The annotation of the object allows a single adoption
+		annotations := foundResource.GetAnnotations()
+		delete(annotations, constants.RetainUntilKey)
+		delete(annotations, constants.AdoptKey)
+		foundResource.SetAnnotations(annotations)
+		return nil
+	})
+}
@@ -0,0 +1,128 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_adoptResource(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	expected, err := dynamic.StringToUnstructured(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: adopted-config
+  namespace: default
+  ownerReferences:
+  - apiVersion: osb.servicefabrik.io/v1alpha1
+    kind: SFServiceInstance
+    name: instance-id
+    uid: 5bd9a4ea-2d1b-4b8e-8a47-1f0e2b4f7d10
+data:
+  port: "5432"`)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	expectedResource := expected[0]
+
+	tests := []struct {
+		name    string
+		found   string
+		wantErr bool
+	}{
+		{
+			name: "keep resource owned by the instance",
+			found: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: adopted-config
+  namespace: default
+  ownerReferences:
+  - apiVersion: osb.servicefabrik.io/v1alpha1
+    kind: SFServiceInstance
+    name: instance-id
+    uid: 5bd9a4ea-2d1b-4b8e-8a47-1f0e2b4f7d10`,
+		},
+		{
+			name: "refuse resource owned by another instance",
+			found: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: adopted-config
+  namespace: default
+  annotations:
+    interoperator.servicefabrik.io/adopt: "true"
+  ownerReferences:
+  - apiVersion: osb.servicefabrik.io/v1alpha1
+    kind: SFServiceInstance
+    name: other-instance-id
+    uid: 0c7b4e52-6f0e-4d8a-9a43-7d2f3c1e9b21`,
+			wantErr: true,
+		},
+		{
+			name: "refuse unowned resource",
+			found: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: adopted-config
+  namespace: default`,
+			wantErr: true,
+		},
+		{
+			name: "adopt unowned resource annotated for adoption",
+			found: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: adopted-config
+  namespace: default
+  annotations:
+    interoperator.servicefabrik.io/adopt: "true"`,
+		},
+		{
+			name: "adopt resource retained by the instance",
+			found: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: adopted-config
+  namespace: default
+  labels:
+    interoperator.servicefabrik.io/retained-instance-id: instance-id
+  annotations:
+    interoperator.servicefabrik.io/retain-until: "2020-01-01T00:00:00Z"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewGomegaWithT(t)
+			found, err := dynamic.StringToUnstructured(tt.found)
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+			foundResource := found[0]
+			g.Expect(c.Create(context.TODO(), foundResource)).NotTo(gomega.HaveOccurred())
+			defer c.Delete(context.TODO(), foundResource)
+
+			err = adoptResource(c, expectedResource, foundResource)
+			if tt.wantErr {
+				g.Expect(errors.AdoptionConflict(err)).To(gomega.BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+
+			current := &unstructured.Unstructured{}
+			current.SetGroupVersionKind(foundResource.GroupVersionKind())
+			key := types.NamespacedName{Name: "adopted-config", Namespace: constants.InteroperatorNamespace}
+			g.Expect(c.Get(context.TODO(), key, current)).NotTo(gomega.HaveOccurred())
+			g.Expect(current.GetOwnerReferences()).To(gomega.Equal(expectedResource.GetOwnerReferences()))
+			g.Expect(current.GetLabels()).NotTo(gomega.HaveKey(constants.RetainedInstanceIDKey))
+			g.Expect(current.GetAnnotations()).NotTo(gomega.HaveKey(constants.RetainUntilKey))
+			g.Expect(current.GetAnnotations()).NotTo(gomega.HaveKey(constants.AdoptKey))
+		})
+	}
+
+	// Resources of owners other than instances and bindings are not checked
+	g.Expect(adoptResource(c, &unstructured.Unstructured{}, expectedResource)).To(gomega.Succeed())
+}
@@ -0,0 +1,181 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Strategies for deleting sub resources
+const (
+	deleteStrategyDelete      = "delete"
+	deleteStrategyBackground  = "background"
+	deleteStrategyForeground  = "foreground"
+	deleteStrategyOrphan      = "orphan"
+	deleteStrategyStatusField = "statusField"
+	deleteStrategyAnnotation  = "annotation"
+)
+
+// defaultDeleteStrategies are used for the resources not matched by the
+// configured strategies. The service fabrik operators delete their
+// resources once status.state is set to delete.
+var defaultDeleteStrategies = []config.DeleteStrategy{
+	{
+		APIVersion: "deployment.servicefabrik.io/v1alpha1",
+		Strategy:   deleteStrategyStatusField,
+	},
+	{
+		APIVersion: "bind.servicefabrik.io/v1alpha1",
+		Strategy:   deleteStrategyStatusField,
+	},
+}
+
+var (
+	deleteStrategiesMutex sync.RWMutex
+	deleteStrategies      []config.DeleteStrategy
+)
+
+// SetDeleteStrategies sets the strategies used to delete sub resources.
+// Invalid strategies are logged and ignored.
+func SetDeleteStrategies(strategies []config.DeleteStrategy) {
+	valid := make([]config.DeleteStrategy, 0, len(strategies))
+	for _, strategy := range strategies {
+		if err := validateDeleteStrategy(strategy); err != nil {
+			log.Error(err, "Ignoring delete strategy", "apiVersion", strategy.APIVersion, "kind", strategy.Kind)
+			continue
+		}
+		valid = append(valid, strategy)
+	}
+	deleteStrategiesMutex.Lock()
+	defer deleteStrategiesMutex.Unlock()
+	deleteStrategies = valid
+}
+
+func validateDeleteStrategy(strategy config.DeleteStrategy) error {
+	if strategy.APIVersion == "" {
+		return fmt.Errorf("apiVersion must be set")
+	}
+	switch strategy.Strategy {
+	case deleteStrategyDelete, deleteStrategyBackground, deleteStrategyForeground,
+		deleteStrategyOrphan, deleteStrategyStatusField:
+		return nil
+	case deleteStrategyAnnotation:
+		if strategy.Annotation == "" {
+			return fmt.Errorf("annotation must be set for strategy %s", strategy.Strategy)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown delete strategy %q", strategy.Strategy)
+}
+
+// deleteStrategyFor returns the strategy used to delete resource
+func deleteStrategyFor(resource *unstructured.Unstructured) config.DeleteStrategy {
+	deleteStrategiesMutex.RLock()
+	defer deleteStrategiesMutex.RUnlock()
+	for _, strategies := range [][]config.DeleteStrategy{deleteStrategies, defaultDeleteStrategies} {
+		for _, strategy := range strategies {
+			if strategy.APIVersion == resource.GetAPIVersion() &&
+				(strategy.Kind == "" || strategy.Kind == resource.GetKind()) {
+				return strategy
+			}
+		}
+	}
+	return config.DeleteStrategy{Strategy: deleteStrategyDelete}
+}
+
+func deleteSubResource(client kubernetes.Client, resource *unstructured.Unstructured) error {
+	strategy := deleteStrategyFor(resource)
+	switch strategy.Strategy {
+	case deleteStrategyBackground:
+		return client.Delete(context.TODO(), resource, kubernetes.PropagationPolicy(metav1.DeletePropagationBackground))
+	case deleteStrategyForeground:
+		return client.Delete(context.TODO(), resource, kubernetes.PropagationPolicy(metav1.DeletePropagationForeground))
+	case deleteStrategyOrphan:
+		return client.Delete(context.TODO(), resource, kubernetes.PropagationPolicy(metav1.DeletePropagationOrphan))
+	case deleteStrategyStatusField:
+		field := strategy.Field
+		if field == "" {
+			field = "status.state"
+		}
+		value := strategy.Value
+		if value == "" {
+			value = "delete"
+		}
+		path := strings.Split(field, ".")
+		setField := func() error {
+			return unstructured.SetNestedField(resource.Object, value, path...)
+		}
+		err := updateWithRetry(client, resource, setField)
+		if err != nil {
+			return err
+		}
+		// Resources with a status subresource ignore changes of the status
+		// on update
+		if current, _, _ := unstructured.NestedString(resource.Object, path...); current == value {
+			return nil
+		}
+		return updateStatusWithRetry(client, resource, setField)
+	case deleteStrategyAnnotation:
+		value := strategy.Value
+		if value == "" {
+			value = "true"
+		}
+		return updateWithRetry(client, resource, func() error {
+			annotations := resource.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[strategy.Annotation] = value
+			resource.SetAnnotations(annotations)
+			return nil
+		})
+	}
+	return client.Delete(context.TODO(), resource)
+}
+
+// updateWithRetry fetches resource, changes it using mutate and updates it.
+// It is retried if the resource changed in between.
+func updateWithRetry(client kubernetes.Client, resource *unstructured.Unstructured, mutate func() error) error {
+	namespacedName := types.NamespacedName{
+		Name:      resource.GetName(),
+		Namespace: resource.GetNamespace(),
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := client.Get(context.TODO(), namespacedName, resource)
+		if err != nil {
+			return err
+		}
+		if err = mutate(); err != nil {
+			return fmt.Errorf("failed to update %s %s: %v", resource.GetKind(), namespacedName, err)
+		}
+		return client.Update(context.TODO(), resource)
+	})
+}
+
+// updateStatusWithRetry is the same as updateWithRetry, but updates the
+// status subresource of resource
+func updateStatusWithRetry(client kubernetes.Client, resource *unstructured.Unstructured, mutate func() error) error {
+	namespacedName := types.NamespacedName{
+		Name:      resource.GetName(),
+		Namespace: resource.GetNamespace(),
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := client.Get(context.TODO(), namespacedName, resource)
+		if err != nil {
+			return err
+		}
+		if err = mutate(); err != nil {
+			return fmt.Errorf("failed to update status of %s %s: %v", resource.GetKind(), namespacedName, err)
+		}
+		return client.Status().Update(context.TODO(), resource)
+	})
+}
@@ -0,0 +1,152 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/config"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/onsi/gomega"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_deleteStrategyFor(t *testing.T) {
+	defer SetDeleteStrategies(nil)
+	SetDeleteStrategies([]config.DeleteStrategy{
+		{APIVersion: "kubedb.com/v1alpha1", Kind: "Postgres", Strategy: "annotation", Annotation: "kubedb.com/delete"},
+		{APIVersion: "kubedb.com/v1alpha1", Strategy: "foreground"},
+		{APIVersion: "bind.servicefabrik.io/v1alpha1", Kind: "DirectorBind", Strategy: "orphan"},
+		{APIVersion: "apps/v1", Strategy: "annotation"},
+		{APIVersion: "batch/v1", Strategy: "recreate"},
+	})
+	resource := func(apiVersion, kind string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		return obj
+	}
+	tests := []struct {
+		name     string
+		resource *unstructured.Unstructured
+		want     string
+	}{
+		{
+			name:     "use strategy of kind",
+			resource: resource("kubedb.com/v1alpha1", "Postgres"),
+			want:     "annotation",
+		},
+		{
+			name:     "use strategy of apiVersion",
+			resource: resource("kubedb.com/v1alpha1", "MySQL"),
+			want:     "foreground",
+		},
+		{
+			name:     "override default strategy",
+			resource: resource("bind.servicefabrik.io/v1alpha1", "DirectorBind"),
+			want:     "orphan",
+		},
+		{
+			name:     "use default strategy of service fabrik operators",
+			resource: resource("deployment.servicefabrik.io/v1alpha1", "Director"),
+			want:     "statusField",
+		},
+		{
+			name:     "ignore annotation strategy without annotation",
+			resource: resource("apps/v1", "Deployment"),
+			want:     "delete",
+		},
+		{
+			name:     "ignore unknown strategy",
+			resource: resource("batch/v1", "Job"),
+			want:     "delete",
+		},
+		{
+			name:     "delete other resources",
+			resource: resource("v1", "ConfigMap"),
+			want:     "delete",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deleteStrategyFor(tt.resource); got.Strategy != tt.want {
+				t.Errorf("deleteStrategyFor() = %v, want %v", got.Strategy, tt.want)
+			}
+		})
+	}
+}
+
+func Test_deleteSubResource_strategies(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	defer SetDeleteStrategies(nil)
+
+	configMap := func(name string) *unstructured.Unstructured {
+		resource := &unstructured.Unstructured{}
+		resource.SetAPIVersion("v1")
+		resource.SetKind("ConfigMap")
+		resource.SetNamespace(constants.InteroperatorNamespace)
+		resource.SetName(name)
+		return resource
+	}
+	key := func(resource *unstructured.Unstructured) types.NamespacedName {
+		return types.NamespacedName{Name: resource.GetName(), Namespace: resource.GetNamespace()}
+	}
+
+	// Mark the resource with an annotation
+	SetDeleteStrategies([]config.DeleteStrategy{
+		{APIVersion: "v1", Kind: "ConfigMap", Strategy: "annotation", Annotation: "example.com/delete"},
+	})
+	annotated := configMap("annotated-configmap")
+	g.Expect(c.Create(context.TODO(), annotated)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), annotated)
+	g.Expect(deleteSubResource(c, configMap("annotated-configmap"))).NotTo(gomega.HaveOccurred())
+	current := configMap("annotated-configmap")
+	g.Expect(c.Get(context.TODO(), key(current), current)).NotTo(gomega.HaveOccurred())
+	g.Expect(current.GetAnnotations()).To(gomega.HaveKeyWithValue("example.com/delete", "true"))
+
+	// Set a field of the resource
+	SetDeleteStrategies([]config.DeleteStrategy{
+		{APIVersion: "v1", Strategy: "statusField", Field: "data.state", Value: "deleting"},
+	})
+	flipped := configMap("flipped-configmap")
+	g.Expect(c.Create(context.TODO(), flipped)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), flipped)
+	g.Expect(deleteSubResource(c, configMap("flipped-configmap"))).NotTo(gomega.HaveOccurred())
+	current = configMap("flipped-configmap")
+	g.Expect(c.Get(context.TODO(), key(current), current)).NotTo(gomega.HaveOccurred())
+	state, _, _ := unstructured.NestedString(current.Object, "data", "state")
+	g.Expect(state).To(gomega.Equal("deleting"))
+
+	// Set a field in the status subresource of the resource
+	SetDeleteStrategies([]config.DeleteStrategy{
+		{APIVersion: "osb.servicefabrik.io/v1alpha1", Kind: "SFServiceInstance", Strategy: "statusField"},
+	})
+	instance := &unstructured.Unstructured{}
+	instance.SetAPIVersion("osb.servicefabrik.io/v1alpha1")
+	instance.SetKind("SFServiceInstance")
+	instance.SetNamespace(constants.InteroperatorNamespace)
+	instance.SetName("status-instance")
+	g.Expect(unstructured.SetNestedStringMap(instance.Object, map[string]string{
+		"serviceId": "service-id",
+		"planId":    "plan-id",
+	}, "spec")).NotTo(gomega.HaveOccurred())
+	g.Expect(c.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), instance)
+	g.Expect(deleteSubResource(c, instance.DeepCopy())).NotTo(gomega.HaveOccurred())
+	current = &unstructured.Unstructured{}
+	current.SetGroupVersionKind(instance.GroupVersionKind())
+	g.Expect(c.Get(context.TODO(), key(instance), current)).NotTo(gomega.HaveOccurred())
+	state, _, _ = unstructured.NestedString(current.Object, "status", "state")
+	g.Expect(state).To(gomega.Equal("delete"))
+
+	// Delete the resource with a propagation policy
+	SetDeleteStrategies([]config.DeleteStrategy{
+		{APIVersion: "v1", Strategy: "background"},
+	})
+	deleted := configMap("deleted-configmap")
+	g.Expect(c.Create(context.TODO(), deleted)).NotTo(gomega.HaveOccurred())
+	g.Expect(deleteSubResource(c, deleted)).NotTo(gomega.HaveOccurred())
+	g.Expect(apiErrors.IsNotFound(c.Get(context.TODO(), key(deleted), configMap("deleted-configmap")))).To(gomega.BeTrue())
+}
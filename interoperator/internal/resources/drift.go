@@ -0,0 +1,81 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ComputeDrift returns the expected resources which differ from the live
+// resources. A live resource differs if it is missing or if a field set in
+// the expected resource has a different value, the same comparison used to
+// decide whether resources are updated on reconcile. Fields not set in the
+// expected resources, like the ones defaulted by the api server, and the
+// ignored differences are not compared.
+func (r resourceManager) ComputeDrift(client kubernetes.Client, expectedResources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	drifted := make([]*unstructured.Unstructured, 0)
+	for _, expectedResource := range expectedResources {
+		kind := expectedResource.GetKind()
+		namespacedName := types.NamespacedName{
+			Name:      expectedResource.GetName(),
+			Namespace: expectedResource.GetNamespace(),
+		}
+
+		foundResource := &unstructured.Unstructured{}
+		foundResource.SetGroupVersionKind(expectedResource.GroupVersionKind())
+		err := client.Get(context.TODO(), namespacedName, foundResource)
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				log.Info("drift - resource missing", "kind", kind, "namespacedName", namespacedName)
+				drifted = append(drifted, expectedResource)
+				continue
+			}
+			log.Error(err, "drift - failed fetching resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
+		}
+
+		expectedObject, err := normalizeNumbers(expectedResource.Object)
+		if err != nil {
+			log.Error(err, "drift - failed to normalize resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
+		}
+		expected, err := ignoreDifferences(&unstructured.Unstructured{Object: expectedObject}, foundResource)
+		if err != nil {
+			log.Error(err, "drift - failed to ignore differences of resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
+		}
+		_, toBeUpdated, err := dynamic.DeepUpdate(foundResource.Object, expected.Object)
+		if err != nil {
+			log.Error(err, "drift - failed to compare resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
+		}
+		if toBeUpdated {
+			log.Info("drift - resource differs", "kind", kind, "namespacedName", namespacedName)
+			drifted = append(drifted, expectedResource)
+		}
+	}
+	return drifted, nil
+}
+
+// normalizeNumbers returns a copy of object in which the numbers parsed from
+// the rendered yaml as float64 are converted to int64 where possible, like
+// the numbers of resources read from the api server
+func normalizeNumbers(object map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	normalized := make(map[string]interface{})
+	err = utiljson.Unmarshal(data, &normalized)
+	if err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
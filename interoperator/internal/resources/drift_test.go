@@ -0,0 +1,112 @@
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_normalizeNumbers(t *testing.T) {
+	tests := []struct {
+		name   string
+		object map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name: "convert whole numbers to int64",
+			object: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": float64(3),
+					"ports": []interface{}{
+						map[string]interface{}{"port": float64(5432)},
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": int64(3),
+					"ports": []interface{}{
+						map[string]interface{}{"port": int64(5432)},
+					},
+				},
+			},
+		},
+		{
+			name: "keep fractions and strings",
+			object: map[string]interface{}{
+				"ratio": float64(0.5),
+				"size":  "512Mi",
+			},
+			want: map[string]interface{}{
+				"ratio": float64(0.5),
+				"size":  "512Mi",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeNumbers(tt.object)
+			if err != nil {
+				t.Errorf("normalizeNumbers() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeNumbers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resourceManager_ComputeDrift(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	expectedResources, err := dynamic.StringToUnstructured(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: drift-config
+  namespace: default
+data:
+  port: "5432"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: drift-missing-config
+  namespace: default
+data:
+  port: "5432"`)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	configMap := expectedResources[0].DeepCopy()
+	g.Expect(c.Create(context.TODO(), configMap)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), configMap)
+
+	r := resourceManager{}
+	drifted, err := r.ComputeDrift(c, expectedResources)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(drifted).To(gomega.Equal(expectedResources[1:]))
+
+	// Fields not rendered are ignored
+	configMapKey := types.NamespacedName{Name: "drift-config", Namespace: constants.InteroperatorNamespace}
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(configMap.GroupVersionKind())
+	g.Expect(c.Get(context.TODO(), configMapKey, current)).NotTo(gomega.HaveOccurred())
+	g.Expect(unstructured.SetNestedField(current.Object, "extra", "data", "added")).NotTo(gomega.HaveOccurred())
+	g.Expect(c.Update(context.TODO(), current)).NotTo(gomega.HaveOccurred())
+	drifted, err = r.ComputeDrift(c, expectedResources[:1])
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(drifted).To(gomega.BeEmpty())
+
+	// Rendered fields changed are reported
+	g.Expect(unstructured.SetNestedField(current.Object, "5433", "data", "port")).NotTo(gomega.HaveOccurred())
+	g.Expect(c.Update(context.TODO(), current)).NotTo(gomega.HaveOccurred())
+	drifted, err = r.ComputeDrift(c, expectedResources[:1])
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(drifted).To(gomega.Equal(expectedResources[:1]))
+}
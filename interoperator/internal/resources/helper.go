@@ -2,13 +2,18 @@ package resources
 
 import (
 	"context"
-	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/properties"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	renderCache "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/cache"
 	rendererFactory "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/factory"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/postrender"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/services"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
@@ -16,7 +21,8 @@ import (
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
 	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -87,51 +93,108 @@ func findUnstructuredObject(list []*unstructured.Unstructured, item *unstructure
 	return false
 }
 
-func deleteSubResource(client kubernetes.Client, resource *unstructured.Unstructured) error {
-	// Special delete handling for sf operators for delete
-	var specialDelete = [...]string{"deployment.servicefabrik.io/v1alpha1", "bind.servicefabrik.io/v1alpha1"}
-	apiVersion := resource.GetAPIVersion()
+func findSource(list []osbv1alpha1.Source, item osbv1alpha1.Source) bool {
+	for _, source := range list {
+		if source.Kind == item.Kind && source.APIVersion == item.APIVersion && source.Name == item.Name && source.Namespace == item.Namespace {
+			return true
+		}
+	}
+	return false
+}
 
-	for _, val := range specialDelete {
-		if apiVersion == val {
-			namespacedName := types.NamespacedName{
-				Name:      resource.GetName(),
-				Namespace: resource.GetNamespace(),
-			}
+// serverSideApply returns true if resource is applied with server-side
+// apply. The annotation is set on all resources of plans with
+// serverSideApply enabled and may be set by the templates on individual
+// resources.
+func serverSideApply(resource *unstructured.Unstructured) bool {
+	enabled, _ := strconv.ParseBool(resource.GetAnnotations()[constants.ServerSideApplyKey])
+	return enabled
+}
 
-			err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				err := client.Get(context.TODO(), namespacedName, resource)
-				if err != nil {
-					return err
-				}
-				content := resource.UnstructuredContent()
-				statusInt, ok := content["status"]
-				var status map[string]interface{}
-				if ok {
-					status, ok = statusInt.(map[string]interface{})
-					if !ok {
-						return fmt.Errorf("status field not map for resource %v", resource)
-					}
-				} else {
-					status = make(map[string]interface{})
-				}
-
-				status["state"] = "delete"
-				content["status"] = status
-				resource.SetUnstructuredContent(content)
-				err = client.Update(context.TODO(), resource)
-				if err != nil {
-					return err
-				}
-				return nil
-			})
-			if err != nil {
-				return err
-			}
-			return nil
+// setServerSideApply annotates resource to be applied with server-side
+// apply unless the template already decided for the resource
+func setServerSideApply(resource *unstructured.Unstructured) {
+	annotations := resource.GetAnnotations()
+	if _, ok := annotations[constants.ServerSideApplyKey]; ok {
+		return
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[constants.ServerSideApplyKey] = "true"
+	resource.SetAnnotations(annotations)
+}
+
+// applyResource applies resource with server-side apply as the interoperator
+// field manager. Fields applied before and missing in resource are removed.
+// Apply fails with an ApplyConflict if resource sets fields owned by other
+// field managers, unless force is set in which case the interoperator takes
+// over the ownership of the fields.
+func applyResource(client kubernetes.Client, resource *unstructured.Unstructured, force bool) (*unstructured.Unstructured, error) {
+	kind := resource.GetKind()
+	namespacedName := types.NamespacedName{
+		Name:      resource.GetName(),
+		Namespace: resource.GetNamespace(),
+	}
+
+	foundResource := &unstructured.Unstructured{}
+	foundResource.SetGroupVersionKind(resource.GroupVersionKind())
+	err := client.Get(context.TODO(), namespacedName, foundResource)
+	if err != nil && !apiErrors.IsNotFound(err) {
+		log.Error(err, "reconcile - failed fetching resource", "kind", kind, "namespacedName", namespacedName)
+		return nil, err
+	}
+	if err == nil {
+		err = adoptResource(client, resource, foundResource)
+		if err != nil {
+			log.Error(err, "reconcile - failed to adopt resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
+		}
+		err = upgradeManagedFields(client, foundResource)
+		if err != nil {
+			log.Error(err, "reconcile - failed to migrate managed fields of resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
+		}
+		// Fields left to other controllers are applied with their current
+		// values
+		resource, err = ignoreDifferences(resource, foundResource)
+		if err != nil {
+			log.Error(err, "reconcile - failed to ignore differences of resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
 		}
 	}
-	return client.Delete(context.TODO(), resource)
+
+	appliedResource := resource.DeepCopy()
+	appliedResource.SetResourceVersion("")
+	appliedResource.SetManagedFields(nil)
+	options := []kubernetes.PatchOption{kubernetes.FieldOwner(constants.FieldManagerName)}
+	if force {
+		options = append(options, kubernetes.ForceOwnership)
+	}
+	log.Info("reconcile - applying resource", "kind", kind, "namespacedName", namespacedName, "force", force)
+	err = client.Patch(context.TODO(), appliedResource, kubernetes.Apply, options...)
+	if err != nil {
+		if apiErrors.IsConflict(err) {
+			err = errors.NewApplyConflict(kind, namespacedName.String(), err)
+		}
+		log.Error(err, "reconcile - failed to apply resource", "kind", kind, "namespacedName", namespacedName)
+		return nil, err
+	}
+	return appliedResource, nil
+}
+
+// upgradeManagedFields hands the fields set by create and update requests of
+// the interoperator over to its server-side apply field manager, so that
+// they are removed once they are missing in the applied resource. Requests
+// sent before the field manager was set were recorded with the name of the
+// executable.
+func upgradeManagedFields(client kubernetes.Client, resource *unstructured.Unstructured) error {
+	csaManagers := sets.New(constants.FieldManagerName, filepath.Base(os.Args[0]))
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(resource, csaManagers, constants.FieldManagerName)
+	if err != nil || patch == nil {
+		return err
+	}
+	return client.Patch(context.TODO(), resource, kubernetes.RawPatch(types.JSONPatchType, patch))
 }
 
 func computeInputObjects(client kubernetes.Client, instance *osbv1alpha1.SFServiceInstance,
@@ -165,6 +228,42 @@ func computeInputObjects(client kubernetes.Client, instance *osbv1alpha1.SFServi
 		Name:      instance.GetName(),
 	}
 
+	sourceObjects, err := templateObjects(instance, binding, service, plan)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := renderSources(client, plan, name, sourceObjects)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, val := range sources {
+		if val.Name != "" {
+			obj := &unstructured.Unstructured{}
+			obj.SetKind(val.Kind)
+			obj.SetAPIVersion(val.APIVersion)
+			namespacedName := types.NamespacedName{
+				Name:      val.Name,
+				Namespace: name.Namespace,
+			}
+			err := client.Get(context.TODO(), namespacedName, obj)
+			if err != nil {
+				// Not failing here as the resource might not exist
+				log.V(2).Info("failed to fetch resource listed in sources", "resource", val, "err", err)
+				continue
+			}
+			sourceObjects[key] = obj.Object
+		}
+	}
+
+	return sourceObjects, nil
+}
+
+// templateObjects returns the objects passed to all the templates of the
+// plan
+func templateObjects(instance *osbv1alpha1.SFServiceInstance, binding *osbv1alpha1.SFServiceBinding,
+	service *osbv1alpha1.SFService, plan *osbv1alpha1.SFPlan) (map[string]interface{}, error) {
 	sourceObjects := make(map[string]interface{})
 	if service != nil {
 		serviceObj, err := dynamic.ObjectToMapInterface(service)
@@ -197,26 +296,20 @@ func computeInputObjects(client kubernetes.Client, instance *osbv1alpha1.SFServi
 		}
 		sourceObjects["binding"] = bindingObj
 	}
+	return sourceObjects, nil
+}
 
+// renderSources renders the sources template of the plan with the objects
+// of the instance and returns the objects listed in it
+func renderSources(client kubernetes.Client, plan *osbv1alpha1.SFPlan, name types.NamespacedName,
+	sourceObjects map[string]interface{}) (map[string]osbv1alpha1.Source, error) {
 	template, err := plan.GetTemplate(osbv1alpha1.SourcesAction)
 	if err != nil {
 		log.Error(err, "plan does not have sources template")
 		return nil, err
 	}
 
-	renderer, err := rendererFactory.GetRenderer(template.Type, nil)
-	if err != nil {
-		log.Error(err, "failed to get sources renderer", "type", template.Type)
-		return nil, err
-	}
-
-	input, err := rendererFactory.GetRendererInputFromSources(template, name, sourceObjects)
-	if err != nil {
-		log.Error(err, "failed creating renderer input for sources", "type", template.Type)
-		return nil, err
-	}
-
-	output, err := renderer.Render(input)
+	output, err := render(client, template, name, sourceObjects)
 	if err != nil {
 		if errors.RendererError(err) {
 			rendererError := err.(*errors.InteroperatorError)
@@ -257,27 +350,8 @@ func computeInputObjects(client kubernetes.Client, instance *osbv1alpha1.SFServi
 		log.Error(err, "failed parsing file content of sources", "file", sourcesFileName)
 		return nil, err
 	}
+	return sources, nil
 
-	for key, val := range sources {
-		if val.Name != "" {
-			obj := &unstructured.Unstructured{}
-			obj.SetKind(val.Kind)
-			obj.SetAPIVersion(val.APIVersion)
-			namespacedName := types.NamespacedName{
-				Name:      val.Name,
-				Namespace: name.Namespace,
-			}
-			err := client.Get(context.TODO(), namespacedName, obj)
-			if err != nil {
-				// Not failing here as the resource might not exist
-				log.V(2).Info("failed to fetch resource listed in sources", "resource", val, "err", err)
-				continue
-			}
-			sourceObjects[key] = obj.Object
-		}
-	}
-
-	return sourceObjects, nil
 }
 
 func renderTemplate(client kubernetes.Client, instance *osbv1alpha1.SFServiceInstance,
@@ -314,7 +388,7 @@ func renderTemplate(client kubernetes.Client, instance *osbv1alpha1.SFServiceIns
 	}
 
 	switch action {
-	case osbv1alpha1.BindAction:
+	case osbv1alpha1.BindAction, osbv1alpha1.PostBindAction:
 		name.Name = binding.GetName()
 	}
 
@@ -330,28 +404,67 @@ func renderTemplate(client kubernetes.Client, instance *osbv1alpha1.SFServiceIns
 		return nil, err
 	}
 
-	renderer, err := rendererFactory.GetRenderer(template.Type, nil)
+	output, err := render(client, template, name, sourceObjects)
 	if err != nil {
-		log.Error(err, "failed to get renderer", "type", template.Type)
+		if errors.RendererError(err) {
+			rendererError := err.(*errors.InteroperatorError)
+			log.Error(rendererError.Err, "failed rendering")
+			return nil, err
+		}
+		log.Error(err, "failed rendering")
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// renderKey returns the render cache key of template, which includes the
+// content of the template libraries it uses
+func renderKey(client kubernetes.Client, template *osbv1alpha1.TemplateSpec, name types.NamespacedName,
+	values map[string]interface{}) (string, error) {
+	libraries, err := gotemplate.LibraryContents(client, template.Libraries)
+	if err != nil {
+		return "", err
+	}
+	return renderCache.Key(template, name, values, libraries)
+}
+
+// render renders template with values and applies the post render patches
+// of the template. The output is served from the render cache if the
+// template was rendered with the same values before.
+func render(client kubernetes.Client, template *osbv1alpha1.TemplateSpec, name types.NamespacedName,
+	values map[string]interface{}) (renderer.Output, error) {
+	key, err := renderKey(client, template, name, values)
+	if err != nil {
+		// Not failing here. The template is rendered without the cache
+		log.Error(err, "failed computing render cache key", "type", template.Type, "action", template.Action)
+	} else if output, ok := renderCache.Get(key); ok {
+		return output, nil
+	}
+
+	r, err := rendererFactory.GetRenderer(template.Type, client)
+	if err != nil {
+		log.Error(err, "failed to get renderer", "type", template.Type, "action", template.Action)
 		return nil, err
 	}
 
-	input, err := rendererFactory.GetRendererInputFromSources(template, name, sourceObjects)
+	input, err := rendererFactory.GetRendererInputFromSources(template, name, values)
 	if err != nil {
-		log.Error(err, "failed creating renderer input", "type", template.Type)
+		log.Error(err, "failed creating renderer input", "type", template.Type, "action", template.Action)
 		return nil, err
 	}
 
-	output, err := renderer.Render(input)
+	output, err := r.Render(input)
 	if err != nil {
-		if errors.RendererError(err) {
-			rendererError := err.(*errors.InteroperatorError)
-			log.Error(rendererError.Err, "failed rendering")
-			return nil, err
-		}
-		log.Error(err, "failed rendering")
 		return nil, err
 	}
 
+	output, err = postrender.Apply(client, template, name, values, output)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		renderCache.Add(key, output)
+	}
 	return output, nil
 }
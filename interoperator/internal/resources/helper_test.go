@@ -9,6 +9,7 @@ import (
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 	"github.com/onsi/gomega"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -313,6 +314,111 @@ func Test_deleteSubResource(t *testing.T) {
 	}
 }
 
+func Test_applyResource(t *testing.T) {
+	configMap := func(data map[string]interface{}) *unstructured.Unstructured {
+		resource := &unstructured.Unstructured{}
+		resource.SetAPIVersion("v1")
+		resource.SetKind("ConfigMap")
+		resource.SetNamespace(constants.InteroperatorNamespace)
+		resource.SetName("applied-configmap")
+		resource.Object["data"] = data
+		return resource
+	}
+	// Created before server-side apply was enabled
+	created := configMap(map[string]interface{}{"a": "1", "b": "2"})
+	if err := c.Create(context.TODO(), created, kubernetes.FieldOwner(constants.FieldManagerName)); err != nil {
+		t.Fatalf("Failed to create configmap %v", err)
+	}
+	defer c.Delete(context.TODO(), created)
+
+	tests := []struct {
+		name     string
+		resource *unstructured.Unstructured
+		force    bool
+		setup    func()
+		want     map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "remove fields missing in applied resource",
+			resource: configMap(map[string]interface{}{"a": "1"}),
+			want:     map[string]interface{}{"a": "1"},
+		},
+		{
+			name:     "keep fields owned by other field managers",
+			resource: configMap(map[string]interface{}{"a": "2"}),
+			setup: func() {
+				other := configMap(map[string]interface{}{"c": "3"})
+				err := c.Patch(context.TODO(), other, kubernetes.Apply, kubernetes.FieldOwner("other"))
+				if err != nil {
+					t.Errorf("Failed to apply configmap %v", err)
+				}
+			},
+			want: map[string]interface{}{"a": "2", "c": "3"},
+		},
+		{
+			name:     "fail with conflict on fields owned by other field managers",
+			resource: configMap(map[string]interface{}{"a": "2", "c": "4"}),
+			wantErr:  true,
+		},
+		{
+			name:     "take over fields owned by other field managers if forced",
+			resource: configMap(map[string]interface{}{"a": "2", "c": "4"}),
+			force:    true,
+			want:     map[string]interface{}{"a": "2", "c": "4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup()
+			}
+			got, err := applyResource(c, tt.resource, tt.force)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("applyResource() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.ApplyConflict(err) {
+					t.Errorf("applyResource() error = %v, want ApplyConflict", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Object["data"], tt.want) {
+				t.Errorf("applyResource() data = %v, want %v", got.Object["data"], tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverSideApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{
+			name: "enable server-side apply if not set",
+			want: true,
+		},
+		{
+			name:        "keep server-side apply disabled by the template",
+			annotations: map[string]string{constants.ServerSideApplyKey: "false"},
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &unstructured.Unstructured{}
+			resource.SetAnnotations(tt.annotations)
+			setServerSideApply(resource)
+			if got := serverSideApply(resource); got != tt.want {
+				t.Errorf("serverSideApply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_computeInputObjects(t *testing.T) {
 	configResource := &unstructured.Unstructured{}
 	configResource.SetAPIVersion("v1")
@@ -641,6 +747,67 @@ func Test_renderTemplate(t *testing.T) {
 	}
 }
 
+func Test_render(t *testing.T) {
+	template := &osbv1alpha1.TemplateSpec{
+		Action: "provision",
+		Type:   "gotemplate",
+		Content: `{{- $state := "in_queue" }}
+{{- with .instance.status.state }}
+  {{- if eq . "update" }}
+    {{- $state = . }}
+  {{- end }}
+{{- end }}
+{{- $state }}`,
+	}
+	name := types.NamespacedName{Name: "instance-id", Namespace: "default"}
+	values := func(state string) map[string]interface{} {
+		return map[string]interface{}{
+			"instance": map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "instance-id", "resourceVersion": state},
+				"status":   map[string]interface{}{"state": state},
+			},
+		}
+	}
+	tests := []struct {
+		name  string
+		state string
+		want  string
+	}{
+		{
+			name:  "render template for instance in update",
+			state: "update",
+			want:  "update",
+		},
+		{
+			name:  "render template again for other instance state",
+			state: "succeeded",
+			want:  "in_queue",
+		},
+		{
+			name:  "serve cached output for same instance state",
+			state: "update",
+			want:  "update",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := render(c, template, name, values(tt.state))
+			if err != nil {
+				t.Errorf("render() error = %v", err)
+				return
+			}
+			content, err := got.FileContent("main")
+			if err != nil {
+				t.Errorf("FileContent() error = %v", err)
+				return
+			}
+			if content != tt.want {
+				t.Errorf("render() = %v, want %v", content, tt.want)
+			}
+		})
+	}
+}
+
 func _getDummyInstance() *osbv1alpha1.SFServiceInstance {
 	return &osbv1alpha1.SFServiceInstance{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,127 @@
+package resources
+
+import (
+	"context"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RunHook runs the Jobs rendered by a hook template. The other resources
+// rendered with them, like the ConfigMaps holding their scripts, are
+// reconciled first. The Jobs are annotated with run, Jobs of an earlier run
+// are replaced. It returns a HookPending error until all the Jobs completed
+// and a HookFailed error if one of them failed.
+func (r resourceManager) RunHook(client kubernetes.Client, hookResources []*unstructured.Unstructured, run string) error {
+	jobs := make([]*unstructured.Unstructured, 0, len(hookResources))
+	for _, resource := range hookResources {
+		if resource.GroupVersionKind().GroupKind().String() == "Job.batch" {
+			jobs = append(jobs, resource)
+			continue
+		}
+		if _, err := reconcileResource(client, resource, false); err != nil {
+			return err
+		}
+	}
+
+	// The Jobs of a hook run in parallel
+	var pending error
+	for _, job := range jobs {
+		err := runHookJob(client, job, run)
+		if errors.HookPending(err) {
+			if pending == nil {
+				pending = err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return pending
+}
+
+// runHookJob creates job for run unless it exists and returns its result
+func runHookJob(client kubernetes.Client, job *unstructured.Unstructured, run string) error {
+	namespacedName := types.NamespacedName{
+		Name:      job.GetName(),
+		Namespace: job.GetNamespace(),
+	}
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(job.GroupVersionKind())
+	err := client.Get(context.TODO(), namespacedName, current)
+	if err != nil {
+		if !apiErrors.IsNotFound(err) {
+			log.Error(err, "hook - failed fetching job", "namespacedName", namespacedName)
+			return err
+		}
+		annotations := job.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[constants.HookRunKey] = run
+		job.SetAnnotations(annotations)
+		log.Info("hook - creating job", "namespacedName", namespacedName, "run", run)
+		err = client.Create(context.TODO(), job, kubernetes.FieldOwner(constants.FieldManagerName))
+		if err != nil {
+			log.Error(err, "hook - failed to create job", "namespacedName", namespacedName)
+			return err
+		}
+		return errors.NewHookPending(namespacedName.String(), nil)
+	}
+
+	if current.GetAnnotations()[constants.HookRunKey] != run {
+		// Jobs can not be updated, the job of the earlier run is deleted and
+		// created again once it is gone
+		if current.GetDeletionTimestamp().IsZero() {
+			log.Info("hook - deleting job of earlier run", "namespacedName", namespacedName,
+				"run", current.GetAnnotations()[constants.HookRunKey])
+			err = client.Delete(context.TODO(), current, kubernetes.PropagationPolicy(metav1.DeletePropagationBackground))
+			if err != nil && !apiErrors.IsNotFound(err) {
+				log.Error(err, "hook - failed to delete job", "namespacedName", namespacedName)
+				return err
+			}
+		}
+		return errors.NewHookPending(namespacedName.String(), nil)
+	}
+
+	status, _ := current.Object["status"].(map[string]interface{})
+	if failed, _ := conditionStatus(status, "Failed"); failed == "True" {
+		// The failed job is kept for inspection. It is marked as of an
+		// earlier run, so that a retry of the operation runs it again.
+		err = updateWithRetry(client, current, func() error {
+			annotations := current.GetAnnotations()
+			annotations[constants.HookRunKey] = run + "-failed"
+			current.SetAnnotations(annotations)
+			return nil
+		})
+		if err != nil && !apiErrors.IsNotFound(err) {
+			log.Error(err, "hook - failed to mark failed job", "namespacedName", namespacedName)
+			return err
+		}
+		return errors.NewHookFailed(namespacedName.String(), conditionMessage(status, "Failed"), nil)
+	}
+	if complete, _ := conditionStatus(status, "Complete"); complete == "True" {
+		return nil
+	}
+	return errors.NewHookPending(namespacedName.String(), nil)
+}
+
+// conditionMessage returns the message of the condition of conditionType
+func conditionMessage(status map[string]interface{}, conditionType string) string {
+	conditions, _ := status["conditions"].([]interface{})
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == conditionType {
+			message, _ := condition["message"].(string)
+			return message
+		}
+	}
+	return ""
+}
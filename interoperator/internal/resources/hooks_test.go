@@ -0,0 +1,122 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_conditionMessage(t *testing.T) {
+	status := map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{
+				"type":   "Complete",
+				"status": "False",
+			},
+			map[string]interface{}{
+				"type":    "Failed",
+				"status":  "True",
+				"message": "Job has reached the specified backoff limit",
+			},
+		},
+	}
+	tests := []struct {
+		name          string
+		status        map[string]interface{}
+		conditionType string
+		want          string
+	}{
+		{
+			name:          "return message of condition",
+			status:        status,
+			conditionType: "Failed",
+			want:          "Job has reached the specified backoff limit",
+		},
+		{
+			name:          "return empty message if condition has none",
+			status:        status,
+			conditionType: "Complete",
+			want:          "",
+		},
+		{
+			name:          "return empty message if condition is missing",
+			status:        status,
+			conditionType: "Suspended",
+			want:          "",
+		},
+		{
+			name:          "return empty message if status is missing",
+			status:        nil,
+			conditionType: "Failed",
+			want:          "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := conditionMessage(tt.status, tt.conditionType); got != tt.want {
+				t.Errorf("conditionMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resourceManager_RunHook(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	hookResources, err := dynamic.StringToUnstructured(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: hook-script
+  namespace: default
+data:
+  migrate.sh: echo migrated
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: hook-migrate
+  namespace: default
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: busybox
+        command: ["sh", "/scripts/migrate.sh"]`)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	r := resourceManager{}
+	err = r.RunHook(c, hookResources, "preProvision-1")
+	g.Expect(errors.HookPending(err)).To(gomega.BeTrue())
+
+	configMap := &unstructured.Unstructured{}
+	configMap.SetGroupVersionKind(hookResources[0].GroupVersionKind())
+	configMapKey := types.NamespacedName{Name: "hook-script", Namespace: constants.InteroperatorNamespace}
+	g.Expect(c.Get(context.TODO(), configMapKey, configMap)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), configMap)
+
+	job := &unstructured.Unstructured{}
+	job.SetGroupVersionKind(hookResources[1].GroupVersionKind())
+	jobKey := types.NamespacedName{Name: "hook-migrate", Namespace: constants.InteroperatorNamespace}
+	g.Expect(c.Get(context.TODO(), jobKey, job)).NotTo(gomega.HaveOccurred())
+	g.Expect(job.GetAnnotations()).To(gomega.HaveKeyWithValue(constants.HookRunKey, "preProvision-1"))
+
+	// Job is not complete yet
+	err = r.RunHook(c, hookResources, "preProvision-1")
+	g.Expect(errors.HookPending(err)).To(gomega.BeTrue())
+
+	// Job of earlier run is replaced
+	err = r.RunHook(c, hookResources, "preUpdate-2")
+	g.Expect(errors.HookPending(err)).To(gomega.BeTrue())
+	g.Eventually(func() bool {
+		err := c.Get(context.TODO(), jobKey, job)
+		return err != nil || !job.GetDeletionTimestamp().IsZero()
+	}, timeout).Should(gomega.BeTrue())
+}
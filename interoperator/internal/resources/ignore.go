@@ -0,0 +1,399 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Kinds of steps of a JSONPath
+const (
+	stepKey = iota
+	stepIndex
+	stepWildcard
+	stepFilter
+)
+
+// pathStep is a step of a JSONPath. Filters select the list elements whose
+// field at filterPath equals filterValue.
+type pathStep struct {
+	kind        int
+	key         string
+	index       int
+	filterPath  []string
+	filterValue string
+}
+
+// ignoreDifferencesOf returns the JSON pointers and JSONPaths of the fields
+// of resource which are not updated. They are listed as a json array in the
+// ignore differences annotation.
+func ignoreDifferencesOf(resource *unstructured.Unstructured) ([]string, error) {
+	value, ok := resource.GetAnnotations()[constants.IgnoreDifferencesKey]
+	if !ok {
+		return nil, nil
+	}
+	expressions := []string{}
+	err := json.Unmarshal([]byte(value), &expressions)
+	if err == nil {
+		for _, expression := range expressions {
+			if _, err = parseIgnoreExpression(expression); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, errors.NewValidationError(fmt.Sprintf("%s %s: invalid value %q of annotation %s",
+			resource.GetKind(), resource.GetName(), value, constants.IgnoreDifferencesKey), err)
+	}
+	return expressions, nil
+}
+
+// setIgnoreDifferences adds the fields ignored by the rules matching
+// resource to its ignore differences annotation
+func setIgnoreDifferences(resource *unstructured.Unstructured, rules []osbv1alpha1.IgnoreDifference) error {
+	expressions, err := ignoreDifferencesOf(resource)
+	if err != nil {
+		return err
+	}
+	found := len(expressions)
+	for _, rule := range rules {
+		if (rule.APIVersion != "" && rule.APIVersion != resource.GetAPIVersion()) ||
+			(rule.Kind != "" && rule.Kind != resource.GetKind()) ||
+			(rule.Name != "" && rule.Name != resource.GetName()) {
+			continue
+		}
+		for _, list := range [][]string{rule.JSONPointers, rule.JSONPaths} {
+			for _, expression := range list {
+				if !utils.ContainsString(expressions, expression) {
+					expressions = append(expressions, expression)
+				}
+			}
+		}
+	}
+	if len(expressions) == found {
+		return nil
+	}
+	value, err := json.Marshal(expressions)
+	if err != nil {
+		return err
+	}
+	annotations := resource.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[constants.IgnoreDifferencesKey] = string(value)
+	resource.SetAnnotations(annotations)
+	return nil
+}
+
+// ignoreDifferences returns a copy of expected in which the ignored fields
+// are set to their values in found, so that they are neither compared nor
+// updated. The expressions are evaluated against both resources: ignored
+// fields of expected are removed, then the ignored fields of found are
+// added at their position in found. List elements selected by filters, like
+// containers injected by other controllers, thus keep their position even if
+// expected has fewer elements. If no fields are ignored, expected is
+// returned.
+func ignoreDifferences(expected, found *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	expressions, err := ignoreDifferencesOf(expected)
+	if err != nil || len(expressions) == 0 {
+		return expected, err
+	}
+
+	result := expected.DeepCopy()
+	removed := make([][]string, 0, len(expressions))
+	added := make([][]string, 0, len(expressions))
+	for _, expression := range expressions {
+		steps, err := parseIgnoreExpression(expression)
+		if err != nil {
+			return nil, err
+		}
+		evaluatePath(steps, result.Object, []string{}, &removed)
+		evaluatePath(steps, found.Object, []string{}, &added)
+	}
+
+	// Later list elements are removed first to keep the indices valid
+	sort.Slice(removed, func(i, j int) bool {
+		return comparePaths(removed[i], removed[j]) > 0
+	})
+	for _, path := range removed {
+		replacePath(result.Object, path, nil, true)
+	}
+	// Earlier list elements are added first, so that the later ones end up
+	// at their index in found
+	sort.Slice(added, func(i, j int) bool {
+		return comparePaths(added[i], added[j]) < 0
+	})
+	for _, path := range added {
+		value, _ := getPath(found.Object, path)
+		insertPath(result.Object, path, runtime.DeepCopyJSONValue(value))
+	}
+	return result, nil
+}
+
+// parseIgnoreExpression parses a JSON pointer, e.g. /spec/replicas, or a
+// JSONPath, e.g. $.spec.containers[?(@.name=='app')].env, into steps.
+// JSONPaths support child names, indices, wildcards and equality filters.
+func parseIgnoreExpression(expression string) ([]pathStep, error) {
+	if strings.HasPrefix(expression, "/") {
+		steps := []pathStep{}
+		for _, token := range strings.Split(expression[1:], "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			steps = append(steps, pathStep{kind: stepKey, key: token})
+		}
+		return steps, nil
+	}
+	if !strings.HasPrefix(expression, "$") {
+		return nil, fmt.Errorf("%q is neither a JSON pointer nor a JSONPath", expression)
+	}
+
+	steps := []pathStep{}
+	rest := expression[1:]
+	for rest != "" {
+		var step pathStep
+		var err error
+		switch rest[0] {
+		case '.':
+			step, rest, err = parseChild(rest[1:])
+		case '[':
+			step, rest, err = parseBracket(rest[1:])
+		default:
+			err = fmt.Errorf("unexpected %q", rest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSONPath %q: %v", expression, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// parseChild parses the step following a dot
+func parseChild(rest string) (pathStep, string, error) {
+	if strings.HasPrefix(rest, "*") {
+		return pathStep{kind: stepWildcard}, rest[1:], nil
+	}
+	end := strings.IndexAny(rest, ".[")
+	if end < 0 {
+		end = len(rest)
+	}
+	if end == 0 {
+		return pathStep{}, "", fmt.Errorf("missing name at %q", rest)
+	}
+	return pathStep{kind: stepKey, key: rest[:end]}, rest[end:], nil
+}
+
+// parseBracket parses the step following an opening bracket
+func parseBracket(rest string) (pathStep, string, error) {
+	end := strings.Index(rest, "]")
+	if strings.HasPrefix(rest, "?(") {
+		end = strings.Index(rest, ")]") + 1
+	}
+	if end <= 0 {
+		return pathStep{}, "", fmt.Errorf("missing closing bracket at %q", rest)
+	}
+	content, rest := rest[:end], rest[end+1:]
+
+	switch {
+	case content == "*":
+		return pathStep{kind: stepWildcard}, rest, nil
+	case isQuoted(content):
+		return pathStep{kind: stepKey, key: content[1 : len(content)-1]}, rest, nil
+	case strings.HasPrefix(content, "?(@.") && strings.HasSuffix(content, ")"):
+		condition := content[len("?(@.") : len(content)-1]
+		parts := strings.SplitN(condition, "==", 2)
+		if len(parts) != 2 {
+			return pathStep{}, "", fmt.Errorf("unsupported filter %q", content)
+		}
+		field, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if isQuoted(value) {
+			value = value[1 : len(value)-1]
+		}
+		return pathStep{kind: stepFilter, filterPath: strings.Split(field, "."), filterValue: value}, rest, nil
+	}
+	index, err := strconv.Atoi(content)
+	if err != nil || index < 0 {
+		return pathStep{}, "", fmt.Errorf("unsupported subscript %q", content)
+	}
+	return pathStep{kind: stepIndex, index: index}, rest, nil
+}
+
+// isQuoted returns true if value is enclosed in single or double quotes
+func isQuoted(value string) bool {
+	return len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0]
+}
+
+// evaluatePath appends the paths of the fields of node selected by steps
+// to paths
+func evaluatePath(steps []pathStep, node interface{}, path []string, paths *[][]string) {
+	if len(steps) == 0 {
+		*paths = append(*paths, append([]string{}, path...))
+		return
+	}
+	step, next := steps[0], steps[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		switch step.kind {
+		case stepKey:
+			if child, ok := n[step.key]; ok {
+				evaluatePath(next, child, append(path, step.key), paths)
+			}
+		case stepWildcard:
+			keys := make([]string, 0, len(n))
+			for key := range n {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				evaluatePath(next, n[key], append(path, key), paths)
+			}
+		}
+	case []interface{}:
+		for i, child := range n {
+			selected := false
+			switch step.kind {
+			case stepKey:
+				// Tokens of JSON pointers select list elements by index
+				selected = step.key == strconv.Itoa(i)
+			case stepIndex:
+				selected = i == step.index
+			case stepWildcard:
+				selected = true
+			case stepFilter:
+				value, ok := getPath(child, step.filterPath)
+				selected = ok && fmt.Sprintf("%v", value) == step.filterValue
+			}
+			if selected {
+				evaluatePath(next, child, append(path, strconv.Itoa(i)), paths)
+			}
+		}
+	}
+}
+
+// getPath returns the value of the field of node at path
+func getPath(node interface{}, path []string) (interface{}, bool) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, false
+			}
+			node = child
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// replacePath sets the field of node at path to value or removes it and
+// returns the updated node
+func replacePath(node interface{}, path []string, value interface{}, remove bool) interface{} {
+	if len(path) == 0 {
+		return node
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return node
+		}
+		switch {
+		case len(rest) > 0:
+			n[token] = replacePath(child, rest, value, remove)
+		case remove:
+			delete(n, token)
+		default:
+			n[token] = value
+		}
+	case []interface{}:
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(n) {
+			return node
+		}
+		switch {
+		case len(rest) > 0:
+			n[i] = replacePath(n[i], rest, value, remove)
+		case remove:
+			return append(n[:i:i], n[i+1:]...)
+		default:
+			n[i] = value
+		}
+	}
+	return node
+}
+
+// insertPath adds value to node at path and returns the updated node.
+// Missing maps on the way are created. Values at list indices are inserted
+// before the element at the index, or appended if the list is shorter.
+func insertPath(node interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return node
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			n[token] = value
+			return node
+		}
+		child, ok := n[token]
+		if !ok {
+			child = map[string]interface{}{}
+		}
+		n[token] = insertPath(child, rest, value)
+	case []interface{}:
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 {
+			return node
+		}
+		if len(rest) > 0 {
+			if i < len(n) {
+				n[i] = insertPath(n[i], rest, value)
+			}
+			return node
+		}
+		if i >= len(n) {
+			return append(n, value)
+		}
+		n = append(n[:i+1], n[i:]...)
+		n[i] = value
+		return n
+	}
+	return node
+}
+
+// comparePaths orders paths by their tokens, comparing list indices
+// numerically
+func comparePaths(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		x, errX := strconv.Atoi(a[i])
+		y, errY := strconv.Atoi(b[i])
+		if errX == nil && errY == nil {
+			return x - y
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return len(a) - len(b)
+}
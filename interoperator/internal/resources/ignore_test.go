@@ -0,0 +1,342 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_parseIgnoreExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       []pathStep
+		wantErr    bool
+	}{
+		{
+			name:       "parse json pointer",
+			expression: "/metadata/annotations/example.com~1scaled",
+			want: []pathStep{
+				{kind: stepKey, key: "metadata"},
+				{kind: stepKey, key: "annotations"},
+				{kind: stepKey, key: "example.com/scaled"},
+			},
+		},
+		{
+			name:       "parse jsonpath",
+			expression: "$.spec.containers[0]['env'][*].*",
+			want: []pathStep{
+				{kind: stepKey, key: "spec"},
+				{kind: stepKey, key: "containers"},
+				{kind: stepIndex, index: 0},
+				{kind: stepKey, key: "env"},
+				{kind: stepWildcard},
+				{kind: stepWildcard},
+			},
+		},
+		{
+			name:       "parse jsonpath filter",
+			expression: "$.spec.containers[?(@.name=='istio-proxy')].image",
+			want: []pathStep{
+				{kind: stepKey, key: "spec"},
+				{kind: stepKey, key: "containers"},
+				{kind: stepFilter, filterPath: []string{"name"}, filterValue: "istio-proxy"},
+				{kind: stepKey, key: "image"},
+			},
+		},
+		{
+			name:       "fail on relative path",
+			expression: "spec.replicas",
+			wantErr:    true,
+		},
+		{
+			name:       "fail on unsupported filter",
+			expression: "$.spec.containers[?(@.ports.length > 1)]",
+			wantErr:    true,
+		},
+		{
+			name:       "fail on missing bracket",
+			expression: "$.spec.containers[0",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIgnoreExpression(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseIgnoreExpression() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIgnoreExpression() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_setIgnoreDifferences(t *testing.T) {
+	rules := []osbv1alpha1.IgnoreDifference{
+		{
+			APIVersion:   "apps/v1",
+			Kind:         "Deployment",
+			JSONPointers: []string{"/spec/replicas"},
+		},
+		{
+			Kind:      "Deployment",
+			Name:      "postgres",
+			JSONPaths: []string{"$.spec.template.metadata.annotations"},
+		},
+		{
+			Kind:         "StatefulSet",
+			JSONPointers: []string{"/spec/replicas"},
+		},
+	}
+	resource := func(name, annotation string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("apps/v1")
+		obj.SetKind("Deployment")
+		obj.SetName(name)
+		if annotation != "" {
+			obj.SetAnnotations(map[string]string{constants.IgnoreDifferencesKey: annotation})
+		}
+		return obj
+	}
+	tests := []struct {
+		name     string
+		resource *unstructured.Unstructured
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "annotate resource with matching rules",
+			resource: resource("postgres", ""),
+			want:     `["/spec/replicas","$.spec.template.metadata.annotations"]`,
+		},
+		{
+			name:     "skip rules of other names",
+			resource: resource("pgbouncer", ""),
+			want:     `["/spec/replicas"]`,
+		},
+		{
+			name:     "keep fields ignored by the template",
+			resource: resource("pgbouncer", `["/spec/template/spec/containers/1","/spec/replicas"]`),
+			want:     `["/spec/template/spec/containers/1","/spec/replicas"]`,
+		},
+		{
+			name:     "fail on invalid annotation",
+			resource: resource("pgbouncer", `/spec/replicas`),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setIgnoreDifferences(tt.resource, rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("setIgnoreDifferences() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.ValidationError(err) {
+					t.Errorf("setIgnoreDifferences() error = %v, want ValidationError", err)
+				}
+				return
+			}
+			if got := tt.resource.GetAnnotations()[constants.IgnoreDifferencesKey]; got != tt.want {
+				t.Errorf("setIgnoreDifferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ignoreDifferences(t *testing.T) {
+	parse := func(content string) *unstructured.Unstructured {
+		resources, err := dynamic.StringToUnstructured(content)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", content, err)
+		}
+		return resources[0]
+	}
+	found := parse(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: postgres
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:16
+        env:
+        - name: INJECTED
+          value: "true"
+      - name: istio-proxy
+        image: istio/proxyv2`)
+	tests := []struct {
+		name     string
+		expected string
+		want     string
+	}{
+		{
+			name: "keep ignored fields of found resource",
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: postgres
+  annotations:
+    interoperator.servicefabrik.io/ignore-differences: '["/spec/replicas", "$.spec.template.spec.containers[?(@.name==''postgres'')].env"]'
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:17
+        env: []`,
+			want: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: postgres
+  annotations:
+    interoperator.servicefabrik.io/ignore-differences: '["/spec/replicas", "$.spec.template.spec.containers[?(@.name==''postgres'')].env"]'
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:17
+        env:
+        - name: INJECTED
+          value: "true"`,
+		},
+		{
+			name: "remove ignored fields missing in found resource",
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: postgres
+  annotations:
+    interoperator.servicefabrik.io/ignore-differences: '["$.spec.template.metadata", "/spec/template/spec/containers/1"]'
+spec:
+  template:
+    metadata:
+      labels:
+        app: postgres
+    spec:
+      containers:
+      - name: postgres
+      - name: exporter
+      - name: pgbouncer`,
+			want: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: postgres
+  annotations:
+    interoperator.servicefabrik.io/ignore-differences: '["$.spec.template.metadata", "/spec/template/spec/containers/1"]'
+spec:
+  template:
+    spec:
+      containers:
+      - name: postgres
+      - name: istio-proxy
+        image: istio/proxyv2
+      - name: pgbouncer`,
+		},
+		{
+			name: "return resource without ignored fields",
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: postgres
+spec:
+  replicas: 1`,
+			want: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: postgres
+spec:
+  replicas: 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := parse(tt.expected)
+			got, err := ignoreDifferences(expected, found)
+			if err != nil {
+				t.Errorf("ignoreDifferences() error = %v", err)
+				return
+			}
+			want, _ := normalizeNumbers(parse(tt.want).Object)
+			gotObject, _ := normalizeNumbers(got.Object)
+			if !reflect.DeepEqual(gotObject, want) {
+				t.Errorf("ignoreDifferences() = %v, want %v", gotObject, want)
+			}
+			if !reflect.DeepEqual(expected, parse(tt.expected)) {
+				t.Errorf("ignoreDifferences() modified expected resource")
+			}
+		})
+	}
+}
+
+func Test_ignoreDifferences_injectedElement(t *testing.T) {
+	parse := func(content string) *unstructured.Unstructured {
+		resources, err := dynamic.StringToUnstructured(content)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", content, err)
+		}
+		return resources[0]
+	}
+	// The sidecar is injected ahead of the rendered containers
+	found := parse(`apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: postgres
+spec:
+  template:
+    spec:
+      containers:
+      - name: istio-proxy
+        image: istio/proxyv2
+      - name: postgres
+        image: postgres:16`)
+	expected := parse(`apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: postgres
+  annotations:
+    interoperator.servicefabrik.io/ignore-differences: '["$.spec.template.spec.containers[?(@.name==''istio-proxy'')]"]'
+spec:
+  template:
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:17`)
+
+	got, err := ignoreDifferences(expected, found)
+	if err != nil {
+		t.Fatalf("ignoreDifferences() error = %v", err)
+	}
+	containers, _, _ := unstructured.NestedSlice(got.Object, "spec", "template", "spec", "containers")
+	if len(containers) != 2 || containers[0].(map[string]interface{})["name"] != "istio-proxy" ||
+		containers[1].(map[string]interface{})["image"] != "postgres:17" {
+		t.Fatalf("ignoreDifferences() containers = %v, want istio-proxy and postgres:17", containers)
+	}
+
+	// Lists are updated by index, so the sidecar is kept
+	updated, _, err := dynamic.DeepUpdate(found.DeepCopy().Object, got.Object)
+	if err != nil {
+		t.Fatalf("DeepUpdate() error = %v", err)
+	}
+	containers, _, _ = unstructured.NestedSlice(updated.(map[string]interface{}), "spec", "template", "spec", "containers")
+	if len(containers) != 2 || containers[0].(map[string]interface{})["image"] != "istio/proxyv2" ||
+		containers[1].(map[string]interface{})["image"] != "postgres:17" {
+		t.Errorf("DeepUpdate() containers = %v, want istio-proxy and postgres:17", containers)
+	}
+}
@@ -39,6 +39,21 @@ func (m *MockResourceManager) EXPECT() *MockResourceManagerMockRecorder {
 	return m.recorder
 }
 
+// ComputeDrift mocks base method.
+func (m *MockResourceManager) ComputeDrift(client client.Client, expectedResources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ComputeDrift", client, expectedResources)
+	ret0, _ := ret[0].([]*unstructured.Unstructured)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ComputeDrift indicates an expected call of ComputeDrift.
+func (mr *MockResourceManagerMockRecorder) ComputeDrift(client, expectedResources interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ComputeDrift", reflect.TypeOf((*MockResourceManager)(nil).ComputeDrift), client, expectedResources)
+}
+
 // ComputeExpectedResources mocks base method.
 func (m *MockResourceManager) ComputeExpectedResources(client client.Client, instanceID, bindingID, serviceID, planID, action, namespace string) ([]*unstructured.Unstructured, error) {
 	m.ctrl.T.Helper()
@@ -99,6 +114,20 @@ func (mr *MockResourceManagerMockRecorder) ReconcileResources(client, expectedRe
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileResources", reflect.TypeOf((*MockResourceManager)(nil).ReconcileResources), client, expectedResources, lastResources, force)
 }
 
+// RunHook mocks base method.
+func (m *MockResourceManager) RunHook(client client.Client, hookResources []*unstructured.Unstructured, run string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunHook", client, hookResources, run)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RunHook indicates an expected call of RunHook.
+func (mr *MockResourceManagerMockRecorder) RunHook(client, hookResources, run interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunHook", reflect.TypeOf((*MockResourceManager)(nil).RunHook), client, hookResources, run)
+}
+
 // SetOwnerReference mocks base method.
 func (m *MockResourceManager) SetOwnerReference(owner v1.Object, resources []*unstructured.Unstructured, scheme *runtime.Scheme) error {
 	m.ctrl.T.Helper()
@@ -2,10 +2,16 @@ package resources
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/properties"
+	rendererFactory "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/factory"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/utils"
 
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
@@ -28,6 +34,8 @@ type ResourceManager interface {
 	ReconcileResources(client kubernetes.Client, expectedResources []*unstructured.Unstructured, lastResources []osbv1alpha1.Source, force bool) ([]osbv1alpha1.Source, error)
 	ComputeStatus(client kubernetes.Client, instanceID, bindingID, serviceID, planID, action, namespace string) (*properties.Status, error)
 	DeleteSubResources(client kubernetes.Client, subResources []osbv1alpha1.Source) ([]osbv1alpha1.Source, error)
+	RunHook(client kubernetes.Client, hookResources []*unstructured.Unstructured, run string) error
+	ComputeDrift(client kubernetes.Client, expectedResources []*unstructured.Unstructured) ([]*unstructured.Unstructured, error)
 }
 
 type resourceManager struct {
@@ -55,7 +63,7 @@ func (r resourceManager) ComputeExpectedResources(client kubernetes.Client, inst
 	}
 
 	switch action {
-	case osbv1alpha1.BindAction, osbv1alpha1.UnbindAction:
+	case osbv1alpha1.BindAction, osbv1alpha1.UnbindAction, osbv1alpha1.PostBindAction:
 		name.Name = binding.GetName()
 	}
 
@@ -70,6 +78,20 @@ func (r resourceManager) ComputeExpectedResources(client kubernetes.Client, inst
 		log.Error(err, "failed listing rendered resource files")
 		return nil, err
 	}
+	// Renderers like helm list the files in random order
+	sort.Strings(files)
+
+	// The retention policy of the plan applies to the resources of instances
+	retentionPolicy := ""
+	if action == osbv1alpha1.ProvisionAction && plan.Spec.RetentionPolicy != "" {
+		if _, err := parseRetention(plan.Spec.RetentionPolicy); err != nil {
+			err = errors.NewValidationError(fmt.Sprintf("plan %s: invalid retentionPolicy %q",
+				plan.GetName(), plan.Spec.RetentionPolicy), err)
+			log.Error(err, "failed to compute expected resources")
+			return nil, err
+		}
+		retentionPolicy = plan.Spec.RetentionPolicy
+	}
 
 	resources := make([]*unstructured.Unstructured, 0, len(files))
 	for _, file := range files {
@@ -87,6 +109,20 @@ func (r resourceManager) ComputeExpectedResources(client kubernetes.Client, inst
 
 		for _, obj := range subresources {
 			obj.SetNamespace(namespace)
+			if plan.Spec.ServerSideApply {
+				setServerSideApply(obj)
+			}
+			if retentionPolicy != "" {
+				setRetention(obj, retentionPolicy)
+			}
+			if _, err := retentionOf(obj); err != nil {
+				log.Error(err, "failed to compute expected resources")
+				return nil, err
+			}
+			if err := setIgnoreDifferences(obj, plan.Spec.IgnoreDifferences); err != nil {
+				log.Error(err, "failed to compute expected resources")
+				return nil, err
+			}
 			resources = append(resources, obj)
 		}
 	}
@@ -104,67 +140,54 @@ func (r resourceManager) SetOwnerReference(owner metav1.Object, resources []*uns
 	return nil
 }
 
-// ReconcileResources setups all resources according to expectation
+// ReconcileResources setups all resources according to expectation.
+// Resources annotated for server-side apply are applied, all others are
+// created or updated. If force is set, the resources are updated to the
+// expected resources and conflicts of server-side apply are overridden.
+// Existing resources not owned by the owner of the expected resources are
+// only reconciled if they are adopted, otherwise an AdoptionConflict is
+// returned.
+// The resources are reconciled in the order of their waves. If the resources
+// of a wave are not ready yet, the resources reconciled so far are returned
+// along with a WaveNotReady error and the later waves are reconciled on the
+// next call.
 func (r resourceManager) ReconcileResources(client kubernetes.Client, expectedResources []*unstructured.Unstructured, lastResources []osbv1alpha1.Source, force bool) ([]osbv1alpha1.Source, error) {
-	foundResources := make([]*unstructured.Unstructured, 0, len(expectedResources))
-	for _, expectedResource := range expectedResources {
-		foundResource := &unstructured.Unstructured{}
-
-		kind := expectedResource.GetKind()
-		apiVersion := expectedResource.GetAPIVersion()
-		foundResource.SetKind(kind)
-		foundResource.SetAPIVersion(apiVersion)
-		namespacedName := types.NamespacedName{
-			Name:      expectedResource.GetName(),
-			Namespace: expectedResource.GetNamespace(),
-		}
-		foundResource.SetName(namespacedName.Name)
-		foundResource.SetNamespace(namespacedName.Namespace)
+	waves, err := groupByWave(expectedResources)
+	if err != nil {
+		log.Error(err, "reconcile - failed to order resources by wave")
+		return nil, err
+	}
 
-		err := client.Get(context.TODO(), namespacedName, foundResource)
-		if err != nil && apiErrors.IsNotFound(err) {
-			log.Info("reconcile - creating resource", "kind", kind, "namespacedName", namespacedName)
-			err = client.Create(context.TODO(), expectedResource)
+	foundResources := make([]*unstructured.Unstructured, 0, len(expectedResources))
+	for i, w := range waves {
+		for _, expectedResource := range w.resources {
+			foundResource, err := reconcileResource(client, expectedResource, force)
 			if err != nil {
-				log.Error(err, "reconcile - failed to create resource", "kind", kind, "namespacedName", namespacedName)
 				return nil, err
 			}
 			foundResources = append(foundResources, foundResource)
-			continue
-		} else if err != nil {
-			log.Error(err, "reconcile - failed fetching resource", "kind", kind, "namespacedName", namespacedName)
-			return nil, err
 		}
-
-		toBeUpdated := false
-		var updatedResource interface{}
-		log.V(2).Info("reconcile - expectedResource resource", "foundResource", foundResource.Object, "expectedResource", expectedResource.Object)
-		if !force {
-			updatedResource, toBeUpdated, err = dynamic.DeepUpdate(foundResource.Object, expectedResource.Object)
-			if err != nil {
-				log.Error(err, "reconcile- failed to update resource ", "kind ", kind, "namespacedName ", namespacedName)
-				return nil, err
-			}
+		if i == len(waves)-1 {
+			break
 		}
-		if toBeUpdated || force {
-			log.Info("reconcile - updating resource", "kind", kind, "namespacedName", namespacedName)
-			if force {
-				log.Info("reconcile - force updating resource", "resource", expectedResource.Object)
-				err = client.Update(context.TODO(), expectedResource)
-			} else {
-				foundResource.Object = updatedResource.(map[string]interface{})
-				// Printing the object leaks credentialsstores in subresources. Disabling it for now.
-				// log.Info("reconcile - updating resource", "resource", foundResource.Object)
-				err = client.Update(context.TODO(), foundResource)
+		err = waitForWave(client, w)
+		if err != nil && !errors.WaveNotReady(err) {
+			log.Error(err, "reconcile - failed to check readiness of wave", "wave", w.number)
+			return nil, err
+		} else if err != nil {
+			log.Info("reconcile - waiting for wave", "wave", w.number, "reason", err.Error())
+			// Outdated resources are deleted once all waves are reconciled
+			resourceRefs := []osbv1alpha1.Source{}
+			for _, object := range foundResources {
+				resourceRefs = append(resourceRefs, unstructuredToSource(object))
 			}
-			if err != nil {
-				log.Error(err, "reconcile- failed to update resource", "kind", kind, "namespacedName", namespacedName)
-				return nil, err
+			for _, lastResource := range lastResources {
+				if !findSource(resourceRefs, lastResource) {
+					resourceRefs = append(resourceRefs, lastResource)
+				}
 			}
-		} else {
-			log.Info("reconcile - resource already up todate", "kind", kind, "namespacedName", namespacedName)
+			return resourceRefs, err
 		}
-		foundResources = append(foundResources, foundResource)
 	}
 
 	for _, lastResource := range lastResources {
@@ -197,6 +220,84 @@ func (r resourceManager) ReconcileResources(client kubernetes.Client, expectedRe
 	return resourceRefs, nil
 }
 
+// reconcileResource creates, updates or applies expectedResource and
+// returns the found resource
+func reconcileResource(client kubernetes.Client, expectedResource *unstructured.Unstructured, force bool) (*unstructured.Unstructured, error) {
+	if serverSideApply(expectedResource) {
+		return applyResource(client, expectedResource, force)
+	}
+
+	foundResource := &unstructured.Unstructured{}
+
+	kind := expectedResource.GetKind()
+	apiVersion := expectedResource.GetAPIVersion()
+	foundResource.SetKind(kind)
+	foundResource.SetAPIVersion(apiVersion)
+	namespacedName := types.NamespacedName{
+		Name:      expectedResource.GetName(),
+		Namespace: expectedResource.GetNamespace(),
+	}
+	foundResource.SetName(namespacedName.Name)
+	foundResource.SetNamespace(namespacedName.Namespace)
+
+	err := client.Get(context.TODO(), namespacedName, foundResource)
+	if err != nil && apiErrors.IsNotFound(err) {
+		log.Info("reconcile - creating resource", "kind", kind, "namespacedName", namespacedName)
+		err = client.Create(context.TODO(), expectedResource, kubernetes.FieldOwner(constants.FieldManagerName))
+		if err != nil {
+			log.Error(err, "reconcile - failed to create resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
+		}
+		return foundResource, nil
+	} else if err != nil {
+		log.Error(err, "reconcile - failed fetching resource", "kind", kind, "namespacedName", namespacedName)
+		return nil, err
+	}
+
+	err = adoptResource(client, expectedResource, foundResource)
+	if err != nil {
+		log.Error(err, "reconcile - failed to adopt resource", "kind", kind, "namespacedName", namespacedName)
+		return nil, err
+	}
+
+	// Fields left to other controllers are kept
+	expectedResource, err = ignoreDifferences(expectedResource, foundResource)
+	if err != nil {
+		log.Error(err, "reconcile - failed to ignore differences of resource", "kind", kind, "namespacedName", namespacedName)
+		return nil, err
+	}
+
+	toBeUpdated := false
+	var updatedResource interface{}
+	log.V(2).Info("reconcile - expectedResource resource", "foundResource", foundResource.Object, "expectedResource", expectedResource.Object)
+	if !force {
+		updatedResource, toBeUpdated, err = dynamic.DeepUpdate(foundResource.Object, expectedResource.Object)
+		if err != nil {
+			log.Error(err, "reconcile- failed to update resource ", "kind ", kind, "namespacedName ", namespacedName)
+			return nil, err
+		}
+	}
+	if toBeUpdated || force {
+		log.Info("reconcile - updating resource", "kind", kind, "namespacedName", namespacedName)
+		if force {
+			log.Info("reconcile - force updating resource", "resource", expectedResource.Object)
+			err = client.Update(context.TODO(), expectedResource, kubernetes.FieldOwner(constants.FieldManagerName))
+		} else {
+			foundResource.Object = updatedResource.(map[string]interface{})
+			// Printing the object leaks credentialsstores in subresources. Disabling it for now.
+			// log.Info("reconcile - updating resource", "resource", foundResource.Object)
+			err = client.Update(context.TODO(), foundResource, kubernetes.FieldOwner(constants.FieldManagerName))
+		}
+		if err != nil {
+			log.Error(err, "reconcile- failed to update resource", "kind", kind, "namespacedName", namespacedName)
+			return nil, err
+		}
+	} else {
+		log.Info("reconcile - resource already up todate", "kind", kind, "namespacedName", namespacedName)
+	}
+	return foundResource, nil
+}
+
 // ComputeStatus computes status template
 func (r resourceManager) ComputeStatus(client kubernetes.Client, instanceID, bindingID, serviceID, planID, action, namespace string) (*properties.Status, error) {
 	log := log.WithValues("serviceID", serviceID, "planID", planID, "instanceID", instanceID, "bindingID", bindingID, "action", action, "namespace", namespace)
@@ -257,7 +358,94 @@ func (r resourceManager) ComputeStatus(client kubernetes.Client, instanceID, bin
 	return status, nil
 }
 
-// DeleteSubResources setups all resources according to expectation
+// ComputeSources renders the sources template of the plan and returns the
+// objects listed in it
+func ComputeSources(client kubernetes.Client, instanceID, bindingID, serviceID, planID, namespace string) (map[string]osbv1alpha1.Source, error) {
+	log := log.WithValues("serviceID", serviceID, "planID", planID, "instanceID", instanceID, "bindingID", bindingID, "namespace", namespace)
+	instance, binding, service, plan, err := fetchResources(client, instanceID, bindingID, serviceID, planID, namespace)
+	if err != nil {
+		log.Error(err, "failed fetching resources to compute sources")
+		return nil, err
+	}
+	if instance == nil {
+		return nil, errors.NewInputError("ComputeSources", "instance", nil)
+	}
+	if plan == nil {
+		return nil, errors.NewInputError("ComputeSources", "plan", nil)
+	}
+
+	sourceObjects, err := templateObjects(instance, binding, service, plan)
+	if err != nil {
+		return nil, err
+	}
+	name := types.NamespacedName{
+		Namespace: namespace,
+		Name:      instance.GetName(),
+	}
+	return renderSources(client, plan, name, sourceObjects)
+}
+
+// ComputeClusterSelector renders the clusterSelector template of the plan
+// for the instance. The label selector is empty if the plan does not have
+// a clusterSelector gotemplate, in which case any cluster can be chosen.
+func ComputeClusterSelector(client kubernetes.Client, instance *osbv1alpha1.SFServiceInstance, plan *osbv1alpha1.SFPlan) (string, error) {
+	log := log.WithValues("instanceID", instance.GetName(), "planID", instance.Spec.PlanID)
+	service := &osbv1alpha1.SFService{}
+	namespacedName := types.NamespacedName{
+		Name:      instance.Spec.ServiceID,
+		Namespace: constants.InteroperatorNamespace,
+	}
+	err := client.Get(context.TODO(), namespacedName, service)
+	if err != nil {
+		return "", err
+	}
+
+	labelSelectorTemplate, err := plan.GetTemplate(osbv1alpha1.ClusterLabelSelectorAction)
+	if err != nil {
+		if errors.TemplateNotFound(err) {
+			log.Info("Plan does not have clusterSelector template")
+			// don't return error here. In cases when clusterSelector is not provided, scheduling should happen with least utilized cluster strategy
+			return "", nil
+		}
+		return "", err
+	}
+
+	if labelSelectorTemplate.Type != constants.GoTemplateType {
+		log.Info("Plan does not have clusterSelector gotemplate")
+		// don't return error here. In cases when clusterSelector is not of gotemplate, scheduling should happen with least utilized cluster strategy
+		return "", nil
+	}
+
+	r, err := rendererFactory.GetRenderer(labelSelectorTemplate.Type, client)
+	if err != nil {
+		return "", err
+	}
+	name := types.NamespacedName{
+		Namespace: instance.GetNamespace(),
+		Name:      instance.GetName(),
+	}
+	rendererInput, err := rendererFactory.GetRendererInput(labelSelectorTemplate, service, plan, instance, nil, name)
+	if err != nil {
+		return "", err
+	}
+	rendererOutput, err := r.Render(rendererInput)
+	if err != nil {
+		return "", err
+	}
+	labelSelector, err := rendererOutput.FileContent("main")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(labelSelector, "\n"), nil
+}
+
+// DeleteSubResources setups all resources according to expectation.
+// Resources of instances with a retention policy retaining them are
+// detached from the instance instead of being deleted.
+// The resources are deleted in the reverse order of their waves. The
+// resources of a wave are deleted once the resources of all later waves are
+// gone. Until then the remaining resources are returned along with a
+// WaveNotReady error.
 func (r resourceManager) DeleteSubResources(client kubernetes.Client, subResources []osbv1alpha1.Source) ([]osbv1alpha1.Source, error) {
 	//
 	// delete the external dependency here
@@ -268,13 +456,64 @@ func (r resourceManager) DeleteSubResources(client kubernetes.Client, subResourc
 	var remainingResource []osbv1alpha1.Source
 	var lastError error
 
+	type existingResource struct {
+		source   osbv1alpha1.Source
+		resource *unstructured.Unstructured
+		wave     int
+	}
+	existingResources := make([]existingResource, 0, len(subResources))
+	lastWave := 0
 	for _, subResource := range subResources {
-		resource := &unstructured.Unstructured{}
-		resource.SetKind(subResource.Kind)
-		resource.SetAPIVersion(subResource.APIVersion)
-		resource.SetName(subResource.Name)
-		resource.SetNamespace(subResource.Namespace)
-		err := deleteSubResource(client, resource)
+		resource, wave, err := sourceWave(client, subResource)
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				log.Info("deleted completed for subResource", "subResource", subResource)
+				continue
+			}
+			log.Error(err, "failed to fetch subResource", "subResource", subResource)
+			remainingResource = append(remainingResource, subResource)
+			lastError = err
+			continue
+		}
+		if len(existingResources) == 0 || wave > lastWave {
+			lastWave = wave
+		}
+		existingResources = append(existingResources, existingResource{
+			source:   subResource,
+			resource: resource,
+			wave:     wave,
+		})
+	}
+
+	var waitingFor *osbv1alpha1.Source
+	waiting := false
+	for i, existing := range existingResources {
+		subResource := existing.source
+		if existing.wave < lastWave {
+			log.Info("delete waiting for later waves", "subResource", subResource, "wave", existing.wave)
+			remainingResource = append(remainingResource, subResource)
+			waiting = true
+			continue
+		}
+		if waitingFor == nil {
+			waitingFor = &existingResources[i].source
+		}
+		retained, err := retainSubResource(client, existing.resource)
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				log.Info("deleted completed for subResource", "subResource", subResource)
+				continue
+			}
+			log.Error(err, "failed to retain subResource", "subResource", subResource)
+			remainingResource = append(remainingResource, subResource)
+			lastError = err
+			continue
+		}
+		if retained {
+			log.Info("retained subResource", "subResource", subResource)
+			continue
+		}
+		err = deleteSubResource(client, existing.resource)
 		if err != nil {
 			if apiErrors.IsNotFound(err) {
 				log.Info("deleted completed for subResource", "subResource", subResource)
@@ -288,5 +527,9 @@ func (r resourceManager) DeleteSubResources(client kubernetes.Client, subResourc
 		log.Info("deleted triggered for subResource", "subResource", subResource)
 		remainingResource = append(remainingResource, subResource)
 	}
+
+	if lastError == nil && waiting {
+		lastError = errors.NewWaveNotReady(lastWave, fmt.Sprintf("%s %s/%s not deleted", waitingFor.Kind, waitingFor.Namespace, waitingFor.Name), nil)
+	}
 	return remainingResource, lastError
 }
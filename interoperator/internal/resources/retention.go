@@ -0,0 +1,314 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Retention policies of resources on deprovision. Any other value is the
+// duration for which the resource is retained.
+const (
+	retentionDelete = "delete"
+	retentionRetain = "retain"
+)
+
+// retention of a resource on deprovision
+type retention struct {
+	retain bool
+	// duration is the time for which the resource is retained. Resources
+	// retained without a duration are kept until deleted manually.
+	duration time.Duration
+}
+
+// parseRetention parses the retention policy value
+func parseRetention(value string) (retention, error) {
+	switch value {
+	case retentionDelete:
+		return retention{}, nil
+	case retentionRetain:
+		return retention{retain: true}, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return retention{}, err
+	}
+	if duration <= 0 {
+		return retention{}, fmt.Errorf("duration %s not positive", value)
+	}
+	return retention{retain: true, duration: duration}, nil
+}
+
+// retentionOf returns the retention of resource. Resources without the
+// retention annotation are deleted.
+func retentionOf(resource *unstructured.Unstructured) (retention, error) {
+	value, ok := resource.GetAnnotations()[constants.RetentionKey]
+	if !ok {
+		return retention{}, nil
+	}
+	r, err := parseRetention(value)
+	if err != nil {
+		return retention{}, errors.NewValidationError(fmt.Sprintf("%s %s: invalid value %q of annotation %s",
+			resource.GetKind(), resource.GetName(), value, constants.RetentionKey), err)
+	}
+	return r, nil
+}
+
+// setRetention annotates resource with the retention policy of the plan
+// unless the template already decided for the resource
+func setRetention(resource *unstructured.Unstructured, policy string) {
+	annotations := resource.GetAnnotations()
+	if _, ok := annotations[constants.RetentionKey]; ok {
+		return
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[constants.RetentionKey] = policy
+	resource.SetAnnotations(annotations)
+}
+
+// ownerInstanceID returns the ID of the instance owning resource
+func ownerInstanceID(resource *unstructured.Unstructured) string {
+	for _, ref := range resource.GetOwnerReferences() {
+		if ref.APIVersion == osbv1alpha1.GroupVersion.String() && ref.Kind == "SFServiceInstance" {
+			return ref.Name
+		}
+	}
+	return ""
+}
+
+// instanceNamespace returns the namespace the broker creates for the
+// instance with instanceID if namespaced separation is enabled
+func instanceNamespace(instanceID string) string {
+	return "sf-" + instanceID
+}
+
+// keepNamespace labels namespace as holding retained resources if it is the
+// namespace of the instance. The broker and the replicator do not delete
+// labelled namespaces along with the instance.
+func keepNamespace(client kubernetes.Client, namespace, instanceID string) error {
+	if namespace != instanceNamespace(instanceID) {
+		return nil
+	}
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName(namespace)
+	return updateWithRetry(client, ns, func() error {
+		labels := ns.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[constants.RetainedResourcesKey] = "true"
+		ns.SetLabels(labels)
+		return nil
+	})
+}
+
+// retainResource detaches resource from the instance owning it, so that it
+// is not garbage collected along with the instance, and labels it with the
+// instance ID. Resources retained for a duration are annotated with the
+// time after which they are deleted.
+func retainResource(client kubernetes.Client, resource *unstructured.Unstructured, r retention, instanceID string) error {
+	retainUntil := ""
+	if r.duration > 0 {
+		retainUntil = time.Now().Add(r.duration).UTC().Format(time.RFC3339)
+	}
+	return updateWithRetry(client, resource, func() error {
+		ownerReferences := make([]metav1.OwnerReference, 0, len(resource.GetOwnerReferences()))
+		for _, ref := range resource.GetOwnerReferences() {
+			if ref.APIVersion != osbv1alpha1.GroupVersion.String() {
+				ownerReferences = append(ownerReferences, ref)
+			}
+		}
+		resource.SetOwnerReferences(ownerReferences)
+
+		labels := resource.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[constants.RetainedInstanceIDKey] = instanceID
+		resource.SetLabels(labels)
+
+		if retainUntil != "" {
+			annotations := resource.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[constants.RetainUntilKey] = retainUntil
+			resource.SetAnnotations(annotations)
+		}
+		return nil
+	})
+}
+
+// retainSubResource retains resource if it is owned by an instance and its
+// retention policy retains it. It returns false if resource must be deleted.
+func retainSubResource(client kubernetes.Client, resource *unstructured.Unstructured) (bool, error) {
+	r, err := retentionOf(resource)
+	if err != nil {
+		// Keep the resource rather than losing data to a typo
+		log.Error(err, "retaining resource with invalid retention policy", "kind", resource.GetKind(),
+			"namespace", resource.GetNamespace(), "name", resource.GetName())
+		r = retention{retain: true}
+	}
+	if !r.retain {
+		return false, nil
+	}
+	instanceID := ownerInstanceID(resource)
+	if instanceID == "" {
+		log.Info("deleting resource not owned by an instance despite its retention policy", "kind", resource.GetKind(),
+			"namespace", resource.GetNamespace(), "name", resource.GetName())
+		return false, nil
+	}
+	err = keepNamespace(client, resource.GetNamespace(), instanceID)
+	if err != nil {
+		return false, err
+	}
+	err = retainResource(client, resource, r, instanceID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CleanupRetainedResources deletes the retained resources of kinds whose
+// retention expired and releases the instance namespaces which no longer
+// hold retained resources. It returns the time at which the next retained
+// resource expires, or the zero time if none is retained for a duration.
+func CleanupRetainedResources(client kubernetes.Client, kinds []osbv1alpha1.APIVersionKind) (time.Time, error) {
+	var nextExpiry time.Time
+	var lastError error
+	now := time.Now()
+	listed := make(map[osbv1alpha1.APIVersionKind]bool)
+	retaining := make(map[string]bool)
+	for _, kind := range kinds {
+		if listed[kind] {
+			continue
+		}
+		listed[kind] = true
+
+		list := &unstructured.UnstructuredList{}
+		list.SetAPIVersion(kind.GetAPIVersion())
+		list.SetKind(kind.GetKind() + "List")
+		for more := true; more; more = (list.GetContinue() != "") {
+			err := client.List(context.TODO(), list, kubernetes.HasLabels{constants.RetainedInstanceIDKey},
+				kubernetes.Limit(constants.ListPaginationLimit), kubernetes.Continue(list.GetContinue()))
+			if err != nil {
+				if meta.IsNoMatchError(err) {
+					log.Info("cleanup - kind not served", "kind", kind)
+					break
+				}
+				log.Error(err, "cleanup - failed to list retained resources", "kind", kind)
+				lastError = err
+				break
+			}
+			for i := range list.Items {
+				resource := &list.Items[i]
+				if !resource.GetDeletionTimestamp().IsZero() {
+					continue
+				}
+				value, ok := resource.GetAnnotations()[constants.RetainUntilKey]
+				if !ok {
+					retaining[resource.GetNamespace()] = true
+					continue
+				}
+				retainUntil, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					log.Error(err, "cleanup - invalid retention of resource", "kind", kind,
+						"namespace", resource.GetNamespace(), "name", resource.GetName())
+					retaining[resource.GetNamespace()] = true
+					continue
+				}
+				if retainUntil.After(now) {
+					if nextExpiry.IsZero() || retainUntil.Before(nextExpiry) {
+						nextExpiry = retainUntil
+					}
+					retaining[resource.GetNamespace()] = true
+					continue
+				}
+				err = deleteSubResource(client, resource)
+				if err != nil && !apiErrors.IsNotFound(err) {
+					log.Error(err, "cleanup - failed to delete retained resource", "kind", kind,
+						"namespace", resource.GetNamespace(), "name", resource.GetName())
+					retaining[resource.GetNamespace()] = true
+					lastError = err
+					continue
+				}
+				log.Info("cleanup - deleted retained resource", "kind", kind, "namespace", resource.GetNamespace(),
+					"name", resource.GetName(), "instanceID", resource.GetLabels()[constants.RetainedInstanceIDKey])
+			}
+		}
+	}
+	if lastError != nil {
+		// Retained resources which were not listed may be left in the
+		// labelled namespaces
+		return nextExpiry, lastError
+	}
+	return nextExpiry, releaseNamespaces(client, retaining)
+}
+
+// releaseNamespaces removes the retained resources label from the instance
+// namespaces not in retaining. Namespaces of instances which were
+// provisioned again are kept, so that the broker deletes them along with the
+// instance, and the others are deleted.
+func releaseNamespaces(client kubernetes.Client, retaining map[string]bool) error {
+	namespaces := &corev1.NamespaceList{}
+	err := client.List(context.TODO(), namespaces, kubernetes.HasLabels{constants.RetainedResourcesKey})
+	if err != nil {
+		log.Error(err, "cleanup - failed to list namespaces with retained resources")
+		return err
+	}
+	var lastError error
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if retaining[ns.GetName()] || !ns.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		instances := &osbv1alpha1.SFServiceInstanceList{}
+		err := client.List(context.TODO(), instances, kubernetes.InNamespace(ns.GetName()))
+		if err != nil {
+			log.Error(err, "cleanup - failed to list instances", "namespace", ns.GetName())
+			lastError = err
+			continue
+		}
+		deprovisioning := false
+		for j := range instances.Items {
+			if !instances.Items[j].GetDeletionTimestamp().IsZero() {
+				deprovisioning = true
+			}
+		}
+		switch {
+		case deprovisioning:
+			// The deprovision may still retain resources
+			continue
+		case len(instances.Items) > 0:
+			labels := ns.GetLabels()
+			delete(labels, constants.RetainedResourcesKey)
+			ns.SetLabels(labels)
+			err = client.Update(context.TODO(), ns)
+		default:
+			err = client.Delete(context.TODO(), ns)
+		}
+		if err != nil && !apiErrors.IsNotFound(err) {
+			log.Error(err, "cleanup - failed to release namespace", "namespace", ns.GetName())
+			lastError = err
+			continue
+		}
+		log.Info("cleanup - released namespace without retained resources", "namespace", ns.GetName(),
+			"deleted", len(instances.Items) == 0)
+	}
+	return lastError
+}
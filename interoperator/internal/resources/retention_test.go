@@ -0,0 +1,233 @@
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_retentionOf(t *testing.T) {
+	resource := func(value string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetName("data")
+		if value != "" {
+			obj.SetAnnotations(map[string]string{constants.RetentionKey: value})
+		}
+		return obj
+	}
+	tests := []struct {
+		name     string
+		resource *unstructured.Unstructured
+		want     retention
+		wantErr  bool
+	}{
+		{
+			name:     "delete resources without annotation",
+			resource: resource(""),
+			want:     retention{},
+		},
+		{
+			name:     "delete resources",
+			resource: resource("delete"),
+			want:     retention{},
+		},
+		{
+			name:     "retain resources",
+			resource: resource("retain"),
+			want:     retention{retain: true},
+		},
+		{
+			name:     "retain resources for duration",
+			resource: resource("168h"),
+			want:     retention{retain: true, duration: 168 * time.Hour},
+		},
+		{
+			name:     "fail on negative duration",
+			resource: resource("-1h"),
+			wantErr:  true,
+		},
+		{
+			name:     "fail on invalid value",
+			resource: resource("keep"),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := retentionOf(tt.resource)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retentionOf() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.ValidationError(err) {
+					t.Errorf("retentionOf() error = %v, want ValidationError", err)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("retentionOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resourceManager_DeleteSubResources_Retention(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	resources, err := dynamic.StringToUnstructured(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: retained-config
+  namespace: default
+  annotations:
+    interoperator.servicefabrik.io/retention: 1h
+  ownerReferences:
+  - apiVersion: osb.servicefabrik.io/v1alpha1
+    kind: SFServiceInstance
+    name: instance-id
+    uid: 5bd9a4ea-2d1b-4b8e-8a47-1f0e2b4f7d10
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: deleted-config
+  namespace: default
+  ownerReferences:
+  - apiVersion: osb.servicefabrik.io/v1alpha1
+    kind: SFServiceInstance
+    name: instance-id
+    uid: 5bd9a4ea-2d1b-4b8e-8a47-1f0e2b4f7d10`)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	subResources := make([]osbv1alpha1.Source, 0, len(resources))
+	for _, obj := range resources {
+		g.Expect(c.Create(context.TODO(), obj)).NotTo(gomega.HaveOccurred())
+		defer c.Delete(context.TODO(), obj)
+		subResources = append(subResources, unstructuredToSource(obj))
+	}
+
+	r := resourceManager{}
+	got, err := r.DeleteSubResources(c, subResources)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(got).To(gomega.Equal(subResources[1:]))
+
+	retained := &unstructured.Unstructured{}
+	retained.SetGroupVersionKind(resources[0].GroupVersionKind())
+	retainedKey := types.NamespacedName{Name: "retained-config", Namespace: constants.InteroperatorNamespace}
+	g.Expect(c.Get(context.TODO(), retainedKey, retained)).NotTo(gomega.HaveOccurred())
+	g.Expect(retained.GetOwnerReferences()).To(gomega.BeEmpty())
+	g.Expect(retained.GetLabels()).To(gomega.HaveKeyWithValue(constants.RetainedInstanceIDKey, "instance-id"))
+	g.Expect(retained.GetAnnotations()).To(gomega.HaveKey(constants.RetainUntilKey))
+}
+
+func Test_CleanupRetainedResources(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	retainUntil := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	resources, err := dynamic.StringToUnstructured(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: expired-config
+  namespace: default
+  labels:
+    interoperator.servicefabrik.io/retained-instance-id: instance-id
+  annotations:
+    interoperator.servicefabrik.io/retain-until: "2020-01-01T00:00:00Z"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: retained-config
+  namespace: default
+  labels:
+    interoperator.servicefabrik.io/retained-instance-id: instance-id
+  annotations:
+    interoperator.servicefabrik.io/retain-until: "` + retainUntil.Format(time.RFC3339) + `"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: retained-forever-config
+  namespace: default
+  labels:
+    interoperator.servicefabrik.io/retained-instance-id: instance-id`)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	for _, obj := range resources {
+		g.Expect(c.Create(context.TODO(), obj)).NotTo(gomega.HaveOccurred())
+		defer c.Delete(context.TODO(), obj)
+	}
+
+	kinds := []osbv1alpha1.APIVersionKind{
+		{APIVersion: "v1", Kind: "ConfigMap"},
+		{APIVersion: "v1", Kind: "ConfigMap"},
+	}
+	nextExpiry, err := CleanupRetainedResources(c, kinds)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(nextExpiry.Equal(retainUntil)).To(gomega.BeTrue())
+
+	for _, obj := range resources {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(obj.GroupVersionKind())
+		err := c.Get(context.TODO(), types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, current)
+		if obj.GetName() == "expired-config" {
+			g.Expect(apiErrors.IsNotFound(err)).To(gomega.BeTrue())
+		} else {
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+	}
+}
+
+func Test_CleanupRetainedResources_Namespace(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ns := &corev1.Namespace{}
+	ns.SetName("sf-retaining-instance-id")
+	g.Expect(c.Create(context.TODO(), ns)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), ns)
+
+	resources, err := dynamic.StringToUnstructured(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: retained-config
+  namespace: sf-retaining-instance-id
+  annotations:
+    interoperator.servicefabrik.io/retention: retain
+  ownerReferences:
+  - apiVersion: osb.servicefabrik.io/v1alpha1
+    kind: SFServiceInstance
+    name: retaining-instance-id
+    uid: 5bd9a4ea-2d1b-4b8e-8a47-1f0e2b4f7d10`)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	retained := resources[0]
+	g.Expect(c.Create(context.TODO(), retained)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), retained)
+
+	r := resourceManager{}
+	_, err = r.DeleteSubResources(c, []osbv1alpha1.Source{unstructuredToSource(retained)})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	kinds := []osbv1alpha1.APIVersionKind{{APIVersion: "v1", Kind: "ConfigMap"}}
+	nsKey := types.NamespacedName{Name: "sf-retaining-instance-id"}
+
+	// The namespace is kept while it holds retained resources
+	_, err = CleanupRetainedResources(c, kinds)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(c.Get(context.TODO(), nsKey, ns)).NotTo(gomega.HaveOccurred())
+	g.Expect(ns.GetLabels()).To(gomega.HaveKeyWithValue(constants.RetainedResourcesKey, "true"))
+	g.Expect(ns.GetDeletionTimestamp().IsZero()).To(gomega.BeTrue())
+
+	// and deleted once the retained resources are gone
+	g.Expect(c.Delete(context.TODO(), retained)).NotTo(gomega.HaveOccurred())
+	_, err = CleanupRetainedResources(c, kinds)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	err = c.Get(context.TODO(), nsKey, ns)
+	g.Expect(apiErrors.IsNotFound(err) || !ns.GetDeletionTimestamp().IsZero()).To(gomega.BeTrue())
+}
@@ -0,0 +1,229 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kubernetes "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// wave is a group of resources with the same wave annotation
+type wave struct {
+	number    int
+	resources []*unstructured.Unstructured
+}
+
+// waveOf returns the wave of resource. Resources without the wave
+// annotation belong to wave 0.
+func waveOf(resource *unstructured.Unstructured) (int, error) {
+	value, ok := resource.GetAnnotations()[constants.WaveKey]
+	if !ok {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.NewValidationError(fmt.Sprintf("%s %s: invalid value %q of annotation %s",
+			resource.GetKind(), resource.GetName(), value, constants.WaveKey), err)
+	}
+	return number, nil
+}
+
+// groupByWave groups the resources by their wave in ascending order. The
+// order of the resources within a wave is kept.
+func groupByWave(resources []*unstructured.Unstructured) ([]wave, error) {
+	indices := make(map[int]int)
+	waves := []wave{}
+	for _, resource := range resources {
+		number, err := waveOf(resource)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := indices[number]
+		if !ok {
+			i = len(waves)
+			indices[number] = i
+			waves = append(waves, wave{number: number})
+		}
+		waves[i].resources = append(waves[i].resources, resource)
+	}
+	sort.SliceStable(waves, func(i, j int) bool {
+		return waves[i].number < waves[j].number
+	})
+	return waves, nil
+}
+
+// waitForWave fetches the resources of a wave and returns a WaveNotReady
+// error naming the resources which are not ready yet. A WaveFailed error is
+// returned if a resource failed, as it does not get ready without a change.
+func waitForWave(client kubernetes.Client, w wave) error {
+	for _, resource := range w.resources {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(resource.GroupVersionKind())
+		namespacedName := types.NamespacedName{
+			Name:      resource.GetName(),
+			Namespace: resource.GetNamespace(),
+		}
+		err := client.Get(context.TODO(), namespacedName, current)
+		if err != nil {
+			return err
+		}
+		if message, failed := resourceFailed(current); failed {
+			return errors.NewWaveFailed(w.number, fmt.Sprintf("%s %s failed. %s", resource.GetKind(), namespacedName, message), nil)
+		}
+		if !resourceReady(current) {
+			return errors.NewWaveNotReady(w.number, fmt.Sprintf("%s %s not ready", resource.GetKind(), namespacedName), nil)
+		}
+	}
+	return nil
+}
+
+// resourceReady returns true if the status of resource reports it ready.
+// Resources of kinds without a known status are ready once they exist.
+func resourceReady(resource *unstructured.Unstructured) bool {
+	status, ok := resource.Object["status"].(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	observedGeneration, ok := nestedCount(status, "observedGeneration")
+	generation, _ := nestedCount(resource.Object, "metadata", "generation")
+	if ok && observedGeneration < generation {
+		return false
+	}
+
+	// Resources of the service fabrik operators
+	if state, ok := status["state"].(string); ok {
+		return state == "succeeded"
+	}
+
+	replicas, ok := nestedCount(resource.Object, "spec", "replicas")
+	if !ok {
+		replicas = 1
+	}
+	switch resource.GroupVersionKind().GroupKind().String() {
+	case "Deployment.apps":
+		return statusCount(status, "updatedReplicas") >= replicas && statusCount(status, "availableReplicas") >= replicas
+	case "StatefulSet.apps":
+		return statusCount(status, "updatedReplicas") >= replicas && statusCount(status, "readyReplicas") >= replicas
+	case "ReplicaSet.apps":
+		return statusCount(status, "availableReplicas") >= replicas
+	case "DaemonSet.apps":
+		return statusCount(status, "updatedNumberScheduled") >= statusCount(status, "desiredNumberScheduled") &&
+			statusCount(status, "numberAvailable") >= statusCount(status, "desiredNumberScheduled")
+	case "Job.batch":
+		complete, _ := conditionStatus(status, "Complete")
+		return complete == "True"
+	case "PersistentVolumeClaim":
+		phase, _ := status["phase"].(string)
+		return phase == "Bound"
+	case "CustomResourceDefinition.apiextensions.k8s.io":
+		established, _ := conditionStatus(status, "Established")
+		return established == "True"
+	}
+
+	for _, conditionType := range []string{"Ready", "Available"} {
+		if value, ok := conditionStatus(status, conditionType); ok {
+			return value == "True"
+		}
+	}
+	return true
+}
+
+// resourceFailed returns true along with the reason if the status of
+// resource reports a failure, which is not recovered from without a change
+// of the resource
+func resourceFailed(resource *unstructured.Unstructured) (string, bool) {
+	status, ok := resource.Object["status"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	// Resources of the service fabrik operators
+	if state, ok := status["state"].(string); ok {
+		if state != "failed" {
+			return "", false
+		}
+		message, _ := status["error"].(string)
+		if message == "" {
+			message, _ = status["description"].(string)
+		}
+		return message, true
+	}
+
+	switch resource.GroupVersionKind().GroupKind().String() {
+	case "Job.batch":
+		if failed, _ := conditionStatus(status, "Failed"); failed == "True" {
+			return conditionMessage(status, "Failed"), true
+		}
+	case "Deployment.apps":
+		// The deployment controller gives up once the progress deadline is
+		// exceeded
+		if progressing, _ := conditionStatus(status, "Progressing"); progressing == "False" {
+			return conditionMessage(status, "Progressing"), true
+		}
+	}
+	return "", false
+}
+
+func statusCount(status map[string]interface{}, field string) int64 {
+	count, _ := nestedCount(status, field)
+	return count
+}
+
+// nestedCount returns the number at the path of fields in obj. Numbers are
+// int64 in objects read from the api server and float64 in parsed templates.
+func nestedCount(obj map[string]interface{}, fields ...string) (int64, bool) {
+	value, ok, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !ok {
+		return 0, false
+	}
+	switch count := value.(type) {
+	case int64:
+		return count, true
+	case int:
+		return int64(count), true
+	case float64:
+		return int64(count), true
+	}
+	return 0, false
+}
+
+// conditionStatus returns the status of the condition of conditionType
+func conditionStatus(status map[string]interface{}, conditionType string) (string, bool) {
+	conditions, _ := status["conditions"].([]interface{})
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == conditionType {
+			value, _ := condition["status"].(string)
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// sourceWave fetches the resource referred by source and returns it with its
+// wave. It fails with a NotFound error if the resource is gone.
+func sourceWave(client kubernetes.Client, source osbv1alpha1.Source) (*unstructured.Unstructured, int, error) {
+	resource := &unstructured.Unstructured{}
+	resource.SetKind(source.Kind)
+	resource.SetAPIVersion(source.APIVersion)
+	namespacedName := types.NamespacedName{
+		Name:      source.Name,
+		Namespace: source.Namespace,
+	}
+	err := client.Get(context.TODO(), namespacedName, resource)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Applying resources with an invalid wave failed, so they are in wave 0
+	number, _ := waveOf(resource)
+	return resource, number, nil
+}
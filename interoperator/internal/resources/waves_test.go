@@ -0,0 +1,362 @@
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/dynamic"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"github.com/onsi/gomega"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_groupByWave(t *testing.T) {
+	resource := func(name, wave string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetName(name)
+		if wave != "" {
+			obj.SetAnnotations(map[string]string{constants.WaveKey: wave})
+		}
+		return obj
+	}
+	tests := []struct {
+		name      string
+		resources []*unstructured.Unstructured
+		want      map[int][]string
+		wantOrder []int
+		wantErr   bool
+	}{
+		{
+			name:      "put resources without annotation in wave 0",
+			resources: []*unstructured.Unstructured{resource("a", ""), resource("b", "0")},
+			want:      map[int][]string{0: {"a", "b"}},
+			wantOrder: []int{0},
+		},
+		{
+			name: "order waves and keep order within waves",
+			resources: []*unstructured.Unstructured{
+				resource("statefulset", "1"), resource("secret", "-1"), resource("service", "1"), resource("configmap", ""),
+			},
+			want:      map[int][]string{-1: {"secret"}, 0: {"configmap"}, 1: {"statefulset", "service"}},
+			wantOrder: []int{-1, 0, 1},
+		},
+		{
+			name:      "fail on invalid wave",
+			resources: []*unstructured.Unstructured{resource("a", "first")},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := groupByWave(tt.resources)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("groupByWave() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.ValidationError(err) {
+					t.Errorf("groupByWave() error = %v, want ValidationError", err)
+				}
+				return
+			}
+			order := make([]int, 0, len(got))
+			for _, w := range got {
+				order = append(order, w.number)
+				names := make([]string, 0, len(w.resources))
+				for _, obj := range w.resources {
+					names = append(names, obj.GetName())
+				}
+				if !reflect.DeepEqual(names, tt.want[w.number]) {
+					t.Errorf("groupByWave() wave %d = %v, want %v", w.number, names, tt.want[w.number])
+				}
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("groupByWave() waves = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func Test_resourceFailed(t *testing.T) {
+	tests := []struct {
+		name        string
+		resource    string
+		want        bool
+		wantMessage string
+	}{
+		{
+			name: "not failed without status",
+			resource: `apiVersion: v1
+kind: Secret`,
+		},
+		{
+			name: "failed if state of operator resource failed",
+			resource: `apiVersion: deployment.servicefabrik.io/v1alpha1
+kind: Director
+status:
+  state: failed
+  error: deployment failed`,
+			want:        true,
+			wantMessage: "deployment failed",
+		},
+		{
+			name: "not failed if state of operator resource in progress",
+			resource: `apiVersion: deployment.servicefabrik.io/v1alpha1
+kind: Director
+status:
+  state: in progress`,
+		},
+		{
+			name: "failed if job failed",
+			resource: `apiVersion: batch/v1
+kind: Job
+status:
+  conditions:
+  - type: Failed
+    status: "True"
+    message: Job has reached the specified backoff limit`,
+			want:        true,
+			wantMessage: "Job has reached the specified backoff limit",
+		},
+		{
+			name: "failed if deployment exceeded its progress deadline",
+			resource: `apiVersion: apps/v1
+kind: Deployment
+status:
+  conditions:
+  - type: Progressing
+    status: "False"
+    reason: ProgressDeadlineExceeded
+    message: ReplicaSet has timed out progressing`,
+			want:        true,
+			wantMessage: "ReplicaSet has timed out progressing",
+		},
+		{
+			name: "not failed if deployment progressing",
+			resource: `apiVersion: apps/v1
+kind: Deployment
+status:
+  conditions:
+  - type: Progressing
+    status: "True"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources, err := dynamic.StringToUnstructured(tt.resource)
+			if err != nil {
+				t.Fatalf("failed to parse resource: %v", err)
+			}
+			message, got := resourceFailed(resources[0])
+			if got != tt.want || message != tt.wantMessage {
+				t.Errorf("resourceFailed() = %v, %v, want %v, %v", message, got, tt.wantMessage, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resourceReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		want     bool
+	}{
+		{
+			name: "ready without status",
+			resource: `apiVersion: v1
+kind: Secret`,
+			want: true,
+		},
+		{
+			name: "not ready if status of older generation",
+			resource: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  generation: 2
+spec:
+  replicas: 1
+status:
+  observedGeneration: 1
+  updatedReplicas: 1
+  availableReplicas: 1`,
+			want: false,
+		},
+		{
+			name: "ready if replicas of deployment available",
+			resource: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  generation: 2
+spec:
+  replicas: 2
+status:
+  observedGeneration: 2
+  updatedReplicas: 2
+  availableReplicas: 2`,
+			want: true,
+		},
+		{
+			name: "not ready if replicas of statefulset not ready",
+			resource: `apiVersion: apps/v1
+kind: StatefulSet
+spec:
+  replicas: 3
+status:
+  updatedReplicas: 3
+  readyReplicas: 2`,
+			want: false,
+		},
+		{
+			name: "not ready until job completes",
+			resource: `apiVersion: batch/v1
+kind: Job
+status:
+  active: 1`,
+			want: false,
+		},
+		{
+			name: "ready if persistent volume claim bound",
+			resource: `apiVersion: v1
+kind: PersistentVolumeClaim
+status:
+  phase: Bound`,
+			want: true,
+		},
+		{
+			name: "ready if state of service fabrik operator resource succeeded",
+			resource: `apiVersion: deployment.servicefabrik.io/v1alpha1
+kind: Director
+status:
+  state: succeeded`,
+			want: true,
+		},
+		{
+			name: "not ready if state of service fabrik operator resource in progress",
+			resource: `apiVersion: deployment.servicefabrik.io/v1alpha1
+kind: Director
+status:
+  state: in_queue`,
+			want: false,
+		},
+		{
+			name: "not ready if ready condition false",
+			resource: `apiVersion: kubedb.com/v1alpha1
+kind: Postgres
+status:
+  conditions:
+  - type: Available
+    status: "True"
+  - type: Ready
+    status: "False"`,
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := dynamic.StringToUnstructured(tt.resource)
+			if err != nil || len(objects) != 1 {
+				t.Fatalf("failed to parse resource %v", err)
+			}
+			if got := resourceReady(objects[0]); got != tt.want {
+				t.Errorf("resourceReady() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resourceManager_ReconcileResources_Waves(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	expectedResources, err := dynamic.StringToUnstructured(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: wave-config
+  namespace: default
+  annotations:
+    interoperator.servicefabrik.io/wave: "1"
+data:
+  key: value
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: wave-deployment
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: wave
+  template:
+    metadata:
+      labels:
+        app: wave
+    spec:
+      containers:
+      - name: app
+        image: app`)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	for _, obj := range expectedResources {
+		defer c.Delete(context.TODO(), obj.DeepCopy())
+	}
+	lastResources := []osbv1alpha1.Source{
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "wave-outdated", Namespace: constants.InteroperatorNamespace},
+	}
+
+	// The deployment of wave 0 never gets ready without a controller
+	r := resourceManager{}
+	got, err := r.ReconcileResources(c, expectedResources, lastResources, false)
+	g.Expect(errors.WaveNotReady(err)).To(gomega.BeTrue())
+	g.Expect(got).To(gomega.Equal([]osbv1alpha1.Source{
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "wave-deployment", Namespace: constants.InteroperatorNamespace},
+		lastResources[0],
+	}))
+
+	configMap := &unstructured.Unstructured{}
+	configMap.SetGroupVersionKind(expectedResources[0].GroupVersionKind())
+	configMapKey := types.NamespacedName{Name: "wave-config", Namespace: constants.InteroperatorNamespace}
+	g.Expect(apiErrors.IsNotFound(c.Get(context.TODO(), configMapKey, configMap))).To(gomega.BeTrue())
+}
+
+func Test_resourceManager_DeleteSubResources_Waves(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	resources, err := dynamic.StringToUnstructured(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: wave-first
+  namespace: default
+  annotations:
+    interoperator.servicefabrik.io/wave: "-1"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: wave-last
+  namespace: default
+  annotations:
+    interoperator.servicefabrik.io/wave: "2"`)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	subResources := make([]osbv1alpha1.Source, 0, len(resources))
+	for _, obj := range resources {
+		g.Expect(c.Create(context.TODO(), obj)).NotTo(gomega.HaveOccurred())
+		subResources = append(subResources, unstructuredToSource(obj))
+	}
+
+	// The last wave is deleted first
+	r := resourceManager{}
+	got, err := r.DeleteSubResources(c, subResources)
+	g.Expect(errors.WaveNotReady(err)).To(gomega.BeTrue())
+	g.Expect(got).To(gomega.Equal(subResources))
+
+	got, err = r.DeleteSubResources(c, subResources)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(got).To(gomega.Equal(subResources[:1]))
+
+	got, err = r.DeleteSubResources(c, got)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(got).To(gomega.BeEmpty())
+}
@@ -0,0 +1,204 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+const (
+	// Duration after which the schema of a cluster is fetched again
+	schemaRefreshInterval = 10 * time.Minute
+
+	// Minimum duration between fetches of the schema when a kind is not
+	// found in it, like the kinds of newly installed CRDs
+	schemaMissRefreshInterval = time.Minute
+)
+
+var log = logf.Log.WithName("validation")
+
+// Validator validates objects against the OpenAPI schema of a cluster
+type Validator interface {
+	Validate(objects []*unstructured.Unstructured) error
+}
+
+var (
+	validatorsMu sync.Mutex
+	// validators caches the validator of each cluster, keyed by the cluster ID
+	validators = make(map[string]*schemaValidator)
+)
+
+// New returns the Validator for the cluster clusterID. The schema of a
+// cluster is fetched only once and shared by all its Validators.
+func New(clusterID string, kubeConfig *rest.Config) (Validator, error) {
+	if kubeConfig == nil {
+		return nil, errors.NewInputError("New Validator", "kubeConfig", nil)
+	}
+
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	if v, ok := validators[clusterID]; ok {
+		return v, nil
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	v := newSchemaValidator(discoveryClient)
+	validators[clusterID] = v
+	return v, nil
+}
+
+type schemaValidator struct {
+	discovery discovery.OpenAPISchemaInterface
+
+	// fetchMu serializes the fetches of the schema. Fetching does not hold
+	// mu, so objects are validated with the current schema meanwhile.
+	fetchMu   sync.Mutex
+	mu        sync.RWMutex
+	parser    *managedfields.GvkParser
+	fetchedAt time.Time
+}
+
+func newSchemaValidator(discoveryClient discovery.OpenAPISchemaInterface) *schemaValidator {
+	return &schemaValidator{
+		discovery: discoveryClient,
+	}
+}
+
+// Validate validates all the objects and returns a ValidationError listing
+// the errors of every invalid object. Objects whose kind is not found in the
+// schema are not validated. If the schema can not be fetched, validation is
+// skipped and left to the api server.
+func (v *schemaValidator) Validate(objects []*unstructured.Unstructured) error {
+	var messages []string
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		parseableType, err := v.parseableType(gvk)
+		if err != nil {
+			log.Error(err, "failed to fetch schema. skipping validation")
+			return nil
+		}
+		if parseableType == nil {
+			log.V(2).Info("kind not found in schema. skipping validation", "gvk", gvk)
+			continue
+		}
+		_, err = parseableType.FromUnstructured(obj.Object)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("%s %s: %s", gvk.Kind, obj.GetName(), formatError(err)))
+		}
+	}
+	if len(messages) > 0 {
+		return errors.NewValidationError(strings.Join(messages, "; "), nil)
+	}
+	return nil
+}
+
+// parseableType returns the schema of gvk or nil if gvk is not found in
+// the schema of the cluster
+func (v *schemaValidator) parseableType(gvk schema.GroupVersionKind) (*typed.ParseableType, error) {
+	parser, fetchedAt := v.current()
+	if parser == nil || time.Since(fetchedAt) > schemaRefreshInterval {
+		err := v.refresh(fetchedAt)
+		parser, fetchedAt = v.current()
+		if parser == nil {
+			if err == nil {
+				err = fmt.Errorf("openapi schema not fetched")
+			}
+			return nil, err
+		}
+	}
+
+	parseableType := parser.Type(gvk)
+	if parseableType == nil && time.Since(fetchedAt) > schemaMissRefreshInterval {
+		if err := v.refresh(fetchedAt); err == nil {
+			parser, _ = v.current()
+			parseableType = parser.Type(gvk)
+		}
+	}
+	return parseableType, nil
+}
+
+// current returns the schema fetched last and the time of the last fetch
+func (v *schemaValidator) current() (*managedfields.GvkParser, time.Time) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.parser, v.fetchedAt
+}
+
+// refresh fetches the schema from the cluster unless it was fetched after
+// fetchedAt. The schema fetched last is kept if the fetch fails. While a
+// schema is available, callers do not wait for a fetch already in progress.
+func (v *schemaValidator) refresh(fetchedAt time.Time) error {
+	if parser, _ := v.current(); parser == nil {
+		v.fetchMu.Lock()
+	} else if !v.fetchMu.TryLock() {
+		return nil
+	}
+	defer v.fetchMu.Unlock()
+
+	if _, last := v.current(); last.After(fetchedAt) {
+		// Fetched by another caller meanwhile
+		return nil
+	}
+
+	started := time.Now()
+	parser, err := v.fetch()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// Not fetching again right away if the fetch fails
+	v.fetchedAt = started
+	if err != nil {
+		return err
+	}
+	v.parser = parser
+	return nil
+}
+
+// fetch fetches and parses the schema of the cluster
+func (v *schemaValidator) fetch() (*managedfields.GvkParser, error) {
+	doc, err := v.discovery.OpenAPISchema()
+	if err != nil {
+		log.Error(err, "failed to fetch openapi schema")
+		return nil, err
+	}
+	models, err := proto.NewOpenAPIData(doc)
+	if err != nil {
+		log.Error(err, "failed to parse openapi schema")
+		return nil, err
+	}
+	parser, err := managedfields.NewGVKParser(models, false)
+	if err != nil {
+		log.Error(err, "failed to build parser for openapi schema")
+		return nil, err
+	}
+	log.V(2).Info("fetched openapi schema")
+	return parser, nil
+}
+
+// formatError joins the lines of a multi line validation error
+func formatError(err error) string {
+	lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+	messages := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line != "" && line != "errors:" {
+			messages = append(messages, line)
+		}
+	}
+	return strings.Join(messages, ", ")
+}
@@ -0,0 +1,180 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/errors"
+
+	openapi_v2 "github.com/google/gnostic-models/openapiv2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testSchema = `{
+  "swagger": "2.0",
+  "info": {"title": "test", "version": "v1"},
+  "paths": {},
+  "definitions": {
+    "io.k8s.api.core.v1.ConfigMap": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "data": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "", "kind": "ConfigMap", "version": "v1"}]
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "namespace": {"type": "string"}
+      }
+    }
+  }
+}`
+
+type fakeDiscovery struct {
+	fetches int
+	err     error
+
+	// started and release block a fetch if set
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d *fakeDiscovery) OpenAPISchema() (*openapi_v2.Document, error) {
+	d.fetches++
+	if d.release != nil {
+		close(d.started)
+		<-d.release
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return openapi_v2.ParseDocument([]byte(testSchema))
+}
+
+func object(apiVersion, kind, name string, fields map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: fields}
+	if obj.Object == nil {
+		obj.Object = make(map[string]interface{})
+	}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	return obj
+}
+
+func Test_schemaValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		objects  []*unstructured.Unstructured
+		wantErr  bool
+		contains []string
+	}{
+		{
+			name: "accept valid objects",
+			objects: []*unstructured.Unstructured{
+				object("v1", "ConfigMap", "valid", map[string]interface{}{
+					"data": map[string]interface{}{"key": "value"},
+				}),
+			},
+		},
+		{
+			name: "skip kinds not found in schema",
+			objects: []*unstructured.Unstructured{
+				object("example.com/v1", "Unknown", "unknown", map[string]interface{}{
+					"spec": map[string]interface{}{"any": "field"},
+				}),
+			},
+		},
+		{
+			name: "aggregate errors of all invalid objects",
+			objects: []*unstructured.Unstructured{
+				object("v1", "ConfigMap", "typo", map[string]interface{}{
+					"dta": map[string]interface{}{"key": "value"},
+				}),
+				object("v1", "ConfigMap", "valid", nil),
+				object("v1", "ConfigMap", "wrong-type", map[string]interface{}{
+					"data": "value",
+				}),
+			},
+			wantErr:  true,
+			contains: []string{"ConfigMap typo: .dta", "ConfigMap wrong-type: .data"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newSchemaValidator(&fakeDiscovery{})
+			err := v.Validate(tt.objects)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("schemaValidator.Validate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr && !errors.ValidationError(err) {
+				t.Errorf("schemaValidator.Validate() error = %v, want ValidationError", err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("schemaValidator.Validate() error = %v, want to contain %s", err, s)
+				}
+			}
+		})
+	}
+}
+
+func Test_schemaValidator_cache(t *testing.T) {
+	d := &fakeDiscovery{}
+	v := newSchemaValidator(d)
+	objects := []*unstructured.Unstructured{object("v1", "ConfigMap", "valid", nil)}
+	for i := 0; i < 3; i++ {
+		if err := v.Validate(objects); err != nil {
+			t.Fatalf("schemaValidator.Validate() error = %v", err)
+		}
+	}
+	if d.fetches != 1 {
+		t.Errorf("schemaValidator fetched schema %d times, want 1", d.fetches)
+	}
+
+	// Skip validation if the schema can not be fetched
+	v = newSchemaValidator(&fakeDiscovery{err: fmt.Errorf("unavailable")})
+	if err := v.Validate([]*unstructured.Unstructured{object("v1", "ConfigMap", "typo", map[string]interface{}{"dta": "x"})}); err != nil {
+		t.Errorf("schemaValidator.Validate() error = %v, want nil", err)
+	}
+}
+
+func Test_schemaValidator_refreshInBackground(t *testing.T) {
+	d := &fakeDiscovery{}
+	v := newSchemaValidator(d)
+	objects := []*unstructured.Unstructured{object("v1", "ConfigMap", "typo", map[string]interface{}{"dta": "x"})}
+	if err := v.Validate(objects); !errors.ValidationError(err) {
+		t.Fatalf("schemaValidator.Validate() error = %v, want ValidationError", err)
+	}
+
+	// Block the next fetch of the stale schema
+	v.fetchedAt = time.Now().Add(-2 * schemaRefreshInterval)
+	d.started = make(chan struct{})
+	d.release = make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- v.Validate(objects)
+	}()
+	<-d.started
+
+	// Validate with the stale schema while it is fetched
+	if err := v.Validate(objects); !errors.ValidationError(err) {
+		t.Errorf("schemaValidator.Validate() during fetch error = %v, want ValidationError", err)
+	}
+
+	close(d.release)
+	if err := <-done; !errors.ValidationError(err) {
+		t.Errorf("schemaValidator.Validate() error = %v, want ValidationError", err)
+	}
+	if d.fetches != 2 {
+		t.Errorf("schemaValidator fetched schema %d times, want 2", d.fetches)
+	}
+}
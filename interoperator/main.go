@@ -18,7 +18,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
 	osbv1alpha1 "github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/api/osb/v1alpha1"
@@ -26,8 +29,13 @@ import (
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/multiclusterdeploy"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/provisioners"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/controllers/schedulers"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/golden"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/gotemplate"
+	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/internal/renderer/offline"
 	"github.com/cloudfoundry-incubator/service-fabrik-broker/interoperator/pkg/constants"
 
+	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -36,12 +44,19 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
 	// +kubebuilder:scaffold:imports
 )
 
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
+
+	// Subcommands which run without a cluster
+	commands = map[string]func(args []string, out io.Writer) error{
+		"render": runRender,
+		"test":   runTest,
+	}
 )
 
 func init() {
@@ -53,6 +68,22 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			// Plans rendered offline can use the local charts and bases
+			// anywhere on the file system of the user
+			renderer.SetLocalRoot("/")
+			// Errors are returned to the user, the logs of the
+			// provisioner code are of no use here
+			ctrl.SetLogger(logr.Discard())
+			if err := command(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	syncPeriod := 24 * time.Hour
@@ -108,3 +139,149 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runRender implements the render subcommand. It renders the templates of a
+// plan without a cluster and writes the resources, the sources and the
+// status as yaml to out.
+func runRender(args []string, out io.Writer) error {
+	var servicePath, planPath, instancePath, bindingPath, objectsPath, librariesPath, action, lookupAllowList string
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.StringVar(&servicePath, "service", "", "The file containing the SFService.")
+	flags.StringVar(&planPath, "plan", "", "The file containing the SFPlan.")
+	flags.StringVar(&instancePath, "instance", "", "The file containing the SFServiceInstance.")
+	flags.StringVar(&bindingPath, "binding", "", "The file containing the SFServiceBinding. Required for bind and unbind.")
+	flags.StringVar(&objectsPath, "objects", "", "The file containing the objects to be used for the sources.")
+	flags.StringVar(&librariesPath, "libraries", "", "The file containing the ConfigMaps of the template libraries used by the plan.")
+	flags.StringVar(&action, "action", osbv1alpha1.ProvisionAction, "The action to render. One of provision, bind or unbind.")
+	flags.StringVar(&lookupAllowList, "lookup-allow-list", "", lookupAllowListUsage)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = setLookupAllowList(lookupAllowList)
+	if err != nil {
+		return err
+	}
+	if servicePath == "" || planPath == "" || instancePath == "" {
+		return fmt.Errorf("--service, --plan and --instance are required")
+	}
+
+	input := &offline.Input{
+		Service:  &osbv1alpha1.SFService{},
+		Plan:     &osbv1alpha1.SFPlan{},
+		Instance: &osbv1alpha1.SFServiceInstance{},
+	}
+	err = offline.ReadObject(servicePath, input.Service)
+	if err != nil {
+		return err
+	}
+	err = offline.ReadObject(planPath, input.Plan)
+	if err != nil {
+		return err
+	}
+	err = offline.ReadObject(instancePath, input.Instance)
+	if err != nil {
+		return err
+	}
+	if bindingPath != "" {
+		input.Binding = &osbv1alpha1.SFServiceBinding{}
+		err = offline.ReadObject(bindingPath, input.Binding)
+		if err != nil {
+			return err
+		}
+	}
+	if objectsPath != "" {
+		input.Objects, err = offline.ReadObjects(objectsPath)
+		if err != nil {
+			return err
+		}
+	}
+	if librariesPath != "" {
+		input.Libraries, err = offline.ReadObjects(librariesPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := offline.Render(input, action)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// runTest implements the test subcommand. It compares the output of the
+// templates of the plans in the directories with the golden files.
+func runTest(args []string, out io.Writer) error {
+	var update bool
+	var lookupAllowList string
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.BoolVar(&update, "update", false, "Write the rendered output to the golden files instead of comparing.")
+	flags.StringVar(&lookupAllowList, "lookup-allow-list", "", lookupAllowListUsage)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = setLookupAllowList(lookupAllowList)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("at least one directory is required")
+	}
+
+	failed := 0
+	for _, root := range flags.Args() {
+		planDirs, err := golden.FindPlanDirs(root)
+		if err != nil {
+			return err
+		}
+		for _, planDir := range planDirs {
+			results, err := golden.Run(planDir, update)
+			if err != nil {
+				return fmt.Errorf("failed to run tests for %s: %v", planDir, err)
+			}
+			for _, result := range results {
+				fmt.Fprintln(out, result)
+				if result.Failed() {
+					failed++
+				}
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d template tests failed", failed)
+	}
+	return nil
+}
+
+const lookupAllowListUsage = "Comma separated list of the kinds the templates are allowed to lookup, as <apiVersion>/<kind>. Like lookupAllowList of the interoperator config."
+
+// setLookupAllowList sets the kinds the templates are allowed to lookup from
+// a comma separated list of <apiVersion>/<kind>, like v1/Secret or
+// apps/v1/StatefulSet
+func setLookupAllowList(value string) error {
+	kinds := []osbv1alpha1.APIVersionKind{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "/")
+		if i <= 0 || i == len(item)-1 {
+			return fmt.Errorf("invalid kind %s in --lookup-allow-list, expected <apiVersion>/<kind>", item)
+		}
+		kinds = append(kinds, osbv1alpha1.APIVersionKind{
+			APIVersion: item[:i],
+			Kind:       item[i+1:],
+		})
+	}
+	gotemplate.SetLookupAllowList(kinds)
+	return nil
+}
@@ -18,6 +18,22 @@ const (
 	PlanHashKey                           = "interoperator.servicefabrik.io/planhash"
 	ErrorThreshold                        = 10
 	PlanDeleteAttempts                    = "interoperator.servicefabrik.io/deleteattempts"
+	TemplateLibraryKey                    = "interoperator.servicefabrik.io/template-library"
+	TemplateLibraryVersionKey             = "interoperator.servicefabrik.io/template-library-version"
+	ServerSideApplyKey                    = "interoperator.servicefabrik.io/server-side-apply"
+	WaveKey                               = "interoperator.servicefabrik.io/wave"
+	RetentionKey                          = "interoperator.servicefabrik.io/retention"
+	RetainUntilKey                        = "interoperator.servicefabrik.io/retain-until"
+	RetainedInstanceIDKey                 = "interoperator.servicefabrik.io/retained-instance-id"
+	RetainedResourcesKey                  = "interoperator.servicefabrik.io/retained-resources"
+	HookRunKey                            = "interoperator.servicefabrik.io/hook-run"
+	OperationRunKey                       = "interoperator.servicefabrik.io/operation-run"
+	IgnoreDifferencesKey                  = "interoperator.servicefabrik.io/ignore-differences"
+	AdoptKey                              = "interoperator.servicefabrik.io/adopt"
+
+	// FieldManagerName is the field manager of the resources applied with
+	// server-side apply
+	FieldManagerName = "interoperator"
 
 	ConfigMapName           = "interoperator-config"
 	ConfigMapKey            = "config"
@@ -40,7 +56,21 @@ const (
 	GoTemplateType = "gotemplate"
 
 	PlanWatchDrainTimeout           = time.Second * 2
+	WaveRequeueInterval             = time.Second * 10
+	RetentionCleanupInterval        = time.Minute * 10
+	HookRequeueInterval             = time.Second * 10
 	DefaultClusterReconcileInterval = "20m"
+	DefaultDriftDetectionInterval   = "10m"
+
+	DefaultHelmChartCacheTTL     = "1h"
+	DefaultHelmChartCacheMaxSize = "512Mi"
+
+	DefaultSecretGeneratorKeySecret = "interoperator-secret-generator-key"
+
+	DefaultTemplateTimeout       = "10s"
+	DefaultTemplateMaxOutputSize = "8Mi"
+
+	DefaultRenderCacheSize = 4096
 
 	ListPaginationLimit = 100
 )
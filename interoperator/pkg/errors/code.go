@@ -12,7 +12,14 @@ const (
 
 	CodeOperationInProgress = "OperationInProgress"
 
-	CodeRendererError = "RendererError"
+	CodeRendererError    = "RendererError"
+	CodeValidationError  = "ValidationError"
+	CodeApplyConflict    = "ApplyConflict"
+	CodeAdoptionConflict = "AdoptionConflict"
+	CodeWaveNotReady     = "WaveNotReady"
+	CodeWaveFailed       = "WaveFailed"
+	CodeHookPending      = "HookPending"
+	CodeHookFailed       = "HookFailed"
 
 	CodeClusterRegistryError = "ClusterRegistryError"
 	CodeClusterIDNotSet      = "ClusterIDNotSet"
@@ -196,6 +196,110 @@ func RendererError(err error) bool {
 	return ErrorCode(err) == CodeRendererError
 }
 
+// NewValidationError returns a new error which indicates rendered resources
+// are invalid as per the schema of the cluster
+func NewValidationError(message string, err error) *InteroperatorError {
+	return &InteroperatorError{
+		Err:     err,
+		Code:    CodeValidationError,
+		Message: message,
+	}
+}
+
+// ValidationError is true if the error indicates a ValidationError.
+func ValidationError(err error) bool {
+	return ErrorCode(err) == CodeValidationError
+}
+
+// NewApplyConflict returns a new error which indicates that server-side
+// apply of a resource conflicts with fields owned by another field manager
+func NewApplyConflict(kind, name string, err error) *InteroperatorError {
+	return &InteroperatorError{
+		Err:     err,
+		Code:    CodeApplyConflict,
+		Message: fmt.Sprintf("apply of %s %s conflicts with other field managers", kind, name),
+	}
+}
+
+// ApplyConflict is true if the error indicates an ApplyConflict.
+func ApplyConflict(err error) bool {
+	return ErrorCode(err) == CodeApplyConflict
+}
+
+// NewAdoptionConflict returns a new error which indicates that a resource
+// to be reconciled already exists and is not adopted by the instance
+func NewAdoptionConflict(kind, name, reason string, err error) *InteroperatorError {
+	return &InteroperatorError{
+		Err:     err,
+		Code:    CodeAdoptionConflict,
+		Message: fmt.Sprintf("%s %s already exists and %s", kind, name, reason),
+	}
+}
+
+// AdoptionConflict is true if the error indicates an AdoptionConflict.
+func AdoptionConflict(err error) bool {
+	return ErrorCode(err) == CodeAdoptionConflict
+}
+
+// NewWaveNotReady returns a new error which indicates that the resources of
+// a wave are not ready yet and the next wave has to wait for them
+func NewWaveNotReady(wave int, message string, err error) *InteroperatorError {
+	return &InteroperatorError{
+		Err:     err,
+		Code:    CodeWaveNotReady,
+		Message: fmt.Sprintf("waiting for wave %d. %s", wave, message),
+	}
+}
+
+// WaveNotReady is true if the error indicates a WaveNotReady error.
+func WaveNotReady(err error) bool {
+	return ErrorCode(err) == CodeWaveNotReady
+}
+
+// NewWaveFailed returns a new error which indicates that a resource of a
+// wave failed and the next wave will never be applied
+func NewWaveFailed(wave int, message string, err error) *InteroperatorError {
+	return &InteroperatorError{
+		Err:     err,
+		Code:    CodeWaveFailed,
+		Message: fmt.Sprintf("wave %d failed. %s", wave, message),
+	}
+}
+
+// WaveFailed is true if the error indicates a WaveFailed error.
+func WaveFailed(err error) bool {
+	return ErrorCode(err) == CodeWaveFailed
+}
+
+// NewHookPending returns a new error which indicates that a hook Job has not
+// completed yet
+func NewHookPending(job string, err error) *InteroperatorError {
+	return &InteroperatorError{
+		Err:     err,
+		Code:    CodeHookPending,
+		Message: fmt.Sprintf("waiting for hook job %s", job),
+	}
+}
+
+// HookPending is true if the error indicates a HookPending error.
+func HookPending(err error) bool {
+	return ErrorCode(err) == CodeHookPending
+}
+
+// NewHookFailed returns a new error which indicates that a hook Job failed
+func NewHookFailed(job, message string, err error) *InteroperatorError {
+	return &InteroperatorError{
+		Err:     err,
+		Code:    CodeHookFailed,
+		Message: fmt.Sprintf("hook job %s failed. %s", job, message),
+	}
+}
+
+// HookFailed is true if the error indicates a HookFailed error.
+func HookFailed(err error) bool {
+	return ErrorCode(err) == CodeHookFailed
+}
+
 // NewTemplateNotFound returns a new error which indicates plan template not found
 func NewTemplateNotFound(name, planID string, err error) *InteroperatorError {
 	return &InteroperatorError{
@@ -817,6 +817,529 @@ func TestRendererError(t *testing.T) {
 	}
 }
 
+func TestNewValidationError(t *testing.T) {
+	type args struct {
+		message string
+		err     error
+	}
+	tests := []struct {
+		name string
+		args args
+		want *InteroperatorError
+	}{
+		{
+			name: "return ValidationError",
+			args: args{
+				message: message,
+				err:     nil,
+			},
+			want: &InteroperatorError{
+				Err:     nil,
+				Code:    CodeValidationError,
+				Message: message,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewValidationError(tt.args.message, tt.args.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewValidationError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true if ValidationError",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeValidationError,
+					Message: message,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false if not ValidationError",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeUnknown,
+					Message: message,
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidationError(tt.args.err); got != tt.want {
+				t.Errorf("ValidationError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewApplyConflict(t *testing.T) {
+	type args struct {
+		kind string
+		name string
+		err  error
+	}
+	tests := []struct {
+		name string
+		args args
+		want *InteroperatorError
+	}{
+		{
+			name: "return ApplyConflict",
+			args: args{
+				kind: "Deployment",
+				name: "postgres",
+				err:  nil,
+			},
+			want: &InteroperatorError{
+				Err:     nil,
+				Code:    CodeApplyConflict,
+				Message: "apply of Deployment postgres conflicts with other field managers",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewApplyConflict(tt.args.kind, tt.args.name, tt.args.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewApplyConflict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConflict(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true if ApplyConflict",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeApplyConflict,
+					Message: message,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false if not ApplyConflict",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeUnknown,
+					Message: message,
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ApplyConflict(tt.args.err); got != tt.want {
+				t.Errorf("ApplyConflict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAdoptionConflict(t *testing.T) {
+	type args struct {
+		kind   string
+		name   string
+		reason string
+		err    error
+	}
+	tests := []struct {
+		name string
+		args args
+		want *InteroperatorError
+	}{
+		{
+			name: "return AdoptionConflict",
+			args: args{
+				kind:   "Deployment",
+				name:   "postgres",
+				reason: "is owned by SFServiceInstance other-instance",
+				err:    nil,
+			},
+			want: &InteroperatorError{
+				Err:     nil,
+				Code:    CodeAdoptionConflict,
+				Message: "Deployment postgres already exists and is owned by SFServiceInstance other-instance",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewAdoptionConflict(tt.args.kind, tt.args.name, tt.args.reason, tt.args.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewAdoptionConflict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdoptionConflict(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true if AdoptionConflict",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeAdoptionConflict,
+					Message: message,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false if not AdoptionConflict",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeUnknown,
+					Message: message,
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AdoptionConflict(tt.args.err); got != tt.want {
+				t.Errorf("AdoptionConflict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWaveNotReady(t *testing.T) {
+	type args struct {
+		wave    int
+		message string
+		err     error
+	}
+	tests := []struct {
+		name string
+		args args
+		want *InteroperatorError
+	}{
+		{
+			name: "return WaveNotReady",
+			args: args{
+				wave:    1,
+				message: message,
+				err:     nil,
+			},
+			want: &InteroperatorError{
+				Err:     nil,
+				Code:    CodeWaveNotReady,
+				Message: fmt.Sprintf("waiting for wave 1. %s", message),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewWaveNotReady(tt.args.wave, tt.args.message, tt.args.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewWaveNotReady() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaveNotReady(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true if WaveNotReady",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeWaveNotReady,
+					Message: message,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false if not WaveNotReady",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeUnknown,
+					Message: message,
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WaveNotReady(tt.args.err); got != tt.want {
+				t.Errorf("WaveNotReady() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHookPending(t *testing.T) {
+	type args struct {
+		job string
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want *InteroperatorError
+	}{
+		{
+			name: "return HookPending",
+			args: args{
+				job: "migrate",
+				err: nil,
+			},
+			want: &InteroperatorError{
+				Err:     nil,
+				Code:    CodeHookPending,
+				Message: "waiting for hook job migrate",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewHookPending(tt.args.job, tt.args.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewHookPending() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHookPending(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true if HookPending",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeHookPending,
+					Message: message,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false if not HookPending",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeUnknown,
+					Message: message,
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HookPending(tt.args.err); got != tt.want {
+				t.Errorf("HookPending() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWaveFailed(t *testing.T) {
+	type args struct {
+		wave    int
+		message string
+		err     error
+	}
+	tests := []struct {
+		name string
+		args args
+		want *InteroperatorError
+	}{
+		{
+			name: "return WaveFailed",
+			args: args{
+				wave:    1,
+				message: message,
+				err:     nil,
+			},
+			want: &InteroperatorError{
+				Err:     nil,
+				Code:    CodeWaveFailed,
+				Message: fmt.Sprintf("wave 1 failed. %s", message),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewWaveFailed(tt.args.wave, tt.args.message, tt.args.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewWaveFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaveFailed(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true if WaveFailed",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeWaveFailed,
+					Message: message,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false if not WaveFailed",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeWaveNotReady,
+					Message: message,
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WaveFailed(tt.args.err); got != tt.want {
+				t.Errorf("WaveFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHookFailed(t *testing.T) {
+	type args struct {
+		job     string
+		message string
+		err     error
+	}
+	tests := []struct {
+		name string
+		args args
+		want *InteroperatorError
+	}{
+		{
+			name: "return HookFailed",
+			args: args{
+				job:     "migrate",
+				message: message,
+				err:     nil,
+			},
+			want: &InteroperatorError{
+				Err:     nil,
+				Code:    CodeHookFailed,
+				Message: fmt.Sprintf("hook job migrate failed. %s", message),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewHookFailed(tt.args.job, tt.args.message, tt.args.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewHookFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHookFailed(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true if HookFailed",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeHookFailed,
+					Message: message,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false if not HookFailed",
+			args: args{
+				err: &InteroperatorError{
+					Err:     nil,
+					Code:    CodeUnknown,
+					Message: message,
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HookFailed(tt.args.err); got != tt.want {
+				t.Errorf("HookFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNewTemplateNotFound(t *testing.T) {
 	type args struct {
 		name   string
@@ -266,7 +266,7 @@ func computeSources(c client.Client, service *osbv1alpha1.SFService, plan *osbv1
 		return nil, err
 	}
 
-	renderer, err := rendererFactory.GetRenderer(template.Type, nil)
+	renderer, err := rendererFactory.GetRenderer(template.Type, c)
 	if err != nil {
 		log.Error(err, "failed to get sources renderer", "serviceID", serviceID, "planID", planID, "instanceID", instanceID, "bindingID", bindingID, "action", action, "type", template.Type)
 		return nil, err